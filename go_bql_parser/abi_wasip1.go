@@ -0,0 +1,77 @@
+//go:build wasip1
+
+package main
+
+import (
+	"unsafe"
+
+	"bql-parser/engine"
+)
+
+// Core WebAssembly exports for WASI Preview 1 builds, which cannot use the
+// component model. Strings cross the boundary as a pointer and a length
+// into linear memory. The host allocates input buffers with bql_alloc,
+// writes UTF-8 into them and passes them to a function. Each function
+// returns its JSON output packed as ptr<<32 | len; the host reads it and
+// then releases it, like its inputs, with bql_free.
+
+// buffers keeps the memory handed to the host reachable until it is freed.
+var buffers = make(map[uint32][]byte)
+
+//go:wasmexport bql_alloc
+func bqlAlloc(size uint32) uint32 {
+	if size == 0 {
+		size = 1
+	}
+	buf := make([]byte, size)
+	ptr := uint32(uintptr(unsafe.Pointer(&buf[0])))
+	buffers[ptr] = buf
+	return ptr
+}
+
+//go:wasmexport bql_free
+func bqlFree(ptr uint32) {
+	delete(buffers, ptr)
+}
+
+//go:wasmexport parse_bql_to_json
+func parseBQLToJSONExport(queryPtr, queryLen uint32) uint64 {
+	return returnString(engine.ParseBQLToJSON(readString(queryPtr, queryLen)))
+}
+
+//go:wasmexport execute_bql
+func executeBQLExport(queryPtr, queryLen, ledgerPtr, ledgerLen uint32) uint64 {
+	return returnString(engine.ExecuteBQL(readString(queryPtr, queryLen), readString(ledgerPtr, ledgerLen)))
+}
+
+//go:wasmexport execute_bql_params
+func executeBQLParamsExport(queryPtr, queryLen, ledgerPtr, ledgerLen, paramsPtr, paramsLen uint32) uint64 {
+	return returnString(engine.ExecuteBQLParams(readString(queryPtr, queryLen), readString(ledgerPtr, ledgerLen), readString(paramsPtr, paramsLen)))
+}
+
+//go:wasmexport execute_bql_script
+func executeBQLScriptExport(scriptPtr, scriptLen, ledgerPtr, ledgerLen uint32) uint64 {
+	return returnString(engine.ExecuteScript(readString(scriptPtr, scriptLen), readString(ledgerPtr, ledgerLen)))
+}
+
+//go:wasmexport check_beancount_syntax
+func checkSyntaxExport(ledgerPtr, ledgerLen uint32) uint64 {
+	return returnString(engine.CheckBeancountSyntax(readString(ledgerPtr, ledgerLen)))
+}
+
+// readString copies a string out of a buffer returned by bql_alloc, so
+// that the host may free or reuse the buffer once the call returns.
+func readString(ptr, size uint32) string {
+	buf := buffers[ptr]
+	if uint32(len(buf)) < size {
+		panic("bql: string outside of an allocated buffer")
+	}
+	return string(buf[:size])
+}
+
+// returnString copies s into a buffer owned by the host until bql_free.
+func returnString(s string) uint64 {
+	ptr := bqlAlloc(uint32(len(s)))
+	copy(buffers[ptr], s)
+	return uint64(ptr)<<32 | uint64(len(s))
+}
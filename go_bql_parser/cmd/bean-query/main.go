@@ -0,0 +1,330 @@
+// Command bean-query runs BQL queries against Beancount ledgers from the
+// terminal, using the same engine package as the WASM component.
+//
+// Usage:
+//
+//	bean-query query [-format FORMAT] [-params JSON] LEDGER [QUERY]
+//	bean-query check [-format text|json] LEDGER
+//	bean-query format [-column N] [-indent N] [-w] LEDGER
+//	bean-query parse QUERY
+//	bean-query mcp [LEDGER]
+//	bean-query lsp
+//
+// FORMAT is text (the default), csv, tsv, markdown, html or json. Without
+// a QUERY, the query subcommand starts an interactive shell. QUERY may
+// hold several statements separated by semicolons. JSON gives the values
+// of ? and :name parameters in QUERY, as an object or an array. The format
+// subcommand prints LEDGER laid out as bean-format does, or rewrites it
+// with -w. Syntax errors in LEDGER are reported on stderr, and queries run
+// on the transactions without errors. The mcp subcommand serves the engine
+// as an MCP server over stdin and stdout, and the lsp subcommand serves a
+// Beancount language server over them. Ledgers are read from disk and
+// their include directives are followed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"bql-parser/engine"
+	"bql-parser/lsp"
+	"bql-parser/mcp"
+)
+
+const usage = `usage:
+  bean-query query [-format FORMAT] [-params JSON] LEDGER [QUERY]
+  bean-query check [-format text|json] LEDGER
+  bean-query format [-column N] [-indent N] [-w] LEDGER
+  bean-query parse QUERY
+  bean-query mcp [LEDGER]
+  bean-query lsp
+
+FORMAT is text (the default), csv, tsv, markdown, html or json.
+Without a QUERY, "query" starts an interactive shell. QUERY may hold
+several statements separated by semicolons; their results are printed
+in order, or as one {"results": [...]} object in json.
+JSON gives the values of ? and :name parameters in QUERY, as an object
+keyed by name or position, or an array for ? parameters.
+"format" aligns the currencies of amounts at column N (by default the
+narrowest that fits), indents postings by N spaces (default 2) and
+prints the result, or writes it back to LEDGER with -w.
+"mcp" serves MCP over stdin and stdout; LEDGER is the default ledger of
+its tools. "lsp" serves the Language Server Protocol over stdin and
+stdout for editing .beancount files.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the process exit code:
+// 0 on success, 1 when the command fails, 2 on usage errors.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "query":
+		return runQuery(args[1:], stdin, stdout, stderr)
+	case "check":
+		return runCheck(args[1:], stdout, stderr)
+	case "format":
+		return runFormat(args[1:], stdout, stderr)
+	case "parse":
+		return runParse(args[1:], stdout, stderr)
+	case "mcp":
+		return runMCP(args[1:], stdin, stdout, stderr)
+	case "lsp":
+		return runLSP(args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "bean-query: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+}
+
+func runQuery(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	formatName := fs.String("format", "text", "output format: text, csv, tsv, markdown, html or json")
+	history := fs.String("history", defaultHistoryPath(), "shell history file, empty to disable")
+	paramsJSON := fs.String("params", "", "JSON values of the query parameters")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	format, err := engine.ParseFormat(*formatName)
+	if err != nil {
+		fmt.Fprintf(stderr, "bean-query: %v\n", err)
+		return 2
+	}
+	params, err := engine.ParseParams(*paramsJSON)
+	if err != nil {
+		printError(stderr, engine.NewErrorInfo(engine.PhaseBind, err))
+		return 2
+	}
+
+	session := loadSession(fs.Arg(0))
+	if err := session.LoadError(); err != nil {
+		printError(stderr, engine.NewErrorInfo(engine.PhaseLedger, err))
+		return 1
+	}
+	// Transactions with errors are skipped; the rest of the ledger is
+	// queried.
+	writeDiagnostics(stderr, session.Ledger.Errors)
+
+	if fs.NArg() == 1 {
+		if params != nil {
+			fmt.Fprintln(stderr, "bean-query: -params needs a QUERY")
+			return 2
+		}
+		sh := newShell(session, stdin, stdout, stderr, format, *history)
+		return sh.run()
+	}
+
+	query := strings.Join(fs.Args()[1:], " ")
+	var results []*engine.Result
+	var errInfo *engine.ErrorInfo
+	if params != nil {
+		var result *engine.Result
+		result, errInfo = session.QueryParams(query, params)
+		results = []*engine.Result{result}
+	} else {
+		results, errInfo = session.QueryScript(query)
+	}
+	if errInfo != nil {
+		printError(stderr, errInfo)
+		return 1
+	}
+	if err := writeResults(stdout, results, format); err != nil {
+		fmt.Fprintf(stderr, "bean-query: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	session := loadSession(fs.Arg(0))
+	if err := session.LoadError(); err != nil {
+		printError(stderr, engine.NewErrorInfo(engine.PhaseLedger, err))
+		return 1
+	}
+	result := session.Check()
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			fmt.Fprintf(stderr, "bean-query: %v\n", err)
+			return 1
+		}
+	case "text":
+		writeDiagnostics(stdout, result.Errors)
+	default:
+		fmt.Fprintf(stderr, "bean-query: unknown format %q\n", *format)
+		return 2
+	}
+	if !result.Valid {
+		return 1
+	}
+	return 0
+}
+
+func runFormat(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("format", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	column := fs.Int("column", 0, "column of currencies, 0 for the narrowest that fits")
+	indent := fs.Int("indent", engine.DefaultIndent, "spaces before postings and metadata")
+	write := fs.Bool("w", false, "write the result to LEDGER instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *column < 0 || *indent < 1 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	path := fs.Arg(0)
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "bean-query: %v\n", err)
+		return 1
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "bean-query: %v\n", err)
+		return 1
+	}
+	out := engine.FormatLedger(string(data), engine.FormatOptions{CurrencyColumn: *column, Indent: *indent})
+	if *write {
+		if out == string(data) {
+			return 0
+		}
+		if err := os.WriteFile(path, []byte(out), info.Mode().Perm()); err != nil {
+			fmt.Fprintf(stderr, "bean-query: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprint(stdout, out)
+	return 0
+}
+
+func runParse(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	ast, err := engine.Parse(strings.Join(args, " "))
+	if err != nil {
+		printError(stderr, engine.NewErrorInfo(engine.PhaseParse, err))
+		return 1
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(ast); err != nil {
+		fmt.Fprintf(stderr, "bean-query: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runMCP(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 1 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	var session *engine.LedgerSession
+	if len(args) == 1 {
+		session = loadSession(args[0])
+		if err := session.LoadError(); err != nil {
+			printError(stderr, engine.NewErrorInfo(engine.PhaseLedger, err))
+			return 1
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := mcp.NewServer(session).Serve(ctx, stdin, stdout); err != nil && ctx.Err() == nil {
+		fmt.Fprintf(stderr, "bean-query: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runLSP(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) != 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := lsp.NewServer().Serve(ctx, stdin, stdout); err != nil && ctx.Err() == nil {
+		fmt.Fprintf(stderr, "bean-query: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func loadSession(path string) *engine.LedgerSession {
+	return engine.LoadLedgerSession(engine.DiskSource{}, filepath.ToSlash(path))
+}
+
+// printError writes an envelope error in a human-readable form.
+func printError(w io.Writer, e *engine.ErrorInfo) {
+	loc := ""
+	switch {
+	case e.File != "" && e.Line > 0:
+		loc = fmt.Sprintf(" (%s:%d)", e.File, e.Line)
+	case e.Line > 0 && e.Column > 0:
+		loc = fmt.Sprintf(" (line %d, column %d)", e.Line, e.Column)
+	case e.Line > 0:
+		loc = fmt.Sprintf(" (line %d)", e.Line)
+	}
+	if e.Statement > 0 {
+		loc = fmt.Sprintf(" (statement %d)", e.Statement)
+	}
+	fmt.Fprintf(w, "%s error [%s]: %s%s\n", e.Phase, e.Code, e.Message, loc)
+	if e.Snippet != "" {
+		fmt.Fprintf(w, "  %s\n", strings.ReplaceAll(e.Snippet, "\n", "\n  "))
+	}
+	if e.Hint != "" {
+		fmt.Fprintf(w, "hint: %s\n", e.Hint)
+	}
+}
+
+func defaultHistoryPath() string {
+	if p := os.Getenv("BEAN_QUERY_HISTORY"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".bean_query_history")
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testLedger = `2024-01-01 open Assets:Checking USD
+2024-01-01 open Expenses:Food USD
+
+2024-01-05 * "Grocer" "Groceries"
+  Expenses:Food     45.20 USD
+  Assets:Checking  -45.20 USD
+
+2024-01-09 * "Cafe" "Lunch"
+  Expenses:Food     12.00 USD
+  Assets:Checking  -12.00 USD
+`
+
+func writeLedger(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "main.beancount")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestQueryTable(t *testing.T) {
+	ledger := writeLedger(t, testLedger)
+	code, out, errOut := runCommand(t, "", "query", ledger,
+		"SELECT account, SUM(amount) GROUP BY account ORDER BY account")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr: %s", code, errOut)
+	}
+	want := "account          sum(amount)\n" +
+		"---------------  -----------\n" +
+		"Assets:Checking        -57.2\n" +
+		"Expenses:Food           57.2\n"
+	if out != want {
+		t.Errorf("unexpected table:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestQueryCSVAndJSON(t *testing.T) {
+	ledger := writeLedger(t, testLedger)
+
+	code, out, _ := runCommand(t, "", "query", "-format", "csv", ledger, "SELECT date, payee WHERE account = 'Expenses:Food'")
+	if code != 0 {
+		t.Fatalf("csv: exit code %d", code)
+	}
+	if out != "date,payee\n2024-01-05,Grocer\n2024-01-09,Cafe\n" {
+		t.Errorf("unexpected csv output: %q", out)
+	}
+
+	code, out, _ = runCommand(t, "", "query", "-format", "json", ledger, "SELECT payee WHERE account = 'Expenses:Food'")
+	if code != 0 {
+		t.Fatalf("json: exit code %d", code)
+	}
+	var result struct {
+		Columns []string        `json:"columns"`
+		Rows    [][]interface{} `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("invalid json output: %v", err)
+	}
+	if len(result.Rows) != 2 || result.Rows[1][0] != "Cafe" {
+		t.Errorf("unexpected json rows: %v", result.Rows)
+	}
+}
+
+func TestQueryParams(t *testing.T) {
+	ledger := writeLedger(t, testLedger)
+
+	code, out, _ := runCommand(t, "", "query", "-format", "csv", "-params", `{"account": "Expenses:Food"}`, ledger, "SELECT payee WHERE account = :account")
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	if out != "payee\nGrocer\nCafe\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	code, _, errOut := runCommand(t, "", "query", "-params", `["Expenses:Food", "extra"]`, ledger, "SELECT payee WHERE account = ?")
+	if code != 1 || !strings.Contains(errOut, "bind error [E_UNKNOWN_PARAMETER]") {
+		t.Errorf("expected an unknown parameter error, got %d: %q", code, errOut)
+	}
+
+	code, _, errOut = runCommand(t, "", "query", "-params", `{`, ledger, "SELECT payee")
+	if code != 2 || !strings.Contains(errOut, "E_INVALID_PARAMETERS") {
+		t.Errorf("expected an invalid parameters error, got %d: %q", code, errOut)
+	}
+}
+
+func TestQueryScript(t *testing.T) {
+	ledger := writeLedger(t, testLedger)
+
+	code, out, _ := runCommand(t, "", "query", "-format", "csv", ledger, "SELECT payee WHERE account = 'Expenses:Food'; SELECT COUNT(*)")
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	if out != "payee\nGrocer\nCafe\n\ncount(*)\n4\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	code, out, _ = runCommand(t, "", "query", "-format", "json", ledger, "SELECT payee; SELECT COUNT(*)")
+	if code != 0 || !strings.HasPrefix(out, `{"results":[`) {
+		t.Errorf("unexpected json output %d: %q", code, out)
+	}
+
+	code, _, errOut := runCommand(t, "", "query", ledger, "SELECT payee; SELECT AVG(amount)")
+	if code != 1 || !strings.Contains(errOut, "(statement 2)") {
+		t.Errorf("expected an error in statement 2, got %d: %q", code, errOut)
+	}
+}
+
+func TestQueryMarkdown(t *testing.T) {
+	ledger := writeLedger(t, testLedger)
+	code, out, _ := runCommand(t, "", "query", "-format", "markdown", ledger, "SELECT payee, amount WHERE account = 'Expenses:Food'")
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	want := "| payee | amount |\n| --- | ---: |\n| Grocer | 45.2 |\n| Cafe | 12 |\n"
+	if out != want {
+		t.Errorf("unexpected markdown:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	ledger := writeLedger(t, testLedger)
+	code, _, errOut := runCommand(t, "", "query", ledger, "SELECT account WHERE")
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(errOut, "parse error [E_SYNTAX]") || !strings.Contains(errOut, "^") {
+		t.Errorf("expected a syntax error with a snippet, got:\n%s", errOut)
+	}
+}
+
+func TestQueryLedgerErrors(t *testing.T) {
+	ledger := writeLedger(t, testLedger+"\n2024-01-10 * \"Cafe\" \"Dinner\"\n  Expenses:Food     20.00\n  Assets:Checking\n")
+	code, out, errOut := runCommand(t, "", "query", "-format", "csv", ledger, "SELECT payee WHERE account = 'Expenses:Food'")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr: %s", code, errOut)
+	}
+	if out != "payee\nGrocer\nCafe\n" {
+		t.Errorf("expected the valid transactions, got:\n%s", out)
+	}
+	if want := ledger + ":13:21: error: invalid posting syntax"; !strings.Contains(errOut, want) {
+		t.Errorf("expected %q on stderr, got:\n%s", want, errOut)
+	}
+}
+
+func TestQueryMissingLedger(t *testing.T) {
+	code, _, errOut := runCommand(t, "", "query", filepath.Join(t.TempDir(), "missing.beancount"), "SELECT account")
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(errOut, "ledger error") {
+		t.Errorf("expected a ledger error, got: %s", errOut)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	code, out, _ := runCommand(t, "", "check", writeLedger(t, testLedger))
+	if code != 0 || out != "" {
+		t.Errorf("valid ledger: exit code %d, output %q", code, out)
+	}
+
+	bad := writeLedger(t, "2024-01-01 open Assets:Checking USD\n2024-13-01 * \"Bad date\"\n")
+	code, out, _ = runCommand(t, "", "check", bad)
+	if code != 1 {
+		t.Errorf("invalid ledger: expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(out, "main.beancount:2:1: error: invalid date 2024-13-01 [E_INVALID_DATE]") {
+		t.Errorf("expected an invalid date on line 2, got: %q", out)
+	}
+
+	// Warnings are listed but leave the ledger valid.
+	unused := writeLedger(t, testLedger+"2024-01-01 open Assets:Savings USD\n")
+	code, out, _ = runCommand(t, "", "check", unused)
+	if code != 0 || !strings.Contains(out, ":11:17: warning: account Assets:Savings is opened but never used [W_UNUSED_ACCOUNT]") {
+		t.Errorf("expected an unused account warning, exit code %d, got: %q", code, out)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	ledger := writeLedger(t, "2024-01-05 *   \"Shop\"\n    Expenses:Food 5.00 USD ; snack\n    Assets:Cash  -5.00 USD\n")
+	want := "2024-01-05 * \"Shop\"\n  Expenses:Food       5.00 USD ; snack\n  Assets:Cash        -5.00 USD\n"
+
+	code, out, errOut := runCommand(t, "", "format", "-column", "28", ledger)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr: %s", code, errOut)
+	}
+	if out != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, out)
+	}
+
+	if code, out, _ := runCommand(t, "", "format", "-w", "-column", "28", ledger); code != 0 || out != "" {
+		t.Fatalf("format -w: exit code %d, output %q", code, out)
+	}
+	data, err := os.ReadFile(ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("expected the ledger to be rewritten, got:\n%s", data)
+	}
+
+	if code, _, _ := runCommand(t, "", "format", "-indent", "0", ledger); code != 2 {
+		t.Errorf("expected exit code 2 for an invalid indent, got %d", code)
+	}
+}
+
+func TestParse(t *testing.T) {
+	code, out, _ := runCommand(t, "", "parse", "SELECT", "account", "ORDER", "BY", "account", "DESC")
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	if !strings.Contains(out, `"ascending": false`) {
+		t.Errorf("expected a descending ORDER BY in the AST, got:\n%s", out)
+	}
+}
+
+func TestMCP(t *testing.T) {
+	ledger := writeLedger(t, testLedger)
+	input := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}
+{"jsonrpc":"2.0","method":"notifications/initialized"}
+{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"execute_bql","arguments":{"query":"SELECT COUNT(*)"}}}
+`
+	code, out, errOut := runCommand(t, input, "mcp", ledger)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr: %s", code, errOut)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 responses, got:\n%s", out)
+	}
+	if !strings.Contains(lines[0], `"protocolVersion":"2025-06-18"`) {
+		t.Errorf("unexpected initialize response: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"structuredContent":{"columns":["count(*)"],"rows":[[4]]}`) {
+		t.Errorf("unexpected tools/call response: %s", lines[1])
+	}
+}
+
+func TestLSP(t *testing.T) {
+	var input strings.Builder
+	for _, msg := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{}}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"untitled:1","languageId":"beancount","version":1,"text":"2024-01-01 * \"Shop\"\n"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	} {
+		fmt.Fprintf(&input, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	code, out, errOut := runCommand(t, input.String(), "lsp")
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr: %s", code, errOut)
+	}
+	for _, want := range []string{`"documentSymbolProvider":true`, `"code":"E_TXN_NO_POSTINGS"`, `"id":2,"result":null`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %s, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if code, _, _ := runCommand(t, ""); code != 2 {
+		t.Errorf("no arguments: expected exit code 2, got %d", code)
+	}
+	if code, _, _ := runCommand(t, "", "frobnicate"); code != 2 {
+		t.Errorf("unknown command: expected exit code 2, got %d", code)
+	}
+	if code, _, _ := runCommand(t, "", "query", "-format", "xml", "ledger", "SELECT account"); code != 2 {
+		t.Errorf("unknown format: expected exit code 2, got %d", code)
+	}
+}
+
+func TestShell(t *testing.T) {
+	ledger := writeLedger(t, "option \"title\" \"Household\"\noption \"operating_currency\" \"USD\"\n"+testLedger)
+	historyPath := filepath.Join(t.TempDir(), "history")
+	script := strings.Join([]string{
+		"SELECT payee WHERE account = 'Expenses:Food'",
+		".format csv",
+		"!1",
+		".history",
+		".stats",
+		".exit",
+	}, "\n")
+
+	code, out, errOut := runCommand(t, script, "query", "-history", historyPath, ledger)
+	if code != 0 {
+		t.Fatalf("exit code %d, stderr: %s", code, errOut)
+	}
+	for _, want := range []string{
+		"beanquery> ",
+		"payee\n------\nGrocer\nCafe\n",
+		"payee\nGrocer\nCafe\n",
+		"   1  SELECT payee WHERE account = 'Expenses:Food'\n",
+		"title:        Household\ntransactions: 2\n",
+		"operating:    USD\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("shell output missing %q:\n%s", want, out)
+		}
+	}
+
+	data, err := os.ReadFile(historyPath)
+	if err != nil {
+		t.Fatalf("history file not written: %v", err)
+	}
+	if string(data) != "SELECT payee WHERE account = 'Expenses:Food'\n" {
+		t.Errorf("unexpected history file: %q", data)
+	}
+
+	// A new shell picks up the saved history.
+	code, out, _ = runCommand(t, "!1\n", "query", "-history", historyPath, ledger)
+	if code != 0 || !strings.Contains(out, "Grocer") {
+		t.Errorf("expected !1 to recall the saved query, got exit %d:\n%s", code, out)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"bql-parser/engine"
+)
+
+// writeResults writes the results of a query or script in the given output
+// format. A single result is written as by engine.Render, several as by
+// engine.RenderScript. JSON is followed by a newline for reading in a
+// terminal.
+func writeResults(w io.Writer, results []*engine.Result, format engine.Format) error {
+	var out string
+	var err error
+	if len(results) == 1 {
+		out, err = engine.Render(results[0], format)
+	} else {
+		out, err = engine.RenderScript(results, format)
+	}
+	if err != nil {
+		return err
+	}
+	if format == engine.FormatJSON {
+		out += "\n"
+	}
+	_, err = fmt.Fprint(w, out)
+	return err
+}
+
+// writeDiagnostics writes ledger diagnostics one per line, as
+// file:line:column: severity: message [code], each followed by its related
+// locations.
+func writeDiagnostics(w io.Writer, diags []engine.SyntaxError) {
+	for _, e := range diags {
+		fmt.Fprintf(w, "%s:%d:%d: %s: %s [%s]\n", e.File, e.Line, e.Column, e.Severity, e.Message, e.Code)
+		for _, r := range e.Related {
+			fmt.Fprintf(w, "  %s:%d:%d: %s\n", r.File, r.Line, r.Column, r.Message)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"bql-parser/engine"
+)
+
+const shellHelp = `Enter a BQL query, or one of:
+  .help            show this help
+  .history         list previous queries
+  !N               re-run query N from the history (!! for the last one)
+  .format [FMT]    show or set the output format: text, csv, tsv,
+                   markdown, html or json
+  .accounts        list the accounts of the ledger
+  .stats           show ledger statistics
+  .check           check the ledger syntax
+  .exit, .quit     leave the shell
+`
+
+// shell is the interactive query loop started by "bean-query query LEDGER".
+type shell struct {
+	session     *engine.LedgerSession
+	in          *bufio.Scanner
+	out, errOut io.Writer
+	format      engine.Format
+	history     []string
+	historyPath string
+}
+
+func newShell(session *engine.LedgerSession, in io.Reader, out, errOut io.Writer, format engine.Format, historyPath string) *shell {
+	return &shell{
+		session:     session,
+		in:          bufio.NewScanner(in),
+		out:         out,
+		errOut:      errOut,
+		format:      format,
+		historyPath: historyPath,
+		history:     readHistory(historyPath),
+	}
+}
+
+// run reads commands until end of input or an exit command. It returns
+// the process exit code.
+func (sh *shell) run() int {
+	for {
+		fmt.Fprint(sh.out, "beanquery> ")
+		if !sh.in.Scan() {
+			fmt.Fprintln(sh.out)
+			break
+		}
+		line := strings.TrimSpace(sh.in.Text())
+		if line == "" {
+			continue
+		}
+		if line == ".exit" || line == ".quit" {
+			break
+		}
+		sh.execute(line)
+	}
+	if err := sh.in.Err(); err != nil {
+		fmt.Fprintf(sh.errOut, "bean-query: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func (sh *shell) execute(line string) {
+	switch {
+	case line == ".help":
+		fmt.Fprint(sh.out, shellHelp)
+	case line == ".history":
+		for i, q := range sh.history {
+			fmt.Fprintf(sh.out, "%4d  %s\n", i+1, q)
+		}
+	case strings.HasPrefix(line, "!"):
+		query, ok := sh.recall(line[1:])
+		if !ok {
+			fmt.Fprintf(sh.errOut, "no history entry %s\n", line)
+			return
+		}
+		fmt.Fprintln(sh.out, query)
+		sh.query(query)
+	case line == ".format" || strings.HasPrefix(line, ".format "):
+		sh.setFormat(strings.TrimSpace(strings.TrimPrefix(line, ".format")))
+	case line == ".accounts":
+		for _, a := range sh.session.Accounts() {
+			fmt.Fprintln(sh.out, a)
+		}
+	case line == ".stats":
+		sh.printStats()
+	case line == ".check":
+		result := sh.session.Check()
+		writeDiagnostics(sh.out, result.Errors)
+		if result.Valid {
+			fmt.Fprintln(sh.out, "ledger is valid")
+		}
+	case strings.HasPrefix(line, "."):
+		fmt.Fprintf(sh.errOut, "unknown command %s, try .help\n", line)
+	default:
+		sh.query(line)
+	}
+}
+
+// recall returns the history entry referenced by "!N" or "!!".
+func (sh *shell) recall(ref string) (string, bool) {
+	if ref == "!" {
+		if len(sh.history) == 0 {
+			return "", false
+		}
+		return sh.history[len(sh.history)-1], true
+	}
+	n, err := strconv.Atoi(ref)
+	if err != nil || n < 1 || n > len(sh.history) {
+		return "", false
+	}
+	return sh.history[n-1], true
+}
+
+func (sh *shell) query(query string) {
+	sh.remember(query)
+	results, errInfo := sh.session.QueryScript(query)
+	if errInfo != nil {
+		printError(sh.errOut, errInfo)
+		return
+	}
+	if err := writeResults(sh.out, results, sh.format); err != nil {
+		fmt.Fprintf(sh.errOut, "bean-query: %v\n", err)
+	}
+}
+
+func (sh *shell) setFormat(name string) {
+	if name == "" {
+		fmt.Fprintln(sh.out, sh.format)
+		return
+	}
+	format, err := engine.ParseFormat(name)
+	if err != nil {
+		fmt.Fprintln(sh.errOut, err)
+		return
+	}
+	sh.format = format
+}
+
+func (sh *shell) printStats() {
+	stats := sh.session.Stats()
+	opts := sh.session.Ledger.Options
+	if opts.Title != "" {
+		fmt.Fprintf(sh.out, "title:        %s\n", opts.Title)
+	}
+	fmt.Fprintf(sh.out, "transactions: %d\n", stats.Transactions)
+	fmt.Fprintf(sh.out, "postings:     %d\n", stats.Postings)
+	fmt.Fprintf(sh.out, "accounts:     %d\n", stats.Accounts)
+	fmt.Fprintf(sh.out, "currencies:   %s\n", strings.Join(stats.Currencies, ", "))
+	if len(opts.OperatingCurrency) > 0 {
+		fmt.Fprintf(sh.out, "operating:    %s\n", strings.Join(opts.OperatingCurrency, ", "))
+	}
+	if stats.FirstDate != "" {
+		fmt.Fprintf(sh.out, "dates:        %s to %s\n", stats.FirstDate, stats.LastDate)
+	}
+}
+
+// remember appends a query to the in-memory history and, if a history
+// file is configured, to the file. Failing to write the file is not fatal.
+func (sh *shell) remember(query string) {
+	if n := len(sh.history); n > 0 && sh.history[n-1] == query {
+		return
+	}
+	sh.history = append(sh.history, query)
+	if sh.historyPath == "" {
+		return
+	}
+	f, err := os.OpenFile(sh.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, query)
+}
+
+// readHistory returns the queries saved in a history file, one per line.
+func readHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var history []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			history = append(history, line)
+		}
+	}
+	return history
+}
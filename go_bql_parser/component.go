@@ -0,0 +1,313 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"bql-parser/engine"
+	"bql-parser/internal/wazbean/bql-parser/bql"
+	"bql-parser/internal/wazbean/bql-parser/types"
+
+	"go.bytecodealliance.org/cm"
+)
+
+func init() {
+	bql.Exports.ParseBqlToJSON = parseBQLExport
+	bql.Exports.ExecuteBql = executeBQLExport
+	bql.Exports.ExecuteBqlFormatted = executeBQLFormattedExport
+	bql.Exports.ExecuteBqlParams = executeBQLParamsExport
+	bql.Exports.ExecuteBqlScript = executeBQLScriptExport
+	bql.Exports.ExecuteBqlFiles = executeBQLFilesExport
+	bql.Exports.CheckBeancountSyntax = checkSyntaxExport
+	bql.Exports.CheckDuplicates = checkDuplicatesExport
+	bql.Exports.FormatBeancount = formatExport
+
+	bql.Exports.Ledger.Destructor = dropLedger
+	bql.Exports.Ledger.Query = ledgerQueryExport
+	bql.Exports.Ledger.QueryFormatted = ledgerQueryFormattedExport
+	bql.Exports.Ledger.QueryScript = ledgerQueryScriptExport
+	bql.Exports.Ledger.Check = ledgerCheckExport
+	bql.Exports.Ledger.Stats = ledgerStatsExport
+
+	bql.Exports.PreparedQuery.Destructor = dropPreparedQuery
+	bql.Exports.PreparedQuery.Params = preparedParamsExport
+	bql.Exports.PreparedQuery.Execute = preparedExecuteExport
+}
+
+// ledgers maps the representation of each live ledger resource to its
+// session. The constructor is wired in component_wasm.go, since creating a
+// resource handle needs a host import.
+var (
+	ledgers       = make(map[cm.Rep]*engine.LedgerSession)
+	nextLedgerRep cm.Rep
+)
+
+func registerLedger(s *engine.LedgerSession) cm.Rep {
+	nextLedgerRep++
+	ledgers[nextLedgerRep] = s
+	return nextLedgerRep
+}
+
+func dropLedger(self cm.Rep) {
+	delete(ledgers, self)
+}
+
+func ledgerQueryExport(self cm.Rep, query string) executeResult {
+	return toExecuteResult(ledgers[self].Query(query))
+}
+
+func ledgerQueryFormattedExport(self cm.Rep, query string, format bql.OutputFormat) stringResult {
+	return toStringResult(ledgers[self].QueryFormat(query, format.String()))
+}
+
+func ledgerQueryScriptExport(self cm.Rep, script string) scriptResult {
+	return toScriptResult(ledgers[self].QueryScript(script))
+}
+
+func ledgerCheckExport(self cm.Rep) cm.List[bql.SyntaxError] {
+	return toSyntaxErrors(ledgers[self].Check().Errors)
+}
+
+func ledgerStatsExport(self cm.Rep) bql.LedgerStats {
+	stats := ledgers[self].Stats()
+	return bql.LedgerStats{
+		Transactions: uint32(stats.Transactions),
+		Postings:     uint32(stats.Postings),
+		Accounts:     uint32(stats.Accounts),
+		Currencies:   cm.ToList(stats.Currencies),
+		FirstDate:    optionalString(stats.FirstDate),
+		LastDate:     optionalString(stats.LastDate),
+	}
+}
+
+// preparedQueries maps the representation of each live prepared-query
+// resource to its query. Like ledgers, the resources are created in
+// component_wasm.go.
+var (
+	preparedQueries = make(map[cm.Rep]*engine.PreparedQuery)
+	nextPreparedRep cm.Rep
+)
+
+func registerPreparedQuery(p *engine.PreparedQuery) cm.Rep {
+	nextPreparedRep++
+	preparedQueries[nextPreparedRep] = p
+	return nextPreparedRep
+}
+
+func dropPreparedQuery(self cm.Rep) {
+	delete(preparedQueries, self)
+}
+
+func preparedParamsExport(self cm.Rep) cm.List[string] {
+	return cm.ToList(preparedQueries[self].Params())
+}
+
+func preparedExecuteExport(self cm.Rep, params string) executeResult {
+	values, err := engine.ParseParams(params)
+	if err != nil {
+		return cm.Err[executeResult](toQueryError(engine.NewErrorInfo(engine.PhaseBind, err)))
+	}
+	return toExecuteResult(preparedQueries[self].Execute(values))
+}
+
+type (
+	stringResult  = cm.Result[bql.QueryErrorShape, string, bql.QueryError]
+	executeResult = cm.Result[bql.QueryErrorShape, bql.QueryResult, bql.QueryError]
+	scriptResult  = cm.Result[bql.QueryErrorShape, cm.List[bql.QueryResult], bql.QueryError]
+)
+
+func parseBQLExport(query string) stringResult {
+	ast, err := engine.Parse(query)
+	if err != nil {
+		return cm.Err[stringResult](toQueryError(engine.NewErrorInfo(engine.PhaseParse, err)))
+	}
+	jsonResult, err := json.Marshal(ast)
+	if err != nil {
+		return cm.Err[stringResult](toQueryError(engine.NewErrorInfo(engine.PhaseSerialize, err)))
+	}
+	return cm.OK[stringResult](string(jsonResult))
+}
+
+func executeBQLExport(query string, ledgerText string) executeResult {
+	return toExecuteResult(engine.RunQuery(query, ledgerText))
+}
+
+func executeBQLFormattedExport(query string, ledgerText string, format bql.OutputFormat) stringResult {
+	return toStringResult(engine.RenderQuery(query, ledgerText, format.String()))
+}
+
+func executeBQLParamsExport(query string, ledgerText string, params string) executeResult {
+	values, err := engine.ParseParams(params)
+	if err != nil {
+		return cm.Err[executeResult](toQueryError(engine.NewErrorInfo(engine.PhaseBind, err)))
+	}
+	return toExecuteResult(engine.RunQueryParams(query, ledgerText, values))
+}
+
+func executeBQLScriptExport(script string, ledgerText string) scriptResult {
+	return toScriptResult(engine.RunScript(script, ledgerText))
+}
+
+func executeBQLFilesExport(query string, files cm.List[types.SourceFile], entry string) executeResult {
+	return toExecuteResult(engine.RunQueryFiles(query, toMapSource(files), entry))
+}
+
+func toExecuteResult(result *engine.Result, errInfo *engine.ErrorInfo) executeResult {
+	if errInfo != nil {
+		return cm.Err[executeResult](toQueryError(errInfo))
+	}
+	return cm.OK[executeResult](toQueryResult(result))
+}
+
+func toScriptResult(results []*engine.Result, errInfo *engine.ErrorInfo) scriptResult {
+	if errInfo != nil {
+		return cm.Err[scriptResult](toQueryError(errInfo))
+	}
+	out := make([]bql.QueryResult, len(results))
+	for i, result := range results {
+		out[i] = toQueryResult(result)
+	}
+	return cm.OK[scriptResult](cm.ToList(out))
+}
+
+func toStringResult(out string, errInfo *engine.ErrorInfo) stringResult {
+	if errInfo != nil {
+		return cm.Err[stringResult](toQueryError(errInfo))
+	}
+	return cm.OK[stringResult](out)
+}
+
+// toMapSource converts a list of WIT source files to an in-memory source.
+func toMapSource(files cm.List[types.SourceFile]) engine.MapSource {
+	src := make(engine.MapSource)
+	for _, f := range files.Slice() {
+		src[f.Path] = f.Contents
+	}
+	return src
+}
+
+func checkSyntaxExport(ledgerText string) cm.List[bql.SyntaxError] {
+	return toSyntaxErrors(engine.CheckSyntax(ledgerText).Errors)
+}
+
+func checkDuplicatesExport(ledgerText string, options bql.DuplicateOptions) cm.List[bql.SyntaxError] {
+	return toSyntaxErrors(engine.CheckDuplicates(ledgerText, engine.DuplicateOptions{
+		Window:          int(options.WindowDays),
+		PayeeSimilarity: options.PayeeSimilarity,
+	}).Errors)
+}
+
+func formatExport(ledgerText string, options bql.FormatOptions) string {
+	return engine.FormatLedger(ledgerText, engine.FormatOptions{
+		CurrencyColumn: int(options.CurrencyColumn),
+		Indent:         int(options.Indent),
+	})
+}
+
+// toSyntaxErrors converts ledger diagnostics to a list of WIT records.
+func toSyntaxErrors(diags []engine.SyntaxError) cm.List[bql.SyntaxError] {
+	errs := make([]bql.SyntaxError, len(diags))
+	for i, e := range diags {
+		related := make([]types.RelatedLocation, len(e.Related))
+		for j, r := range e.Related {
+			related[j] = types.RelatedLocation{
+				File:      optionalString(r.File),
+				Line:      uint32(r.Line),
+				Column:    uint32(r.Column),
+				EndLine:   uint32(r.EndLine),
+				EndColumn: uint32(r.EndColumn),
+				Message:   r.Message,
+			}
+		}
+		errs[i] = bql.SyntaxError{
+			File:      optionalString(e.File),
+			Line:      uint32(e.Line),
+			Column:    uint32(e.Column),
+			EndLine:   uint32(e.EndLine),
+			EndColumn: uint32(e.EndColumn),
+			Severity:  toSeverity(e.Severity),
+			Code:      e.Code,
+			Message:   e.Message,
+			Related:   cm.ToList(related),
+		}
+	}
+	return cm.ToList(errs)
+}
+
+func toSeverity(s engine.Severity) types.Severity {
+	switch s {
+	case engine.SeverityWarning:
+		return types.SeverityWarning
+	case engine.SeverityInfo:
+		return types.SeverityInfo
+	default:
+		return types.SeverityError
+	}
+}
+
+// toQueryResult converts an executor result to its WIT record.
+func toQueryResult(result *engine.Result) bql.QueryResult {
+	rows := make([]cm.List[types.Cell], len(result.Rows))
+	for i, row := range result.Rows {
+		cells := make([]types.Cell, len(row))
+		for j, v := range row {
+			cells[j] = toCell(v)
+		}
+		rows[i] = cm.ToList(cells)
+	}
+	return bql.QueryResult{
+		Columns:      cm.ToList(result.Columns),
+		Rows:         cm.ToList(rows),
+		LedgerErrors: toSyntaxErrors(result.LedgerErrors),
+	}
+}
+
+// toCell converts a result value to a typed cell. Values other than strings
+// and numbers are rendered as text.
+func toCell(v interface{}) types.Cell {
+	switch val := v.(type) {
+	case nil:
+		return types.CellNull()
+	case string:
+		return types.CellText(val)
+	case float64:
+		return types.CellNumber(val)
+	case int:
+		return types.CellNumber(float64(val))
+	default:
+		return types.CellText(fmt.Sprint(val))
+	}
+}
+
+// toQueryError converts an envelope error to its WIT record.
+func toQueryError(info *engine.ErrorInfo) bql.QueryError {
+	return bql.QueryError{
+		Code:      info.Code,
+		Phase:     info.Phase,
+		Message:   info.Message,
+		File:      optionalString(info.File),
+		Line:      optionalUint(info.Line),
+		Column:    optionalUint(info.Column),
+		Hint:      optionalString(info.Hint),
+		Token:     optionalString(info.Token),
+		Expected:  cm.ToList(info.Expected),
+		Snippet:   optionalString(info.Snippet),
+		Statement: optionalUint(info.Statement),
+	}
+}
+
+func optionalUint(v int) cm.Option[uint32] {
+	if v <= 0 {
+		return cm.None[uint32]()
+	}
+	return cm.Some(uint32(v))
+}
+
+func optionalString(s string) cm.Option[string] {
+	if s == "" {
+		return cm.None[string]()
+	}
+	return cm.Some(s)
+}
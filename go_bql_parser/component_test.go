@@ -0,0 +1,309 @@
+//go:build !wasip1
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"bql-parser/engine"
+	"bql-parser/internal/wazbean/bql-parser/bql"
+	"bql-parser/internal/wazbean/bql-parser/types"
+)
+
+const testLedger = `
+2024-01-15 * "AcmeCo" "Salary deposit"
+  Assets:BofA:Checking    3000.00 USD
+  Income:Salary:AcmeCo   -3000.00 USD
+
+2024-01-20 * "Olive Garden" "Dinner with family"
+  Expenses:Food:Restaurant  72.15 USD
+  Liabilities:CreditCard:Visa
+
+2024-02-25 * "Landlord Properties LLC" "February rent"
+  Expenses:Rent           1500.00 USD
+  Assets:BofA:Checking   -1500.00 USD
+`
+
+func TestExecuteBQLExport(t *testing.T) {
+	res := executeBQLExport("SELECT account, amount WHERE account = 'Expenses:Rent'", testLedger)
+	if res.IsErr() {
+		t.Fatalf("unexpected error: %+v", *res.Err())
+	}
+	qr := res.OK()
+	if cols := qr.Columns.Slice(); len(cols) != 2 || cols[0] != "account" || cols[1] != "amount" {
+		t.Fatalf("unexpected columns: %v", cols)
+	}
+	rows := qr.Rows.Slice()
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+	cells := rows[0].Slice()
+	if text := cells[0].Text(); text == nil || *text != "Expenses:Rent" {
+		t.Errorf("expected text cell Expenses:Rent, got %v", cells[0])
+	}
+	if num := cells[1].Number(); num == nil || *num != 1500 {
+		t.Errorf("expected number cell 1500, got %v", cells[1])
+	}
+}
+
+func TestExecuteBQLExportNullCell(t *testing.T) {
+	res := executeBQLExport("SELECT amount WHERE account = 'Liabilities:CreditCard:Visa'", testLedger)
+	if res.IsErr() {
+		t.Fatalf("unexpected error: %+v", *res.Err())
+	}
+	rows := res.OK().Rows.Slice()
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+	if cell := rows[0].Slice()[0]; !cell.Null() {
+		t.Errorf("expected null cell for auto-balanced posting, got %v", cell)
+	}
+}
+
+func TestExecuteBQLExportLedgerErrors(t *testing.T) {
+	res := executeBQLExport("SELECT account WHERE account = 'Expenses:Rent'", testLedger+"\n2024-03-01 * \"Typo\"\n  Expenses:Rent  100\n  Assets:Cash\n")
+	if res.IsErr() {
+		t.Fatalf("unexpected error: %+v", *res.Err())
+	}
+	qr := res.OK()
+	if rows := qr.Rows.Slice(); len(rows) != 1 {
+		t.Errorf("expected the valid posting only, got %d rows", len(rows))
+	}
+	errs := qr.LedgerErrors.Slice()
+	if len(errs) != 1 || errs[0].Code != engine.CodeInvalidPosting || errs[0].Severity != types.SeverityError {
+		t.Errorf("unexpected ledger errors: %+v", errs)
+	}
+}
+
+func TestExecuteBQLExportError(t *testing.T) {
+	res := executeBQLExport("SELECT account WHERE", testLedger)
+	if !res.IsErr() {
+		t.Fatal("expected an error")
+	}
+	qe := res.Err()
+	if qe.Code != engine.CodeSyntax || qe.Phase != engine.PhaseParse {
+		t.Errorf("unexpected error: code=%s phase=%s", qe.Code, qe.Phase)
+	}
+	if line := qe.Line.Some(); line == nil || *line != 1 {
+		t.Errorf("expected line 1, got %v", qe.Line)
+	}
+	if expected := qe.Expected.Slice(); len(expected) != 1 || expected[0] != "identifier" {
+		t.Errorf("unexpected expected tokens: %v", expected)
+	}
+}
+
+func TestExecuteBQLFormattedExport(t *testing.T) {
+	res := executeBQLFormattedExport("SELECT account, amount WHERE account = 'Expenses:Rent'", testLedger, types.OutputFormatCsv)
+	if res.IsErr() {
+		t.Fatalf("unexpected error: %+v", *res.Err())
+	}
+	if got := *res.OK(); got != "account,amount\nExpenses:Rent,1500\n" {
+		t.Errorf("unexpected csv: %q", got)
+	}
+
+	rep := registerLedger(engine.NewLedgerSession(testLedger))
+	defer dropLedger(rep)
+	res = ledgerQueryFormattedExport(rep, "SELECT account WHERE", types.OutputFormatMarkdown)
+	if !res.IsErr() || res.Err().Code != engine.CodeSyntax {
+		t.Errorf("expected a syntax error, got %+v", res)
+	}
+}
+
+func TestParseBQLExport(t *testing.T) {
+	res := parseBQLExport("SELECT account")
+	if res.IsErr() {
+		t.Fatalf("unexpected error: %+v", *res.Err())
+	}
+	if got := *res.OK(); got != `{"select":[{"literal":"account"}],"where":{}}` {
+		t.Errorf("unexpected AST: %s", got)
+	}
+}
+
+func TestFormatExport(t *testing.T) {
+	got := formatExport("2024-01-05 *  \"Shop\"\n Expenses:Food 5.00 USD\n Assets:Cash\n", types.FormatOptions{CurrencyColumn: 28, Indent: 4})
+	if want := "2024-01-05 * \"Shop\"\n    Expenses:Food     5.00 USD\n    Assets:Cash\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestCheckSyntaxExport(t *testing.T) {
+	errs := checkSyntaxExport("2024-01-01 foobar something\n").Slice()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d", len(errs))
+	}
+	if errs[0].Line != 1 || errs[0].Message != "unknown directive: foobar" {
+		t.Errorf("unexpected error: %+v", errs[0])
+	}
+	if errs[0].Column != 12 || errs[0].EndColumn != 18 || errs[0].Code != engine.CodeUnknownDirective || errs[0].Severity != types.SeverityError {
+		t.Errorf("unexpected range, code or severity: %+v", errs[0])
+	}
+
+	errs = checkSyntaxExport("2024-01-01 open Assets:Cash\n2024-01-01 open Assets:Cash\n").Slice()
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %+v", errs)
+	}
+	dup := errs[1]
+	if dup.Code != engine.CodeDuplicateOpen || dup.Line != 2 || dup.Related.Len() != 1 || dup.Related.Slice()[0].Line != 1 {
+		t.Errorf("expected a duplicate open related to line 1, got %+v", dup)
+	}
+	if errs[0].Severity != types.SeverityWarning || errs[0].Code != engine.CodeUnusedAccount {
+		t.Errorf("expected an unused account warning, got %+v", errs[0])
+	}
+}
+
+func TestCheckDuplicatesExport(t *testing.T) {
+	text := `2024-01-05 * "ACME Corp" "Invoice"
+  Expenses:Office   12.00 USD
+  Assets:Bank
+2024-01-07 * "Acme" "Invoice 12"
+  Expenses:Office   12.00 USD
+  Assets:Bank      -12.00 USD
+`
+	errs := checkDuplicatesExport(text, types.DuplicateOptions{}).Slice()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 warning, got %+v", errs)
+	}
+	if w := errs[0]; w.Code != engine.CodePossibleDuplicate || w.Severity != types.SeverityWarning || w.Line != 4 || w.Related.Len() != 1 || w.Related.Slice()[0].Line != 1 {
+		t.Errorf("expected a duplicate warning at line 4 related to line 1, got %+v", w)
+	}
+	if errs := checkDuplicatesExport(text, types.DuplicateOptions{WindowDays: 1}).Slice(); len(errs) != 0 {
+		t.Errorf("expected no warnings within 1 day, got %+v", errs)
+	}
+}
+
+func TestLedgerResourceExports(t *testing.T) {
+	rep := registerLedger(engine.NewLedgerSession(testLedger))
+	defer dropLedger(rep)
+
+	res := ledgerQueryExport(rep, "SELECT account WHERE account = 'Expenses:Rent'")
+	if res.IsErr() {
+		t.Fatalf("unexpected error: %+v", *res.Err())
+	}
+	if rows := res.OK().Rows.Slice(); len(rows) != 1 {
+		t.Errorf("expected 1 row, got %d", len(rows))
+	}
+
+	stats := ledgerStatsExport(rep)
+	if stats.Transactions != 3 || stats.Postings != 6 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if first := stats.FirstDate.Some(); first == nil || *first != "2024-01-15" {
+		t.Errorf("unexpected first date: %v", stats.FirstDate)
+	}
+
+	if errs := ledgerCheckExport(rep).Slice(); len(errs) != 0 {
+		t.Errorf("expected no syntax errors, got %+v", errs)
+	}
+}
+
+func TestLedgerResourceDrop(t *testing.T) {
+	rep := registerLedger(engine.NewLedgerSession(testLedger))
+	other := registerLedger(engine.NewLedgerSession(testLedger))
+	if rep == other {
+		t.Fatal("expected distinct representations")
+	}
+	dropLedger(rep)
+	if _, ok := ledgers[rep]; ok {
+		t.Error("expected ledger to be removed")
+	}
+	if _, ok := ledgers[other]; !ok {
+		t.Error("expected other ledger to remain")
+	}
+	dropLedger(other)
+}
+
+func TestExecuteBQLParamsExport(t *testing.T) {
+	res := executeBQLParamsExport("SELECT date WHERE payee = :payee", testLedger, `{"payee": "Olive Garden"}`)
+	if res.IsErr() {
+		t.Fatalf("unexpected error: %+v", *res.Err())
+	}
+	if rows := res.OK().Rows.Slice(); len(rows) != 2 {
+		t.Errorf("expected 2 rows, got %d", len(rows))
+	}
+
+	res = executeBQLParamsExport("SELECT date WHERE payee = ?", testLedger, `{"payee": "Olive Garden"}`)
+	if !res.IsErr() {
+		t.Fatal("expected an error")
+	}
+	if e := res.Err(); e.Code != engine.CodeMissingParameter || e.Phase != engine.PhaseBind {
+		t.Errorf("unexpected error: %+v", *e)
+	}
+}
+
+func TestPreparedQueryExports(t *testing.T) {
+	session := engine.NewLedgerSession(testLedger)
+	p, errInfo := session.Prepare("SELECT account WHERE account = ?")
+	if errInfo != nil {
+		t.Fatalf("unexpected error: %+v", errInfo)
+	}
+	rep := registerPreparedQuery(p)
+	defer dropPreparedQuery(rep)
+
+	if params := preparedParamsExport(rep).Slice(); len(params) != 1 || params[0] != "1" {
+		t.Errorf("unexpected params: %v", params)
+	}
+	for _, account := range []string{"Expenses:Rent", "Assets:BofA:Checking"} {
+		res := preparedExecuteExport(rep, `["`+account+`"]`)
+		if res.IsErr() {
+			t.Fatalf("unexpected error: %+v", *res.Err())
+		}
+		if rows := res.OK().Rows.Slice(); len(rows) == 0 {
+			t.Errorf("expected rows for %s", account)
+		}
+	}
+
+	res := preparedExecuteExport(rep, `not json`)
+	if !res.IsErr() || res.Err().Code != engine.CodeInvalidParameters {
+		t.Errorf("expected an invalid parameters error, got %+v", res)
+	}
+}
+
+func TestExecuteBQLScriptExport(t *testing.T) {
+	res := executeBQLScriptExport("SELECT account WHERE account = 'Expenses:Rent'; SELECT COUNT(*)", testLedger)
+	if res.IsErr() {
+		t.Fatalf("unexpected error: %+v", *res.Err())
+	}
+	results := res.OK().Slice()
+	if len(results) != 2 || len(results[0].Rows.Slice()) != 1 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	res = executeBQLScriptExport("SELECT account; SELECT MAX(amount)", testLedger)
+	if !res.IsErr() {
+		t.Fatal("expected an error")
+	}
+	if s := res.Err().Statement.Some(); s == nil || *s != 2 {
+		t.Errorf("expected statement 2, got %v", res.Err().Statement)
+	}
+}
+
+// wiredForWasm lists the exports wired in component_wasm.go, since they
+// create resource handles, which needs a host import.
+var wiredForWasm = map[string]bool{
+	"Ledger.Constructor": true,
+	"Ledger.FromFiles":   true,
+	"Ledger.Open":        true,
+	"Ledger.Prepare":     true,
+}
+
+// TestExportsWired checks that every function of the bindings generated
+// from wit/world.wit is wired, so that a function added to the WIT
+// interface cannot ship without an implementation.
+func TestExportsWired(t *testing.T) {
+	var check func(prefix string, v reflect.Value)
+	check = func(prefix string, v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			name := prefix + v.Type().Field(i).Name
+			switch f := v.Field(i); f.Kind() {
+			case reflect.Struct:
+				check(name+".", f)
+			case reflect.Func:
+				if f.IsNil() != wiredForWasm[name] {
+					t.Errorf("export %s: wired %t, expected %t", name, !f.IsNil(), !wiredForWasm[name])
+				}
+			}
+		}
+	}
+	check("", reflect.ValueOf(bql.Exports))
+}
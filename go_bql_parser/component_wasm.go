@@ -0,0 +1,38 @@
+//go:build wasm && !wasip1
+
+package main
+
+import (
+	"bql-parser/engine"
+	"bql-parser/internal/wazbean/bql-parser/bql"
+	"bql-parser/internal/wazbean/bql-parser/types"
+
+	"go.bytecodealliance.org/cm"
+)
+
+func init() {
+	bql.Exports.Ledger.Constructor = func(ledgerText string) bql.Ledger {
+		return newLedgerResource(engine.NewLedgerSession(ledgerText))
+	}
+	bql.Exports.Ledger.FromFiles = func(files cm.List[types.SourceFile], entry string) bql.Ledger {
+		return newLedgerResource(engine.LoadLedgerSession(toMapSource(files), entry))
+	}
+	bql.Exports.Ledger.Open = func(path string) bql.Ledger {
+		return newLedgerResource(engine.LoadLedgerSession(engine.DiskSource{}, path))
+	}
+	bql.Exports.Ledger.Prepare = ledgerPrepareExport
+}
+
+func newLedgerResource(s *engine.LedgerSession) bql.Ledger {
+	return bql.LedgerResourceNew(registerLedger(s))
+}
+
+type prepareResult = cm.Result[bql.QueryErrorShape, bql.PreparedQuery, bql.QueryError]
+
+func ledgerPrepareExport(self cm.Rep, query string) prepareResult {
+	p, errInfo := ledgers[self].Prepare(query)
+	if errInfo != nil {
+		return cm.Err[prepareResult](toQueryError(errInfo))
+	}
+	return cm.OK[prepareResult](bql.PreparedQueryResourceNew(registerPreparedQuery(p)))
+}
@@ -0,0 +1,67 @@
+package engine
+
+import "strings"
+
+// analyze returns a copy of q with every identifier folded to lower case:
+// column references, function names and their arguments, the WHERE field,
+// and the GROUP BY, ORDER BY and PIVOT BY expressions. After analysis, the
+// executor compares names as they are, so matching is case insensitive
+// everywhere and output headers are canonical. String literals and
+// parameter names are kept as written, and subqueries are analysed in
+// turn. Analysing a query twice has no further effect.
+func analyze(q *Query) *Query {
+	if q == nil {
+		return nil
+	}
+	out := *q
+	out.Select = foldExprs(q.Select)
+	out.FromQuery = analyze(q.FromQuery)
+	out.WhereField = strings.ToLower(q.WhereField)
+	out.Where.Subquery = analyze(q.Where.Subquery)
+	out.GroupBy = foldExprs(q.GroupBy)
+	out.PivotBy = foldExprs(q.PivotBy)
+	if q.OrderBy != nil {
+		out.OrderBy = make([]OrderBy, len(q.OrderBy))
+		for i, ob := range q.OrderBy {
+			out.OrderBy[i] = OrderBy{Expression: foldExpr(ob.Expression), Ascending: ob.Ascending}
+		}
+	}
+	return &out
+}
+
+func foldExprs(exprs []Expression) []Expression {
+	if exprs == nil {
+		return nil
+	}
+	out := make([]Expression, len(exprs))
+	for i, e := range exprs {
+		out[i] = foldExpr(e)
+	}
+	return out
+}
+
+// foldExpr folds an expression in a select list, GROUP BY or ORDER BY,
+// where literals are column names.
+func foldExpr(e Expression) Expression {
+	return Expression{
+		Literal:  strings.ToLower(e.Literal),
+		Param:    e.Param,
+		FuncName: strings.ToLower(e.FuncName),
+		FuncArgs: foldExprs(e.FuncArgs),
+	}
+}
+
+// exprName returns the name of an analysed expression: its column name,
+// or the function call as written in canonical form, as in "sum(amount)".
+// It is the column header of the expression and the key ORDER BY matches
+// columns on.
+func exprName(e Expression) string {
+	if e.FuncName == "" {
+		return e.Literal
+	}
+	args := make([]string, len(e.FuncArgs))
+	for i, a := range e.FuncArgs {
+		args[i] = exprName(a)
+	}
+	return e.FuncName + "(" + strings.Join(args, ", ") + ")"
+}
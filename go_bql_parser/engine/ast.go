@@ -0,0 +1,32 @@
+package engine
+
+// Query is a SELECT statement, or a PRINT statement when Print is set. A
+// PRINT statement only has a FROM prefix and a WHERE predicate.
+type Query struct {
+	Print      bool         `json:"print,omitempty"`
+	Select     []Expression `json:"select"`
+	From       string       `json:"from,omitempty"`
+	FromParam  string       `json:"from_param,omitempty"`
+	FromQuery  *Query       `json:"from_query,omitempty"`
+	Where      Expression   `json:"where"`
+	WhereField string       `json:"where_field,omitempty"`
+	GroupBy    []Expression `json:"group_by,omitempty"`
+	OrderBy    []OrderBy    `json:"order_by,omitempty"`
+	PivotBy    []Expression `json:"pivot_by,omitempty"`
+}
+
+// Expression is a field name or string literal, a function call, or a
+// query parameter. Param is the name of a :name parameter, or the 1-based
+// position of a ? parameter. Subquery is the query of an IN predicate.
+type Expression struct {
+	Literal  string       `json:"literal,omitempty"`
+	Param    string       `json:"param,omitempty"`
+	FuncName string       `json:"func_name,omitempty"`
+	FuncArgs []Expression `json:"func_args,omitempty"`
+	Subquery *Query       `json:"subquery,omitempty"`
+}
+
+type OrderBy struct {
+	Expression Expression `json:"expression"`
+	Ascending  bool       `json:"ascending"`
+}
\ No newline at end of file
@@ -1,5 +1,5 @@
 %{
-package main
+package engine
 
 %}
 
@@ -17,18 +17,23 @@ package main
 }
 
 // Token declarations
-%token <str> SELECT FROM WHERE GROUP ORDER BY ASC DESC
-%token <str> IDENT STRING
+%token <str> SELECT FROM WHERE GROUP ORDER BY ASC DESC IN PIVOT PRINT
+%token <str> IDENT STRING NUMBER PARAM
 %token EQ
 
 // Type declarations for grammar rules
 %type <query>       query_statement
+%type <query>       select_statement
+%type <query>       print_statement
 %type <exprs>       select_list
 %type <expr>        select_expr
-%type <str>         from_clause_opt
+%type <expr>        from_clause_opt
+%type <expr>        print_from_opt
+%type <expr>        value
 %type <whereClause> where_clause_opt
 %type <exprs>       group_by_clause_opt
 %type <orderBys>    order_by_clause_opt
+%type <exprs>       pivot_by_clause_opt
 %type <orderBys>    order_by_list
 %type <orderBy>     order_by_expr
 %type <str>         opt_asc_desc
@@ -36,18 +41,65 @@ package main
 
 %%
 
+script:
+    statement_list opt_semicolon
+;
+
+// A script is one or more statements separated by semicolons, with an
+// optional semicolon after the last one.
+statement_list:
+    query_statement
+|   statement_list ';' query_statement
+;
+
+opt_semicolon:
+    /* empty */
+|   ';'
+;
+
 query_statement:
-    SELECT select_list from_clause_opt where_clause_opt group_by_clause_opt order_by_clause_opt
+    select_statement
+    {
+        l := yylex.(*BQLLexer)
+        l.results = append(l.results, $1)
+    }
+|   print_statement
+    {
+        l := yylex.(*BQLLexer)
+        l.results = append(l.results, $1)
+    }
+;
+
+// PRINT prints the transactions with a posting that matches the FROM
+// prefix and the WHERE predicate.
+print_statement:
+    PRINT print_from_opt where_clause_opt
+    {
+        $$ = &Query{
+            Print:      true,
+            Select:     []Expression{},
+            From:       $2.Literal,
+            FromParam:  $2.Param,
+            Where:      $3.expr,
+            WhereField: $3.field,
+        }
+    }
+;
+
+select_statement:
+    SELECT select_list from_clause_opt where_clause_opt group_by_clause_opt order_by_clause_opt pivot_by_clause_opt
     {
         $$ = &Query{
             Select:     $2,
-            From:       $3,
+            From:       $3.Literal,
+            FromParam:  $3.Param,
+            FromQuery:  $3.Subquery,
             Where:      $4.expr,
             WhereField: $4.field,
             GroupBy:    $5,
             OrderBy:    $6,
+            PivotBy:    $7,
         }
-        yylex.(*BQLLexer).result = $$
     }
 ;
 
@@ -78,8 +130,14 @@ select_expr:
 ;
 
 from_clause_opt:
-    /* empty */ { $$ = "" }
-|   FROM STRING  { $$ = $2 }
+    /* empty */ { $$ = Expression{} }
+|   FROM value  { $$ = $2 }
+|   FROM '(' select_statement ')' { $$ = Expression{Subquery: $3} }
+;
+
+print_from_opt:
+    /* empty */ { $$ = Expression{} }
+|   FROM value  { $$ = $2 }
 ;
 
 where_clause_opt:
@@ -88,11 +146,21 @@ where_clause_opt:
 ;
 
 where_expression:
-    IDENT EQ STRING
+    IDENT EQ value
     {
         $$.field = $1
-        $$.expr = Expression{Literal: $3}
+        $$.expr = $3
     }
+|   IDENT IN '(' select_statement ')'
+    {
+        $$.field = $1
+        $$.expr = Expression{Subquery: $4}
+    }
+;
+
+value:
+    STRING { $$ = Expression{Literal: $1} }
+|   PARAM  { $$ = Expression{Param: $1} }
 ;
 
 
@@ -124,6 +192,11 @@ order_by_expr:
     }
 ;
 
+pivot_by_clause_opt:
+    /* empty */          { $$ = nil }
+|   PIVOT BY select_list { $$ = $3 }
+;
+
 opt_asc_desc:
     /* empty */ { $$ = "ASC" }
 |   ASC         { $$ = "ASC" }
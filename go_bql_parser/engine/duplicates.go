@@ -0,0 +1,316 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DuplicateOptions controls how alike two transactions must be to be
+// reported as likely duplicates.
+type DuplicateOptions struct {
+	// Window is the number of days two duplicates may be apart, as when
+	// a bank books an imported transaction later than it was entered by
+	// hand. Zero means DefaultDuplicateWindow.
+	Window int
+	// PayeeSimilarity is the lowest similarity, from 0 to 1, of the payees
+	// of two duplicates, or of their narrations when either has no payee.
+	// Zero means DefaultPayeeSimilarity.
+	PayeeSimilarity float64
+
+	// tolerances are the options of the ledger the transactions were
+	// loaded from, whose inferred_tolerance_default applies to amounts
+	// without decimals. Nil means the default options.
+	tolerances *Options
+}
+
+// Defaults of DuplicateOptions.
+const (
+	DefaultDuplicateWindow = 3
+	DefaultPayeeSimilarity = 0.5
+)
+
+// Duplicate is a pair of transactions that are likely the same. Original
+// comes first in the ledger, or is the existing transaction a new one
+// duplicates.
+type Duplicate struct {
+	Original   *Transaction `json:"original"`
+	Duplicate  *Transaction `json:"duplicate"`
+	Similarity float64      `json:"similarity"`
+}
+
+// FindDuplicates returns the likely duplicates among txns: pairs of
+// transactions within the window of days of each other, with postings to
+// the same accounts, the same amounts and similar payees. Amounts are the
+// same when they differ by at most half their last decimal. An amount left
+// out of a posting matches any amount, so a transaction entered by hand
+// with an auto-balanced posting matches its imported copy. Each
+// transaction is reported at most once, as the duplicate of the first
+// earlier one it matches.
+func FindDuplicates(txns []Transaction, opts DuplicateOptions) []Duplicate {
+	return toDuplicates(txns, txns, duplicatePairs(txns, txns, opts, true))
+}
+
+// MatchDuplicates returns the transactions of candidates, such as the
+// output of an importer, that likely duplicate a transaction of existing,
+// each with the first existing transaction it matches. Candidates are not
+// compared with each other.
+func MatchDuplicates(existing, candidates []Transaction, opts DuplicateOptions) []Duplicate {
+	return toDuplicates(existing, candidates, duplicatePairs(existing, candidates, opts, false))
+}
+
+// duplicatePair is the index of an original and of its duplicate.
+type duplicatePair struct {
+	original, duplicate int
+	similarity          float64
+}
+
+func toDuplicates(existing, candidates []Transaction, pairs []duplicatePair) []Duplicate {
+	var dups []Duplicate
+	for _, p := range pairs {
+		dups = append(dups, Duplicate{Original: &existing[p.original], Duplicate: &candidates[p.duplicate], Similarity: p.similarity})
+	}
+	return dups
+}
+
+// duplicatePairs pairs each transaction of candidates with the first
+// transaction of existing it duplicates. When same is set the two slices
+// are one, and a transaction is only compared with those before it.
+func duplicatePairs(existing, candidates []Transaction, opts DuplicateOptions, same bool) []duplicatePair {
+	if opts.Window <= 0 {
+		opts.Window = DefaultDuplicateWindow
+	}
+	if opts.PayeeSimilarity <= 0 {
+		opts.PayeeSimilarity = DefaultPayeeSimilarity
+	}
+	if opts.tolerances == nil {
+		defaults := DefaultOptions()
+		opts.tolerances = &defaults
+	}
+
+	// Only transactions with the same accounts can match, so index the
+	// existing ones by their accounts, each bucket sorted by date so that
+	// a candidate is only compared with those within the window.
+	byAccounts := make(map[string][]datedIndex)
+	for i := range existing {
+		if day, ok := dayNumber(existing[i].Date); ok {
+			key := accountsKey(&existing[i])
+			byAccounts[key] = append(byAccounts[key], datedIndex{day: day, index: i})
+		}
+	}
+	for _, bucket := range byAccounts {
+		sort.Slice(bucket, func(a, b int) bool {
+			if bucket[a].day != bucket[b].day {
+				return bucket[a].day < bucket[b].day
+			}
+			return bucket[a].index < bucket[b].index
+		})
+	}
+
+	var pairs []duplicatePair
+	for j := range candidates {
+		c := &candidates[j]
+		day, ok := dayNumber(c.Date)
+		if !ok {
+			continue
+		}
+		bucket := byAccounts[accountsKey(c)]
+		first := sort.Search(len(bucket), func(k int) bool { return bucket[k].day >= day-opts.Window })
+		match := duplicatePair{original: -1}
+		for _, d := range bucket[first:] {
+			if d.day > day+opts.Window {
+				break
+			}
+			i := d.index
+			if (same && i >= j) || (match.original >= 0 && i > match.original) {
+				continue
+			}
+			o := &existing[i]
+			if !sameAmounts(o, c, opts.tolerances) {
+				continue
+			}
+			if s := payeeSimilarity(o, c); s >= opts.PayeeSimilarity {
+				match = duplicatePair{original: i, duplicate: j, similarity: s}
+			}
+		}
+		if match.original >= 0 {
+			pairs = append(pairs, match)
+		}
+	}
+	return pairs
+}
+
+// datedIndex is the index of a transaction and its date as a day number.
+type datedIndex struct {
+	day, index int
+}
+
+// accountsKey returns the sorted accounts of the postings of txn.
+func accountsKey(txn *Transaction) string {
+	accounts := make([]string, len(txn.Postings))
+	for i, p := range txn.Postings {
+		accounts[i] = p.Account
+	}
+	sort.Strings(accounts)
+	return strings.Join(accounts, "\n")
+}
+
+// dayNumber returns the number of days from the Unix epoch to a date.
+// Malformed dates have none, and so are never within days of another.
+func dayNumber(date string) (int, bool) {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return 0, false
+	}
+	return int(t.Unix() / 86400), true
+}
+
+// sameAmounts reports whether the postings of two transactions with the
+// same accounts have the same amounts, within the larger tolerance of the
+// two. A posting without an amount matches any posting to its account,
+// and at least one amount must be compared.
+func sameAmounts(a, b *Transaction, opts *Options) bool {
+	used := make([]bool, len(b.Postings))
+	compared := false
+	for _, p := range a.Postings {
+		found := false
+		for k, q := range b.Postings {
+			if used[k] || q.Account != p.Account {
+				continue
+			}
+			if p.HasAmount && q.HasAmount {
+				tolerance := max(amountTolerance(p, opts), amountTolerance(q, opts))
+				if q.Currency != p.Currency || math.Abs(q.Amount-p.Amount) > tolerance+1e-9 {
+					continue
+				}
+				compared = true
+			}
+			used[k], found = true, true
+			break
+		}
+		if !found {
+			return false
+		}
+	}
+	return compared
+}
+
+// amountTolerance returns the tolerance of the amount of a posting: half
+// its last decimal as written, or the inferred_tolerance_default of its
+// currency when it has no decimals.
+func amountTolerance(p Posting, opts *Options) float64 {
+	_, decimals, ok := strings.Cut(p.number, ".")
+	if !ok || decimals == "" {
+		return opts.Tolerance(p.Currency)
+	}
+	return 0.5 * math.Pow(10, -float64(len(decimals)))
+}
+
+// payeeSimilarity returns how alike the payees of two transactions are,
+// or their narrations when either has no payee: 1 when one contains the
+// other once case, spaces and punctuation are ignored, and otherwise the
+// share of letter pairs they have in common. Text with no letters or
+// digits is like nothing, not contained in everything.
+func payeeSimilarity(a, b *Transaction) float64 {
+	x, y := a.Payee, b.Payee
+	if x == "" || y == "" {
+		x, y = a.Narration, b.Narration
+	}
+	x, y = normalizePayee(x), normalizePayee(y)
+	if x == "" || y == "" {
+		return 0
+	}
+	if strings.Contains(x, y) || strings.Contains(y, x) {
+		return 1
+	}
+	return diceCoefficient(x, y)
+}
+
+// normalizePayee returns the letters and digits of s in lower case.
+func normalizePayee(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// diceCoefficient returns the Sørensen–Dice coefficient of the character
+// bigrams of two strings: twice the number of bigrams they share over the
+// total number of bigrams.
+func diceCoefficient(x, y string) float64 {
+	bigrams := func(s string) map[string]int {
+		m := make(map[string]int)
+		r := []rune(s)
+		for i := 0; i+1 < len(r); i++ {
+			m[string(r[i:i+2])]++
+		}
+		return m
+	}
+	bx, by := bigrams(x), bigrams(y)
+	total, shared := 0, 0
+	for _, n := range bx {
+		total += n
+	}
+	for g, n := range by {
+		total += n
+		shared += min(n, bx[g])
+	}
+	if total == 0 {
+		return 0
+	}
+	return 2 * float64(shared) / float64(total)
+}
+
+// CheckDuplicates parses a Beancount ledger and reports its likely
+// duplicate transactions, as found by FindDuplicates, as warnings at the
+// duplicates, related to their originals.
+func CheckDuplicates(text string, opts DuplicateOptions) *SyntaxResult {
+	ledger := buildLedger(ParseBeancount("", text))
+	opts.tolerances = &ledger.Options
+	result := &SyntaxResult{Valid: true, Errors: checkDuplicates(ledger.Entries, opts)}
+	if result.Errors == nil {
+		result.Errors = []SyntaxError{}
+	}
+	return result
+}
+
+// checkDuplicates returns warnings for the likely duplicate transactions
+// among entries.
+func checkDuplicates(entries []Entry, opts DuplicateOptions) []SyntaxError {
+	var txns []Transaction
+	var txnEntries []Entry
+	for _, e := range entries {
+		if e.Kind == "transaction" {
+			txns = append(txns, buildTransaction(e.File, e.Directive))
+			txnEntries = append(txnEntries, e)
+		}
+	}
+	var diags []SyntaxError
+	for _, p := range duplicatePairs(txns, txns, opts, true) {
+		orig, dup := txnEntries[p.original], txnEntries[p.duplicate]
+		diags = append(diags, SyntaxError{
+			File:     dup.File,
+			Span:     headerSpan(dup.Directive),
+			Severity: SeverityWarning,
+			Code:     CodePossibleDuplicate,
+			Message:  fmt.Sprintf("possible duplicate of the transaction of %s %q", orig.Date, transactionName(&txns[p.original])),
+			Related:  []RelatedLocation{{File: orig.File, Span: headerSpan(orig.Directive), Message: "possible original here"}},
+		})
+	}
+	return diags
+}
+
+// transactionName returns the payee of txn, or its narration when it has
+// none.
+func transactionName(txn *Transaction) string {
+	if txn.Payee != "" {
+		return txn.Payee
+	}
+	return txn.Narration
+}
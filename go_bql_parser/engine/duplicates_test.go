@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	ledger := ParseLedger(`2024-01-05 * "ACME Corp." "Invoice 12"
+  Expenses:Office   12.00 USD
+  Assets:Bank
+2024-01-06 * "Grocer" "Weekly shop"
+  Expenses:Food   30.00 USD
+  Assets:Bank
+2024-01-07 * "Acme" "Invoice"
+  Expenses:Office   12.00 USD
+  Assets:Bank      -12.00 USD
+2024-01-07 * "Grocer" "Weekly shop"
+  Expenses:Food   31.00 USD
+  Assets:Bank
+2024-01-20 * "ACME Corp." "Invoice 13"
+  Expenses:Office   12.00 USD
+  Assets:Bank
+2024-01-21 * "Acme Bakery" "Bread"
+  Expenses:Office   12.00 USD
+  Assets:Bank
+`)
+	dups := FindDuplicates(ledger.Transactions, DuplicateOptions{})
+	if len(dups) != 1 {
+		t.Fatalf("expected 1 duplicate, got %+v", dups)
+	}
+	if d := dups[0]; d.Original.Line != 1 || d.Duplicate.Line != 7 || d.Similarity != 1 {
+		t.Errorf("expected line 7 to duplicate line 1, got %d and %d at %v", d.Duplicate.Line, d.Original.Line, d.Similarity)
+	}
+
+	// A wider window finds the later invoice too, and the bakery, whose
+	// payee contains Acme. A lower similarity finds the bakery as a
+	// duplicate of the later invoice.
+	dups = FindDuplicates(ledger.Transactions, DuplicateOptions{Window: 15})
+	if len(dups) != 3 || dups[1].Duplicate.Line != 13 || dups[1].Original.Line != 1 || dups[2].Duplicate.Line != 16 || dups[2].Original.Line != 7 {
+		t.Errorf("expected lines 13 and 16 to duplicate lines 1 and 7, got %+v", dups)
+	}
+	if dups := FindDuplicates(ledger.Transactions, DuplicateOptions{PayeeSimilarity: 0.01}); len(dups) != 2 || dups[1].Duplicate.Line != 16 {
+		t.Errorf("expected line 16 to duplicate line 13, got %+v", dups)
+	}
+}
+
+func TestMatchDuplicates(t *testing.T) {
+	existing := ParseLedger(`2024-03-01 * "Landlord" "Rent"
+  Expenses:Rent   900 EUR
+  Assets:Bank
+`).Transactions
+	imported := ParseLedger(`2024-03-02 * "LANDLORD LTD" "SEPA transfer"
+  Assets:Bank   -900.00 EUR
+  Expenses:Rent   900.00 EUR
+2024-03-02 * "LANDLORD LTD" "SEPA transfer"
+  Assets:Bank   -900.00 EUR
+  Expenses:Rent   900.00 EUR
+2024-03-03 * "Cafe"
+  Assets:Bank   -4.00 EUR
+  Expenses:Food   4.00 EUR
+`).Transactions
+	dups := MatchDuplicates(existing, imported, DuplicateOptions{})
+	if len(dups) != 2 {
+		t.Fatalf("expected both transfers to match the rent, got %+v", dups)
+	}
+	for i, d := range dups {
+		if d.Original != &existing[0] || d.Duplicate != &imported[i] {
+			t.Errorf("unexpected match %d: %+v", i, d)
+		}
+	}
+}
+
+// TestDuplicateTolerance checks that amounts match within their precision,
+// and amounts without decimals within inferred_tolerance_default.
+func TestDuplicateTolerance(t *testing.T) {
+	text := `2024-01-05 * "Cafe"
+  Expenses:Food   3.00 USD
+  Assets:Cash
+2024-01-05 * "Cafe"
+  Expenses:Food   3.004 USD
+  Assets:Cash
+2024-01-05 * "Sushi"
+  Expenses:Food   1000 JPY
+  Assets:Cash
+2024-01-05 * "Sushi"
+  Expenses:Food   1001 JPY
+  Assets:Cash
+`
+	if result := CheckDuplicates(text, DuplicateOptions{}); len(result.Errors) != 1 || result.Errors[0].Span.Line != 4 {
+		t.Errorf("expected only the second cafe, got\n%s", formatDiagnostics(result.Errors))
+	}
+	result := CheckSyntax("option \"inferred_tolerance_default\" \"JPY:1\"\n" + text)
+	if len(result.Errors) != 2 || result.Errors[1].Span.Line != 11 {
+		t.Errorf("expected the second sushi too, got\n%s", formatDiagnostics(result.Errors))
+	}
+}
+
+func TestCheckDuplicates(t *testing.T) {
+	text := `2024-01-05 * "ACME Corp." "Invoice 12"
+  Expenses:Office   12.00 USD
+  Assets:Bank
+2024-01-07 * "Acme" "Invoice"
+  Expenses:Office   12.00 USD
+  Assets:Bank
+2024-01-07 * "Acme" "Invoice"
+  Expenses:Office   12.00 USD
+  Assets:Bank
+`
+	want := []SyntaxError{
+		{
+			Span: Span{Line: 4, Column: 1, EndLine: 4, EndColumn: 11}, Severity: SeverityWarning, Code: CodePossibleDuplicate, Message: `possible duplicate of the transaction of 2024-01-05 "ACME Corp."`,
+			Related: []RelatedLocation{{Span: Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 11}, Message: "possible original here"}},
+		},
+		{
+			Span: Span{Line: 7, Column: 1, EndLine: 7, EndColumn: 11}, Severity: SeverityWarning, Code: CodePossibleDuplicate, Message: `possible duplicate of the transaction of 2024-01-05 "ACME Corp."`,
+			Related: []RelatedLocation{{Span: Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 11}, Message: "possible original here"}},
+		},
+	}
+	result := CheckDuplicates(text, DuplicateOptions{})
+	if got, want := formatDiagnostics(result.Errors), formatDiagnostics(want); got != want || !result.Valid {
+		t.Errorf("unexpected diagnostics:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The checker reports them too, except where noduplicates reports an
+	// exact duplicate.
+	if got, want := formatDiagnostics(CheckSyntax(text).Errors), formatDiagnostics(want); got != want {
+		t.Errorf("unexpected diagnostics:\n%s\nwant:\n%s", got, want)
+	}
+	result = CheckSyntax("plugin \"beancount.plugins.noduplicates\"\n" + text)
+	if len(result.Errors) != 2 || result.Errors[0].Code != CodePossibleDuplicate || result.Errors[1].Code != CodeDuplicateTransaction {
+		t.Errorf("expected a likely and an exact duplicate, got\n%s", formatDiagnostics(result.Errors))
+	}
+
+	if result := CheckDuplicates(strings.ReplaceAll(text, "Acme", "Bakery"), DuplicateOptions{}); len(result.Errors) != 1 || result.Errors[0].Span.Line != 7 {
+		t.Errorf("expected only the repeated bakery, got\n%s", formatDiagnostics(result.Errors))
+	}
+
+	// A narration of punctuation only is not contained in every other one.
+	empty := `2024-01-05 * "Coffee"
+  Expenses:Food   3.00 USD
+  Assets:Cash
+2024-01-05 * "--"
+  Expenses:Food   3.00 USD
+  Assets:Cash
+2024-01-05 * ""
+  Expenses:Food   3.00 USD
+  Assets:Cash
+`
+	if result := CheckDuplicates(empty, DuplicateOptions{}); len(result.Errors) != 0 {
+		t.Errorf("expected no duplicates, got\n%s", formatDiagnostics(result.Errors))
+	}
+}
+
+// largeLedger returns a ledger of n transactions between the same two
+// accounts, a few a day and no two alike, so that every one of them is a
+// candidate for the others of its window.
+func largeLedger(n int) string {
+	var b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&b, "%s * \"Shop %d\" \"Groceries\"\n  Expenses:Food   %d.%02d USD\n  Assets:Cash\n",
+			time.Date(2000, 1, 1+i/4, 0, 0, 0, 0, time.UTC).Format("2006-01-02"), i, i, i%100)
+	}
+	return b.String()
+}
+
+// TestCheckDuplicatesLargeLedger checks that a transaction is only compared
+// with those within the window, not with every earlier one.
+func TestCheckDuplicatesLargeLedger(t *testing.T) {
+	text := largeLedger(20000)
+	text += `2013-09-09 * "Shop 19990" "Groceries"
+  Expenses:Food   19990.90 USD
+  Assets:Cash
+`
+	start := time.Now()
+	result := CheckSyntax(text)
+	if len(result.Errors) != 1 || result.Errors[0].Code != CodePossibleDuplicate || result.Errors[0].Span.Line != 60001 {
+		t.Errorf("expected the last transaction to duplicate one of the day before, got\n%s", formatDiagnostics(result.Errors))
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("checking 20000 transactions took %v", elapsed)
+	}
+}
+
+func BenchmarkCheckSyntaxLargeLedger(b *testing.B) {
+	text := largeLedger(20000)
+	b.SetBytes(int64(len(text)))
+	for b.Loop() {
+		CheckSyntax(text)
+	}
+}
@@ -0,0 +1,116 @@
+// Package engine implements the Beancount Query Language parser, the
+// Beancount ledger loader and syntax checker, and the query executor. It is
+// shared by the WASM component and the native command-line tool.
+package engine
+
+import (
+	"encoding/json"
+)
+
+// Parse parses a single BQL statement, optionally followed by a semicolon.
+// Use ParseScript for several statements.
+func Parse(query string) (*Query, error) {
+	lexer := NewBQLLexer(query)
+	if yyParse(lexer) != 0 || lexer.err != nil {
+		return nil, newParseError(query, lexer)
+	}
+	if len(lexer.results) > 1 {
+		return nil, extraStatementError(query, lexer)
+	}
+	return lexer.results[0], nil
+}
+
+func ParseBQLToJSON(query string) string {
+	ast, err := Parse(query)
+	if err != nil {
+		return errorJSON(PhaseParse, err)
+	}
+
+	jsonResult, err := json.Marshal(ast)
+	if err != nil {
+		return errorJSON(PhaseSerialize, err)
+	}
+
+	return string(jsonResult)
+}
+
+func ExecuteBQL(query string, ledgerText string) string {
+	return resultJSON(RunQuery(query, ledgerText))
+}
+
+// ExecuteBQLParams executes a query with parameters. paramsJSON is a JSON
+// object of values by parameter name or position, or an array of values
+// for ? parameters.
+func ExecuteBQLParams(query string, ledgerText string, paramsJSON string) string {
+	params, err := ParseParams(paramsJSON)
+	if err != nil {
+		return errorJSON(PhaseBind, err)
+	}
+	return resultJSON(RunQueryParams(query, ledgerText, params))
+}
+
+// ExecuteBQLFiles executes a query against a multi-file ledger given as a
+// map of path to file contents, starting at the entry file.
+func ExecuteBQLFiles(query string, files map[string]string, entry string) string {
+	return resultJSON(RunQueryFiles(query, MapSource(files), entry))
+}
+
+// RunQuery parses query and ledgerText and runs the query. Failures are
+// reported as an envelope error tagged with the phase that failed.
+func RunQuery(query string, ledgerText string) (*Result, *ErrorInfo) {
+	return RunQueryParams(query, ledgerText, nil)
+}
+
+// RunQueryParams is like RunQuery for a query with parameters, which are
+// bound to params before the query runs.
+func RunQueryParams(query string, ledgerText string, params Params) (*Result, *ErrorInfo) {
+	return executeQuery(query, params, func() (*Ledger, error) {
+		return ParseLedger(ledgerText), nil
+	})
+}
+
+// RunQueryFiles is like RunQuery for a multi-file ledger read from src,
+// starting at the entry file.
+func RunQueryFiles(query string, src FileSource, entry string) (*Result, *ErrorInfo) {
+	return executeQuery(query, nil, func() (*Ledger, error) {
+		ledger, _, err := LoadLedger(src, entry)
+		return ledger, err
+	})
+}
+
+func resultJSON(result *Result, errInfo *ErrorInfo) string {
+	if errInfo != nil {
+		return envelopeJSON(errInfo)
+	}
+
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		return errorJSON(PhaseSerialize, err)
+	}
+
+	return string(jsonResult)
+}
+
+// executeQuery parses query, binds params, loads the ledger and runs the
+// query. The ledger is only loaded once the query has parsed and bound.
+func executeQuery(query string, params Params, load func() (*Ledger, error)) (*Result, *ErrorInfo) {
+	ast, err := Parse(query)
+	if err != nil {
+		return nil, NewErrorInfo(PhaseParse, err)
+	}
+	ast, err = Bind(ast, params)
+	if err != nil {
+		return nil, NewErrorInfo(PhaseBind, err)
+	}
+
+	ledger, err := load()
+	if err != nil {
+		return nil, NewErrorInfo(PhaseLedger, err)
+	}
+
+	result, err := Execute(ast, ledger)
+	if err != nil {
+		return nil, NewErrorInfo(PhaseExecute, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,307 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Phases reported in the error envelope, naming the step that failed.
+const (
+	PhaseParse     = "parse"
+	PhaseBind      = "bind"
+	PhaseLedger    = "ledger"
+	PhaseExecute   = "execute"
+	PhaseSerialize = "serialize"
+)
+
+// Stable error codes reported in the error envelope.
+const (
+	CodeSyntax          = "E_SYNTAX"
+	CodeUnclosedString  = "E_UNCLOSED_STRING"
+	CodeUnclosedComment = "E_UNCLOSED_COMMENT"
+	CodeLedger          = "E_LEDGER"
+	CodeInvalidAmount   = "E_INVALID_AMOUNT"
+	CodeIncludeNotFound = "E_INCLUDE_NOT_FOUND"
+	CodeIncludeCycle    = "E_INCLUDE_CYCLE"
+	CodeExecution       = "E_EXECUTION"
+	CodeUnknownFunction = "E_UNKNOWN_FUNCTION"
+	CodeArgumentCount   = "E_ARGUMENT_COUNT"
+	CodeSubquery        = "E_SUBQUERY"
+	CodePivot           = "E_PIVOT"
+	CodeSerialization   = "E_SERIALIZATION"
+	CodeUnknownFormat   = "E_UNKNOWN_FORMAT"
+
+	CodeInvalidParameters = "E_INVALID_PARAMETERS"
+	CodeMissingParameter  = "E_MISSING_PARAMETER"
+	CodeUnknownParameter  = "E_UNKNOWN_PARAMETER"
+	CodeParameterType     = "E_PARAMETER_TYPE"
+)
+
+// ErrorInfo is the error object returned by every export, wrapped as
+// {"error": {...}}. File, Line, Column and Hint are set when known; Token,
+// Expected and Snippet are only set for BQL syntax errors, and Statement
+// only for bind and execute errors of a script.
+type ErrorInfo struct {
+	Code      string   `json:"code"`
+	Phase     string   `json:"phase"`
+	Message   string   `json:"message"`
+	File      string   `json:"file,omitempty"`
+	Line      int      `json:"line,omitempty"`
+	Column    int      `json:"column,omitempty"`
+	Hint      string   `json:"hint,omitempty"`
+	Token     string   `json:"token,omitempty"`
+	Expected  []string `json:"expected,omitempty"`
+	Snippet   string   `json:"snippet,omitempty"`
+	Statement int      `json:"statement,omitempty"`
+}
+
+type errorEnvelope struct {
+	Error *ErrorInfo `json:"error"`
+}
+
+// NewErrorInfo builds the envelope error for err raised during phase.
+func NewErrorInfo(phase string, err error) *ErrorInfo {
+	info := &ErrorInfo{Phase: phase, Message: err.Error()}
+	switch e := err.(type) {
+	case *ParseError:
+		info.Code = e.Code
+		info.Message = e.Message
+		info.Line = e.Line
+		info.Column = e.Column
+		info.Token = e.Token
+		info.Expected = e.Expected
+		info.Snippet = e.Snippet
+		switch {
+		case len(e.Expected) > 0:
+			info.Hint = "expected " + joinAlternatives(e.Expected)
+		case e.Code == CodeUnclosedString:
+			info.Hint = "close the string with a matching quote; write a quote inside it as '' or \\'"
+		case e.Code == CodeUnclosedComment:
+			info.Hint = "close the comment with */"
+		}
+	case *CodedError:
+		info.Code = e.Code
+		info.Message = e.Message
+		info.File = e.File
+		info.Line = e.Line
+		info.Hint = e.Hint
+	default:
+		info.Code = defaultCode(phase)
+	}
+	return info
+}
+
+// errorJSON serialises err raised during phase as an error envelope.
+func errorJSON(phase string, err error) string {
+	return envelopeJSON(NewErrorInfo(phase, err))
+}
+
+func envelopeJSON(info *ErrorInfo) string {
+	jsonResult, _ := json.Marshal(errorEnvelope{Error: info})
+	return string(jsonResult)
+}
+
+func defaultCode(phase string) string {
+	switch phase {
+	case PhaseParse:
+		return CodeSyntax
+	case PhaseLedger:
+		return CodeLedger
+	case PhaseSerialize:
+		return CodeSerialization
+	default:
+		return CodeExecution
+	}
+}
+
+// CodedError is an error with a stable code and an optional hint on how to
+// fix it. File names the ledger file for multi-file ledgers; Line is the
+// 1-based ledger line, or 0 when not applicable.
+type CodedError struct {
+	Code    string
+	Message string
+	File    string
+	Line    int
+	Hint    string
+}
+
+func (e *CodedError) Error() string {
+	switch {
+	case e.File != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return e.Message
+}
+
+// ParseError describes a BQL syntax error with its location in the query.
+type ParseError struct {
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Offset   int      `json:"offset"`
+	Token    string   `json:"token,omitempty"`
+	Expected []string `json:"expected,omitempty"`
+	Snippet  string   `json:"snippet,omitempty"`
+
+	// tokenIndex is the index of the offending token in the lexer's token
+	// list, or -1 when the error was raised by the lexer itself.
+	tokenIndex int
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("%s at line %d, column %d", e.Message, e.Line, e.Column)
+	if len(e.Expected) > 0 {
+		msg += "; expected " + joinAlternatives(e.Expected)
+	}
+	return msg
+}
+
+// newParseError completes the error recorded by the lexer with the expected
+// token set and a snippet of the query pointing at the error.
+func newParseError(query string, lexer *BQLLexer) *ParseError {
+	perr, ok := lexer.err.(*ParseError)
+	if !ok {
+		perr = &ParseError{Code: CodeSyntax, Message: "syntax error", Line: 1, Column: 1, tokenIndex: -1}
+		if lexer.err != nil {
+			perr.Message = lexer.err.Error()
+		}
+	}
+	if perr.tokenIndex >= 0 {
+		perr.Expected = expectedTokens(lexer.tokens[:perr.tokenIndex])
+	}
+	perr.Snippet = snippet(query, perr.Line, perr.Column)
+	return perr
+}
+
+// extraStatementError reports the second statement of a query given to
+// Parse, which accepts a single statement.
+func extraStatementError(query string, lexer *BQLLexer) *ParseError {
+	i := 0
+	for lexer.tokens[i].tok != ';' {
+		i++
+	}
+	t := lexer.tokens[i+1]
+	return &ParseError{
+		Code:       CodeSyntax,
+		Message:    "syntax error: unexpected " + describeToken(t) + " after the end of the statement",
+		Line:       t.pos.Line,
+		Column:     t.pos.Column,
+		Offset:     t.pos.Offset,
+		Token:      t.text,
+		Expected:   []string{tokenDisplayName(0)},
+		Snippet:    snippet(query, t.pos.Line, t.pos.Column),
+		tokenIndex: i + 1,
+	}
+}
+
+// expectedTokens returns the display names of every terminal the parser
+// would accept after the given token prefix. Each candidate is replayed
+// through the generated parser followed by an invalid sentinel; the
+// candidate is expected unless the parser fails on or before it.
+func expectedTokens(prefix []lexToken) []string {
+	const sentinel = 1 // not a token of the grammar, lexes as $unk
+
+	var names []string
+	acceptsEnd := false
+	for _, tok := range candidateTokens() {
+		replay := make([]lexToken, 0, len(prefix)+2)
+		replay = append(replay, prefix...)
+		replay = append(replay, lexToken{tok: tok}, lexToken{tok: sentinel})
+
+		l := &BQLLexer{replay: replay, errAt: -1}
+		if yyParse(l) != 0 && l.errAt <= len(prefix)+1 {
+			continue
+		}
+		if tok == 0 {
+			acceptsEnd = true
+			continue
+		}
+		names = append(names, tokenDisplayName(tok))
+	}
+	if acceptsEnd {
+		names = append(names, tokenDisplayName(0))
+	}
+	return names
+}
+
+// candidateTokens lists the lexer codes of all terminals in the grammar,
+// derived from the goyacc token name table.
+func candidateTokens() []int {
+	var toks []int
+	for i, name := range yyToknames {
+		switch {
+		case name == "$end":
+			toks = append(toks, 0)
+		case name == "error" || name == "$unk":
+		case strings.HasPrefix(name, "'"):
+			toks = append(toks, int([]rune(name)[1]))
+		default:
+			// Named tokens are numbered from yyPrivate in declaration
+			// order, directly after $end and error.
+			toks = append(toks, yyPrivate+i-1)
+		}
+	}
+	return toks
+}
+
+// tokenDisplayName returns a human-readable name for a lexer token code.
+func tokenDisplayName(tok int) string {
+	switch tok {
+	case 0:
+		return "end of query"
+	case IDENT:
+		return "identifier"
+	case STRING:
+		return "string"
+	case NUMBER:
+		return "number"
+	case PARAM:
+		return "parameter"
+	case EQ:
+		return "'='"
+	}
+	if tok >= yyPrivate {
+		if i := tok - yyPrivate + 1; i < len(yyToknames) {
+			return yyToknames[i]
+		}
+	}
+	return fmt.Sprintf("'%c'", rune(tok))
+}
+
+// joinAlternatives renders a list as "a", "a or b" or "a, b or c".
+func joinAlternatives(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " or " + items[len(items)-1]
+}
+
+// snippet returns the query line containing the error followed by a caret
+// under the given column.
+func snippet(query string, line, column int) string {
+	lines := strings.Split(query, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	src := strings.TrimRight(lines[line-1], "\r")
+	var caret strings.Builder
+	for i, ch := range []rune(src) {
+		if i >= column-1 {
+			break
+		}
+		if ch == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	for caret.Len() < column-1 {
+		caret.WriteRune(' ')
+	}
+	caret.WriteRune('^')
+	return src + "\n" + caret.String()
+}
@@ -0,0 +1,636 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Result struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+
+	// LedgerErrors lists the syntax errors and warnings of the ledger the
+	// query ran against. The transactions with errors were skipped, so the
+	// result covers the rest of the ledger.
+	LedgerErrors []SyntaxError `json:"ledger_errors,omitempty"`
+
+	// entries is set for the result of a PRINT statement, whose rows are
+	// Beancount entries that render as text on their own.
+	entries bool
+	// commas is the render_commas option of the ledger.
+	commas bool
+}
+
+type postingRow struct {
+	txn *Transaction
+	pst *Posting
+
+	// worth is the amount of the posting in the ledger's first operating
+	// currency, when hasWorth is set.
+	worth    float64
+	hasWorth bool
+}
+
+// tableRow is a row of the table a query reads: a posting with its
+// transaction, or a row of the result of a FROM subquery.
+type tableRow interface {
+	// value returns the value of a column. An unknown column evaluates to
+	// its own name.
+	value(column string) interface{}
+	// text returns the string a WHERE predicate compares for a column, or
+	// "" for a column that cannot be compared.
+	text(column string) string
+}
+
+// Execute runs query against ledger. The result reports the errors of the
+// ledger alongside its rows.
+func Execute(query *Query, ledger *Ledger) (*Result, error) {
+	result, err := executeRows(query, buildRows(ledger))
+	if err != nil {
+		return nil, err
+	}
+	result.describe(ledger)
+	return result, nil
+}
+
+// describe records on result what it reports of the ledger it ran against:
+// the ledger's errors, and the options that change how it renders.
+func (r *Result) describe(ledger *Ledger) {
+	r.LedgerErrors = ledger.Errors
+	r.commas = ledger.Options.RenderCommas
+}
+
+// executeRows runs query over prebuilt posting rows. The rows slice is not
+// modified, so it can be shared between queries.
+func executeRows(query *Query, rows []postingRow) (*Result, error) {
+	query = analyze(query)
+	if err := checkQuery(query); err != nil {
+		return nil, err
+	}
+	return execute(query, rows)
+}
+
+// execute runs an analysed and checked query. It reads the posting rows
+// selected by the FROM prefix, or the result of the FROM subquery;
+// subqueries read the same posting rows.
+func execute(query *Query, postings []postingRow) (*Result, error) {
+	rows, err := tableRows(query, postings)
+	if err != nil {
+		return nil, err
+	}
+	rows, err = applyWhere(rows, query, postings)
+	if err != nil {
+		return nil, err
+	}
+	if query.Print {
+		return printResult(rows), nil
+	}
+
+	hasAggregates := containsAggregates(query.Select)
+
+	if len(query.GroupBy) > 0 || hasAggregates {
+		result, err := executeGrouped(query, rows)
+		if err != nil {
+			return nil, err
+		}
+		return applyPivot(result, query), nil
+	}
+
+	result := &Result{
+		Columns: columnNames(query.Select),
+	}
+	for _, r := range rows {
+		row, err := projectRow(r, query.Select)
+		if err != nil {
+			return nil, err
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	applyOrderBy(result, query)
+	return applyPivot(result, query), nil
+}
+
+// printResult returns the transactions of the posting rows of a PRINT
+// statement as Beancount text, one entry per row. Each transaction is
+// printed once, in ledger order.
+func printResult(rows []tableRow) *Result {
+	result := &Result{Columns: []string{"entry"}, entries: true}
+	printed := make(map[*Transaction]bool)
+	for _, r := range rows {
+		txn := r.(postingRow).txn
+		if !printed[txn] {
+			printed[txn] = true
+			result.Rows = append(result.Rows, []interface{}{PrintTransaction(txn)})
+		}
+	}
+	return result
+}
+
+func buildRows(ledger *Ledger) []postingRow {
+	var rows []postingRow
+	prices := newPriceIndex(ledger.Entries)
+	for i := range ledger.Transactions {
+		txn := &ledger.Transactions[i]
+		for j := range txn.Postings {
+			row := postingRow{txn: txn, pst: &txn.Postings[j]}
+			if len(ledger.Options.OperatingCurrency) > 0 {
+				row.worth, row.hasWorth = convert(row.pst, txn.Date, ledger.Options.OperatingCurrency[0], prices)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// priceIndex holds the price directives of a ledger: for each commodity
+// and quote currency, the rates in date order.
+type priceIndex map[[2]string][]datedRate
+
+type datedRate struct {
+	date string
+	rate float64
+}
+
+func newPriceIndex(entries []Entry) priceIndex {
+	prices := make(priceIndex)
+	for _, e := range entries {
+		if e.Kind != "price" || len(e.Args) < 3 {
+			continue
+		}
+		rate, err := parseNumber(e.Args[1].Text)
+		if err != nil {
+			continue
+		}
+		key := [2]string{e.Args[0].Text, e.Args[2].Text}
+		prices[key] = append(prices[key], datedRate{date: e.Date, rate: rate})
+	}
+	for _, rates := range prices {
+		sort.SliceStable(rates, func(i, j int) bool { return rates[i].date < rates[j].date })
+	}
+	return prices
+}
+
+// rate returns the latest price of commodity in currency on or before
+// date.
+func (p priceIndex) rate(commodity, currency, date string) (float64, bool) {
+	rates := p[[2]string{commodity, currency}]
+	n := sort.Search(len(rates), func(i int) bool { return rates[i].date > date })
+	if n == 0 {
+		return 0, false
+	}
+	return rates[n-1].rate, true
+}
+
+// convert returns the amount of a posting in currency: the amount itself
+// when it is in currency, else at the latest price directive on or before
+// date, else at the posting's own price. It reports false when none
+// applies.
+func convert(pst *Posting, date, currency string, prices priceIndex) (float64, bool) {
+	switch {
+	case !pst.HasAmount:
+		return 0, false
+	case pst.Currency == currency:
+		return pst.Amount, true
+	}
+	if rate, ok := prices.rate(pst.Currency, currency, date); ok {
+		return pst.Amount * rate, true
+	}
+	if pst.PriceCurrency != currency {
+		return 0, false
+	}
+	if pst.TotalPrice {
+		if pst.Amount < 0 {
+			return -pst.Price, true
+		}
+		return pst.Price, true
+	}
+	return pst.Amount * pst.Price, true
+}
+
+// tableRows returns the table query reads, before WHERE filtering.
+func tableRows(query *Query, postings []postingRow) ([]tableRow, error) {
+	if query.FromQuery != nil {
+		sub, err := execute(query.FromQuery, postings)
+		if err != nil {
+			return nil, err
+		}
+		return resultTable(sub), nil
+	}
+	filtered := applyFrom(postings, query.From)
+	rows := make([]tableRow, len(filtered))
+	for i, r := range filtered {
+		rows[i] = r
+	}
+	return rows, nil
+}
+
+// resultRow is a row of a subquery result, read by the enclosing query as
+// a table row. Its columns are the subquery's column names.
+type resultRow struct {
+	columns map[string]int
+	values  []interface{}
+}
+
+func (r resultRow) value(column string) interface{} {
+	if i, ok := r.columns[column]; ok {
+		return r.values[i]
+	}
+	return column
+}
+
+func (r resultRow) text(column string) string {
+	if i, ok := r.columns[column]; ok {
+		return formatCell(r.values[i])
+	}
+	return ""
+}
+
+// resultTable returns the rows of result as a table. When two columns
+// share a name, the first one is read.
+func resultTable(result *Result) []tableRow {
+	columns := make(map[string]int, len(result.Columns))
+	for i, c := range result.Columns {
+		if _, ok := columns[c]; !ok {
+			columns[c] = i
+		}
+	}
+	rows := make([]tableRow, len(result.Rows))
+	for i, values := range result.Rows {
+		rows[i] = resultRow{columns: columns, values: values}
+	}
+	return rows
+}
+
+func applyFrom(rows []postingRow, from string) []postingRow {
+	if from == "" {
+		return rows
+	}
+	seen := make(map[*Transaction]bool)
+	for _, r := range rows {
+		if strings.HasPrefix(r.pst.Account, from) {
+			seen[r.txn] = true
+		}
+	}
+	var filtered []postingRow
+	for _, r := range rows {
+		if seen[r.txn] {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+// applyWhere keeps the rows matching the WHERE predicate of query: those
+// whose field equals the value, or for IN, is among the values of the
+// subquery's column.
+func applyWhere(rows []tableRow, query *Query, postings []postingRow) ([]tableRow, error) {
+	field, value := query.WhereField, query.Where
+	match := func(s string) bool { return s == value.Literal }
+	switch {
+	case value.Subquery != nil:
+		sub, err := execute(value.Subquery, postings)
+		if err != nil {
+			return nil, err
+		}
+		set := make(map[string]bool, len(sub.Rows))
+		for _, row := range sub.Rows {
+			if row[0] != nil {
+				set[formatCell(row[0])] = true
+			}
+		}
+		match = func(s string) bool { return set[s] }
+	case field == "" && value.Literal == "":
+		return rows, nil
+	}
+	var filtered []tableRow
+	for _, r := range rows {
+		if match(r.text(field)) {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered, nil
+}
+
+func (r postingRow) text(field string) string {
+	switch field {
+	case "account":
+		return r.pst.Account
+	case "date":
+		return r.txn.Date
+	case "payee":
+		return r.txn.Payee
+	case "narration":
+		return r.txn.Narration
+	case "flag":
+		return r.txn.Flag
+	case "currency":
+		return r.pst.Currency
+	case "filename":
+		return r.txn.File
+	case "lineno":
+		return strconv.Itoa(r.txn.Line)
+	case "year", "month", "day":
+		return strconv.Itoa(datePart(r.txn.Date, field))
+	case "ymonth":
+		return yearMonth(r.txn.Date)
+	default:
+		return ""
+	}
+}
+
+func resolveValue(r tableRow, expr Expression) interface{} {
+	if expr.Literal != "" {
+		return r.value(expr.Literal)
+	}
+	return nil
+}
+
+func (r postingRow) value(field string) interface{} {
+	switch field {
+	case "account":
+		return r.pst.Account
+	case "date":
+		return r.txn.Date
+	case "payee":
+		return r.txn.Payee
+	case "narration":
+		return r.txn.Narration
+	case "flag":
+		return r.txn.Flag
+	case "currency":
+		return r.pst.Currency
+	case "filename":
+		return r.txn.File
+	case "lineno":
+		return float64(r.txn.Line)
+	case "year", "month", "day":
+		return float64(datePart(r.txn.Date, field))
+	case "ymonth":
+		return yearMonth(r.txn.Date)
+	case "amount":
+		if r.pst.HasAmount {
+			return r.pst.Amount
+		}
+		return nil
+	case "position":
+		if r.pst.HasAmount {
+			return fmt.Sprintf("%.2f %s", r.pst.Amount, r.pst.Currency)
+		}
+		return ""
+	case "value":
+		if r.hasWorth {
+			return r.worth
+		}
+		return nil
+	default:
+		return field
+	}
+}
+
+// datePart returns the year, month or day of a YYYY-MM-DD date, or 0 if
+// the date is malformed.
+func datePart(date, part string) int {
+	if len(date) < 10 {
+		return 0
+	}
+	var s string
+	switch part {
+	case "year":
+		s = date[0:4]
+	case "month":
+		s = date[5:7]
+	case "day":
+		s = date[8:10]
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// yearMonth returns the YYYY-MM month of a YYYY-MM-DD date.
+func yearMonth(date string) string {
+	if len(date) < 7 {
+		return date
+	}
+	return date[:7]
+}
+
+func projectRow(r tableRow, selectExprs []Expression) ([]interface{}, error) {
+	var vals []interface{}
+	for _, expr := range selectExprs {
+		if expr.FuncName != "" {
+			return nil, fmt.Errorf("aggregate function %s() used without GROUP BY", strings.ToUpper(expr.FuncName))
+		}
+		vals = append(vals, resolveValue(r, expr))
+	}
+	return vals, nil
+}
+
+func columnNames(exprs []Expression) []string {
+	var names []string
+	for _, e := range exprs {
+		names = append(names, exprName(e))
+	}
+	return names
+}
+
+func containsAggregates(exprs []Expression) bool {
+	for _, e := range exprs {
+		if e.FuncName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func executeGrouped(query *Query, rows []tableRow) (*Result, error) {
+	type group struct {
+		key  []interface{}
+		rows []tableRow
+	}
+
+	groups := make(map[string]*group)
+	var groupOrder []string
+
+	for _, r := range rows {
+		var keyParts []interface{}
+		var keyStr string
+		for _, g := range query.GroupBy {
+			val := resolveValue(r, g)
+			keyParts = append(keyParts, val)
+			keyStr += fmt.Sprintf("%v|", val)
+		}
+		if _, ok := groups[keyStr]; !ok {
+			groups[keyStr] = &group{key: keyParts}
+			groupOrder = append(groupOrder, keyStr)
+		}
+		groups[keyStr].rows = append(groups[keyStr].rows, r)
+	}
+
+	result := &Result{
+		Columns: columnNames(query.Select),
+	}
+
+	for _, k := range groupOrder {
+		g := groups[k]
+		var outRow []interface{}
+		for _, expr := range query.Select {
+			if expr.FuncName != "" {
+				val, err := evalAggregate(expr, g.rows)
+				if err != nil {
+					return nil, err
+				}
+				outRow = append(outRow, val)
+			} else {
+				outRow = append(outRow, resolveValue(g.rows[0], expr))
+			}
+		}
+		result.Rows = append(result.Rows, outRow)
+	}
+
+	applyOrderBy(result, query)
+	return result, nil
+}
+
+// checkQuery reports the errors of an analysed query and its subqueries
+// that do not depend on the ledger, such as unknown functions, without
+// executing it.
+func checkQuery(q *Query) error {
+	for _, expr := range q.Select {
+		if expr.FuncName != "" {
+			if err := checkAggregate(expr); err != nil {
+				return err
+			}
+		}
+	}
+	if err := checkPivot(q); err != nil {
+		return err
+	}
+	if q.FromQuery != nil {
+		if err := checkQuery(q.FromQuery); err != nil {
+			return err
+		}
+	}
+	if sub := q.Where.Subquery; sub != nil {
+		if len(sub.Select) != 1 {
+			return &CodedError{
+				Code:    CodeSubquery,
+				Message: fmt.Sprintf("IN subquery must select exactly one column, got %d", len(sub.Select)),
+				Hint:    "select only the column to compare, as in payee IN (SELECT payee ...)",
+			}
+		}
+		return checkQuery(sub)
+	}
+	return nil
+}
+
+func checkAggregate(expr Expression) error {
+	switch expr.FuncName {
+	case "count":
+		return nil
+	case "sum":
+		if len(expr.FuncArgs) != 1 {
+			return &CodedError{
+				Code:    CodeArgumentCount,
+				Message: "SUM requires exactly one argument",
+				Hint:    "use SUM(amount)",
+			}
+		}
+		return nil
+	default:
+		return &CodedError{
+			Code:    CodeUnknownFunction,
+			Message: fmt.Sprintf("unknown aggregate function: %s", strings.ToUpper(expr.FuncName)),
+			Hint:    "supported aggregate functions are SUM and COUNT",
+		}
+	}
+}
+
+func evalAggregate(expr Expression, rows []tableRow) (interface{}, error) {
+	if err := checkAggregate(expr); err != nil {
+		return nil, err
+	}
+	if expr.FuncName == "count" {
+		return float64(len(rows)), nil
+	}
+	field := expr.FuncArgs[0].Literal
+	var total float64
+	for _, r := range rows {
+		val := r.value(field)
+		if v, ok := val.(float64); ok {
+			total += v
+		}
+	}
+	return total, nil
+}
+
+func applyOrderBy(result *Result, query *Query) {
+	if len(query.OrderBy) == 0 || len(result.Rows) == 0 {
+		return
+	}
+
+	colIndex := make(map[string]int)
+	for i, c := range result.Columns {
+		colIndex[c] = i
+	}
+
+	sort.SliceStable(result.Rows, func(i, j int) bool {
+		for _, ob := range query.OrderBy {
+			idx, ok := colIndex[exprName(ob.Expression)]
+			if !ok {
+				continue
+			}
+			vi := result.Rows[i][idx]
+			vj := result.Rows[j][idx]
+			cmp := compareValues(vi, vj)
+			if cmp == 0 {
+				continue
+			}
+			if ob.Ascending {
+				return cmp < 0
+			}
+			return cmp > 0
+		}
+		return false
+	})
+}
+
+func compareValues(a, b interface{}) int {
+	fa, aIsFloat := toFloat(a)
+	fb, bIsFloat := toFloat(b)
+	if aIsFloat && bIsFloat {
+		if fa < fb {
+			return -1
+		}
+		if fa > fb {
+			return 1
+		}
+		return 0
+	}
+	sa := fmt.Sprintf("%v", a)
+	sb := fmt.Sprintf("%v", b)
+	if sa < sb {
+		return -1
+	}
+	if sa > sb {
+		return 1
+	}
+	return 0
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case int:
+		return float64(val), true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		if err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
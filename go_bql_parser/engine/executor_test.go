@@ -0,0 +1,598 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testLedger = `
+2024-01-15 * "AcmeCo" "Salary deposit"
+  Assets:BofA:Checking    3000.00 USD
+  Income:Salary:AcmeCo   -3000.00 USD
+
+2024-01-16 * "Whole Foods" "Weekly groceries"
+  Expenses:Food:Groceries   87.34 USD
+  Assets:BofA:Checking     -87.34 USD
+
+2024-01-20 * "Olive Garden" "Dinner with family"
+  Expenses:Food:Restaurant  72.15 USD
+  Liabilities:CreditCard:Visa
+
+2024-02-03 * "Trader Joe's" "Groceries"
+  Expenses:Food:Groceries  112.60 USD
+  Assets:BofA:Checking    -112.60 USD
+
+2024-02-12 * "AcmeCo" "Salary deposit"
+  Assets:BofA:Checking    3000.00 USD
+  Income:Salary:AcmeCo   -3000.00 USD
+
+2024-02-25 * "Landlord Properties LLC" "February rent"
+  Expenses:Rent           1500.00 USD
+  Assets:BofA:Checking   -1500.00 USD
+`
+
+func TestParseLedger(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	if len(ledger.Transactions) != 6 {
+		t.Fatalf("expected 6 transactions, got %d", len(ledger.Transactions))
+	}
+
+	txn := ledger.Transactions[0]
+	if txn.Date != "2024-01-15" {
+		t.Errorf("expected date 2024-01-15, got %s", txn.Date)
+	}
+	if txn.Payee != "AcmeCo" {
+		t.Errorf("expected payee AcmeCo, got %s", txn.Payee)
+	}
+	if len(txn.Postings) != 2 {
+		t.Fatalf("expected 2 postings, got %d", len(txn.Postings))
+	}
+	if txn.Postings[0].Amount != 3000.00 {
+		t.Errorf("expected amount 3000.00, got %f", txn.Postings[0].Amount)
+	}
+
+	olive := ledger.Transactions[2]
+	if !olive.Postings[0].HasAmount {
+		t.Error("expected first posting of Olive Garden to have amount")
+	}
+	if olive.Postings[1].HasAmount {
+		t.Error("expected second posting of Olive Garden to NOT have amount")
+	}
+}
+
+func TestSelectAllPostings(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	query, _ := Parse("SELECT account, date, narration")
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(result.Columns) != 3 {
+		t.Fatalf("expected 3 columns, got %d", len(result.Columns))
+	}
+	if result.Columns[0] != "account" || result.Columns[1] != "date" || result.Columns[2] != "narration" {
+		t.Errorf("unexpected columns: %v", result.Columns)
+	}
+	if len(result.Rows) != 12 {
+		t.Errorf("expected 12 rows (2 postings * 6 txns), got %d", len(result.Rows))
+	}
+}
+
+func TestWhereFilter(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	query, _ := Parse("SELECT account, amount WHERE account = 'Expenses:Food:Groceries'")
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(result.Rows) != 2 {
+		t.Fatalf("expected 2 grocery rows, got %d", len(result.Rows))
+	}
+	for _, row := range result.Rows {
+		if row[0] != "Expenses:Food:Groceries" {
+			t.Errorf("expected account Expenses:Food:Groceries, got %v", row[0])
+		}
+	}
+}
+
+func TestWhereFilterQuotedPayee(t *testing.T) {
+	ledger := ParseLedger(`
+2024-03-02 * "Trader Joe's" "Groceries"
+  Expenses:Food:Groceries   41.10 USD
+  Assets:Cash
+
+2024-03-03 * "Café Zürich" "Coffee"
+  Expenses:Food:Coffee   4.50 EUR
+  Assets:Cash
+`)
+	for _, q := range []string{
+		`SELECT amount WHERE payee = 'Trader Joe''s'`,
+		`SELECT amount WHERE payee = "Trader Joe's"`,
+		`SELECT amount WHERE payee = 'Café Zürich'`,
+	} {
+		query, err := Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", q, err)
+		}
+		result, err := Execute(query, ledger)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if len(result.Rows) != 2 {
+			t.Errorf("%s: expected 2 rows, got %d", q, len(result.Rows))
+		}
+	}
+}
+
+func TestFromFilter(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	query, _ := Parse("SELECT account, amount FROM 'Expenses:Food'")
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	for _, row := range result.Rows {
+		acct := row[0].(string)
+		_ = acct
+	}
+	if len(result.Rows) < 4 {
+		t.Errorf("expected at least 4 rows from food transactions, got %d", len(result.Rows))
+	}
+}
+
+func TestGroupByWithSum(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	query, _ := Parse("SELECT account, SUM(amount) GROUP BY account")
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	found := false
+	for _, row := range result.Rows {
+		if row[0] == "Expenses:Food:Groceries" {
+			found = true
+			sum := row[1].(float64)
+			expected := 87.34 + 112.60
+			if sum < expected-0.01 || sum > expected+0.01 {
+				t.Errorf("expected sum ~%.2f, got %.2f", expected, sum)
+			}
+		}
+	}
+	if !found {
+		t.Error("did not find Expenses:Food:Groceries group")
+	}
+}
+
+// TestValueColumn checks that value converts amounts to the first
+// operating currency at the latest price, or at the posting's own price.
+func TestValueColumn(t *testing.T) {
+	text := `option "operating_currency" "USD"
+2024-01-01 price EUR 1.10 USD
+2024-02-01 price EUR 1.20 USD
+2024-01-15 * "Cafe"
+  Expenses:Food   10.00 EUR
+  Assets:Cash
+2024-02-15 * "Cafe"
+  Expenses:Food   10.00 EUR
+  Expenses:Food    5.00 USD
+  Expenses:Food    2 GBP @ 1.25 USD
+  Expenses:Food    3 CHF @@ 3.30 USD
+  Expenses:Food    4 JPY
+  Assets:Cash
+`
+	query, _ := Parse("SELECT currency, value WHERE account = 'Expenses:Food'")
+	result, err := Execute(query, ParseLedger(text))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	want := []interface{}{11.0, 12.0, 5.0, 2.5, 3.3, nil}
+	if len(result.Rows) != len(want) {
+		t.Fatalf("expected %d rows, got %v", len(want), result.Rows)
+	}
+	for i, row := range result.Rows {
+		got, ok := row[1].(float64)
+		if w, _ := want[i].(float64); want[i] == nil && row[1] != nil || want[i] != nil && (!ok || got < w-1e-9 || got > w+1e-9) {
+			t.Errorf("row %d (%v): expected value %v, got %v", i, row[0], want[i], row[1])
+		}
+	}
+
+	// Without an operating currency there is nothing to convert to.
+	result, err = Execute(query, ParseLedger(strings.TrimPrefix(text, `option "operating_currency" "USD"`)))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	for _, row := range result.Rows {
+		if row[1] != nil {
+			t.Errorf("expected no value without an operating currency, got %v", row)
+		}
+	}
+}
+
+func TestGroupByWithCount(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	query, _ := Parse("SELECT account, COUNT(*) GROUP BY account")
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	for _, row := range result.Rows {
+		if row[0] == "Assets:BofA:Checking" {
+			count := row[1].(float64)
+			if count != 5 {
+				t.Errorf("expected 5 checking postings, got %.0f", count)
+			}
+		}
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	query, _ := Parse("SELECT account, amount WHERE account = 'Expenses:Food:Groceries' ORDER BY amount DESC")
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(result.Rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(result.Rows))
+	}
+	first := result.Rows[0][1].(float64)
+	second := result.Rows[1][1].(float64)
+	if first < second {
+		t.Errorf("expected descending order: %.2f should be >= %.2f", first, second)
+	}
+}
+
+func TestCaseInsensitiveNames(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	query, _ := Parse("SELECT Account, Sum(Amount), count(*) FROM 'Expenses' WHERE Flag = '*' GROUP BY ACCOUNT ORDER BY SUM(amount) DESC")
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got := strings.Join(result.Columns, ","); got != "account,sum(amount),count(*)" {
+		t.Errorf("expected canonical headers, got %s", got)
+	}
+	if len(result.Rows) == 0 || result.Rows[0][0] != "Expenses:Rent" {
+		t.Fatalf("expected Expenses:Rent first, got %v", result.Rows)
+	}
+	for i := 1; i < len(result.Rows); i++ {
+		if result.Rows[i-1][1].(float64) < result.Rows[i][1].(float64) {
+			t.Errorf("rows not sorted by sum(amount) descending: %v", result.Rows)
+		}
+	}
+
+	query, _ = Parse("SELECT Payee ORDER BY PAYEE")
+	result, err = Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.Columns[0] != "payee" || result.Rows[0][0] != "AcmeCo" || result.Rows[len(result.Rows)-1][0] != "Whole Foods" {
+		t.Errorf("unexpected result: %v %v", result.Columns, result.Rows)
+	}
+}
+
+func TestSubqueryIn(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	// Every posting of the payees that ever paid into Expenses:Food:Groceries.
+	query, _ := Parse("SELECT payee, account WHERE payee IN (SELECT payee WHERE account = 'Expenses:Food:Groceries') ORDER BY payee")
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(result.Rows) != 4 {
+		t.Fatalf("expected 4 rows, got %v", result.Rows)
+	}
+	if result.Rows[0][0] != "Trader Joe's" || result.Rows[3][0] != "Whole Foods" {
+		t.Errorf("unexpected rows: %v", result.Rows)
+	}
+}
+
+func TestSubqueryFrom(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	query, _ := Parse("SELECT payee, SUM(amount), COUNT(*) FROM (SELECT payee, amount FROM 'Expenses:Food') WHERE payee = 'Whole Foods' GROUP BY payee")
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(result.Rows) != 1 {
+		t.Fatalf("expected 1 row, got %v", result.Rows)
+	}
+	if row := result.Rows[0]; row[1] != 0.0 || row[2] != 2.0 {
+		t.Errorf("expected the two Whole Foods postings to balance, got %v", row)
+	}
+
+	// Columns of the subquery are the table's columns; others evaluate to
+	// their name as for postings.
+	query, _ = Parse("SELECT account, narration FROM (SELECT account WHERE account = 'Expenses:Rent')")
+	result, err = Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != "Expenses:Rent" || result.Rows[0][1] != "narration" {
+		t.Errorf("unexpected rows: %v", result.Rows)
+	}
+}
+
+func TestSubqueryErrors(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	query, _ := Parse("SELECT account WHERE payee IN (SELECT payee, account)")
+	_, err := Execute(query, ledger)
+	if ce, ok := err.(*CodedError); !ok || ce.Code != CodeSubquery {
+		t.Errorf("expected %s, got %v", CodeSubquery, err)
+	}
+
+	query, _ = Parse("SELECT payee FROM (SELECT payee, MAX(amount) GROUP BY payee)")
+	_, err = Execute(query, ledger)
+	if ce, ok := err.(*CodedError); !ok || ce.Code != CodeUnknownFunction {
+		t.Errorf("expected %s, got %v", CodeUnknownFunction, err)
+	}
+}
+
+func TestPivot(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	query, _ := Parse("SELECT account, ymonth, SUM(amount) FROM 'Expenses:Food' GROUP BY account, ymonth ORDER BY account PIVOT BY account, ymonth")
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got := strings.Join(result.Columns, ","); got != "account,2024-01,2024-02" {
+		t.Fatalf("unexpected columns %s", got)
+	}
+	// FROM keeps whole transactions, so the other legs appear too.
+	if len(result.Rows) != 4 {
+		t.Fatalf("expected 4 rows, got %v", result.Rows)
+	}
+	if row := result.Rows[1]; row[0] != "Expenses:Food:Groceries" || row[1] != 87.34 || row[2] != 112.60 {
+		t.Errorf("unexpected groceries row %v", row)
+	}
+	if row := result.Rows[2]; row[0] != "Expenses:Food:Restaurant" || row[1] != 72.15 || row[2] != nil {
+		t.Errorf("expected no restaurant spending in February, got %v", row)
+	}
+
+	query, _ = Parse("SELECT year, month, SUM(amount), COUNT(*) WHERE payee = 'AcmeCo' GROUP BY year, month PIVOT BY year, month")
+	result, err = Execute(query, ledger)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got := strings.Join(result.Columns, ","); got != "year,1/sum(amount),1/count(*),2/sum(amount),2/count(*)" {
+		t.Fatalf("unexpected columns %s", got)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != 2024.0 || result.Rows[0][2] != 2.0 || result.Rows[0][4] != 2.0 {
+		t.Errorf("unexpected rows %v", result.Rows)
+	}
+}
+
+func TestPivotErrors(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	for _, q := range []string{
+		"SELECT account, ymonth, SUM(amount) GROUP BY account, ymonth PIVOT BY account",
+		"SELECT account, SUM(amount) GROUP BY account, ymonth PIVOT BY account, ymonth",
+		"SELECT account, ymonth GROUP BY account, ymonth PIVOT BY account, ymonth",
+		"SELECT account, ymonth, SUM(amount) GROUP BY account, ymonth PIVOT BY account, account",
+	} {
+		query, err := Parse(q)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", q, err)
+		}
+		_, err = Execute(query, ledger)
+		if ce, ok := err.(*CodedError); !ok || ce.Code != CodePivot {
+			t.Errorf("%s: expected %s, got %v", q, CodePivot, err)
+		}
+	}
+}
+
+func TestPrint(t *testing.T) {
+	ledger := ParseLedger(testLedger)
+	query, err := Parse(`PRINT FROM "Assets:BofA" WHERE payee = "AcmeCo"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Columns) != 1 || result.Columns[0] != "entry" || len(result.Rows) != 2 {
+		t.Fatalf("expected the two salary deposits, got %+v", result)
+	}
+	want := "2024-01-15 * \"AcmeCo\" \"Salary deposit\"\n" +
+		"  Assets:BofA:Checking   3000.00 USD\n" +
+		"  Income:Salary:AcmeCo  -3000.00 USD\n"
+	if result.Rows[0][0] != want {
+		t.Errorf("unexpected entry:\n%s\nwant:\n%s", result.Rows[0][0], want)
+	}
+
+	// Each transaction is printed once, however many postings match.
+	query, _ = Parse(`PRINT WHERE date = "2024-01-16"`)
+	if result, err = Execute(query, ledger); err != nil || len(result.Rows) != 1 {
+		t.Fatalf("expected one entry, got %+v, %v", result, err)
+	}
+	text, err := Render(result, FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(text, "2024-01-16 * \"Whole Foods\"") {
+		t.Errorf("expected the entry as text, got %q", text)
+	}
+}
+
+func TestExecuteBQLEndToEnd(t *testing.T) {
+	jsonStr := ExecuteBQL(
+		"SELECT account, amount WHERE account = 'Expenses:Rent'",
+		testLedger,
+	)
+	var result Result
+	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+	if len(result.Rows) != 1 {
+		t.Fatalf("expected 1 rent row, got %d", len(result.Rows))
+	}
+	if result.Rows[0][0] != "Expenses:Rent" {
+		t.Errorf("expected Expenses:Rent, got %v", result.Rows[0][0])
+	}
+}
+
+func TestExecuteBQLWithSampleFile(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.beancount")
+	if err != nil {
+		t.Skipf("sample file not found: %v", err)
+	}
+
+	jsonStr := ExecuteBQL(
+		"SELECT account, SUM(amount) WHERE account = 'Expenses:Food:Groceries' GROUP BY account",
+		string(data),
+	)
+	var result Result
+	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
+		t.Fatalf("failed to unmarshal: %v\nraw: %s", err, jsonStr)
+	}
+	if len(result.Rows) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(result.Rows))
+	}
+	if result.Rows[0][0] != "Expenses:Food:Groceries" {
+		t.Errorf("unexpected account: %v", result.Rows[0][0])
+	}
+	sum := result.Rows[0][1].(float64)
+	if sum < 100 {
+		t.Errorf("expected total groceries > 100, got %.2f", sum)
+	}
+}
+
+// TestCorpus runs the query and ledger corpus shared with the host tests,
+// which compare the WASI module against the engine on it: every query
+// against every ledger returns a JSON result or error.
+func TestCorpus(t *testing.T) {
+	data, err := os.ReadFile("testdata/corpus.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corpus struct {
+		Queries []string `json:"queries"`
+		Ledgers []string `json:"ledgers"`
+	}
+	if err := json.Unmarshal(data, &corpus); err != nil {
+		t.Fatal(err)
+	}
+	for _, ledger := range corpus.Ledgers {
+		if out := CheckBeancountSyntax(ledger); !json.Valid([]byte(out)) {
+			t.Errorf("CheckBeancountSyntax(%q) returned %s", ledger, out)
+		}
+		for _, q := range corpus.Queries {
+			if out := ExecuteBQL(q, ledger); !json.Valid([]byte(out)) {
+				t.Errorf("ExecuteBQL(%q) on %q returned %s", q, ledger, out)
+			}
+		}
+	}
+	for _, q := range corpus.Queries {
+		if out := ParseBQLToJSON(q); !json.Valid([]byte(out)) {
+			t.Errorf("ParseBQLToJSON(%q) returned %s", q, out)
+		}
+	}
+}
+
+func TestExecuteBQLParseError(t *testing.T) {
+	jsonStr := ExecuteBQL("INVALID QUERY", testLedger)
+	if !containsStr(jsonStr, "error") {
+		t.Errorf("expected error in result, got: %s", jsonStr)
+	}
+}
+
+// TestExecuteBQLLedgerErrors checks that a query runs on the valid part
+// of a ledger with errors, and reports the errors with the result.
+func TestExecuteBQLLedgerErrors(t *testing.T) {
+	ledger := testLedger + `
+2024-03-01 * "Typo" "Amount out of range"
+  Expenses:Misc  1` + strings.Repeat("0", 400) + ` USD
+  Assets:Cash
+
+2024-03-02 * "Typo" "Missing currency"
+  Expenses:Misc  5.00
+  Assets:Cash
+
+2024-03-03 * "Corner Shop" "Snacks"
+  Expenses:Misc  4.50 USD
+  Assets:Cash
+`
+	var result Result
+	if err := json.Unmarshal([]byte(ExecuteBQL("SELECT payee, amount WHERE account = 'Expenses:Misc'", ledger)), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != "Corner Shop" {
+		t.Errorf("expected only the valid transaction, got %+v", result.Rows)
+	}
+	if len(result.LedgerErrors) != 2 {
+		t.Fatalf("expected two ledger errors, got %+v", result.LedgerErrors)
+	}
+	if e := result.LedgerErrors[0]; e.Code != CodeInvalidAmount || e.Line != 27 || e.Column != 18 {
+		t.Errorf("unexpected first error %+v", e)
+	}
+	if e := result.LedgerErrors[1]; e.Code != CodeInvalidPosting || e.Line != 31 {
+		t.Errorf("unexpected second error %+v", e)
+	}
+}
+
+func TestExecuteBQLErrorEnvelope(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		ledger string
+		code   string
+		phase  string
+		line   int
+	}{
+		{
+			name:   "parse error",
+			query:  "SELECT account WHERE",
+			ledger: testLedger,
+			code:   CodeSyntax,
+			phase:  PhaseParse,
+			line:   1,
+		},
+		{
+			name:   "unknown aggregate",
+			query:  "SELECT account, AVG(amount) GROUP BY account",
+			ledger: testLedger,
+			code:   CodeUnknownFunction,
+			phase:  PhaseExecute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonStr := ExecuteBQL(tt.query, tt.ledger)
+			var envelope struct {
+				Error *ErrorInfo `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(jsonStr), &envelope); err != nil {
+				t.Fatalf("error output is not valid JSON: %v\nraw: %s", err, jsonStr)
+			}
+			if envelope.Error == nil {
+				t.Fatalf("expected error envelope, got: %s", jsonStr)
+			}
+			e := envelope.Error
+			if e.Code != tt.code || e.Phase != tt.phase || e.Line != tt.line {
+				t.Errorf("got code=%s phase=%s line=%d, want code=%s phase=%s line=%d", e.Code, e.Phase, e.Line, tt.code, tt.phase, tt.line)
+			}
+			if e.Message == "" {
+				t.Error("expected a message")
+			}
+		})
+	}
+}
+
+func containsStr(s, sub string) bool {
+	return len(s) >= len(sub) && (s == sub || len(s) > 0 && findSubstr(s, sub))
+}
+
+func findSubstr(s, sub string) bool {
+	for i := 0; i <= len(s)-len(sub); i++ {
+		if s[i:i+len(sub)] == sub {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// FormatOptions controls FormatLedger.
+type FormatOptions struct {
+	// CurrencyColumn is the 1-based column at which the currencies of
+	// amounts start. Zero aligns them at the narrowest column that fits
+	// every amount of the file.
+	CurrencyColumn int
+	// Indent is the number of spaces before postings and metadata. The
+	// metadata of a posting is indented twice as far. Zero means 2.
+	Indent int
+}
+
+// DefaultIndent is the indentation of postings when FormatOptions.Indent
+// is zero.
+const DefaultIndent = 2
+
+// FormatLedger returns ledger text laid out as bean-format does: the
+// amounts of postings, balance and price directives right-aligned so that
+// their currencies start at one column, postings and metadata indented
+// uniformly, and the tokens of each line separated by single spaces.
+// Comments and blank lines are kept, and lines with syntax errors are left
+// as they are. Lines end with "\n".
+func FormatLedger(text string, opts FormatOptions) string {
+	if opts.Indent <= 0 {
+		opts.Indent = DefaultIndent
+	}
+	f := &formatter{
+		opts:   opts,
+		source: strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n"),
+		broken: errorLines(ParseBeancount("", text).Errors),
+	}
+	return f.format(tokenizeLedger(text))
+}
+
+// formatter lays out the lines of one ledger file.
+type formatter struct {
+	opts   FormatOptions
+	source []string
+	broken map[int]bool
+	lines  []formattedLine
+}
+
+// formattedLine is an output line. A line with an amount is completed by
+// align once the column of the currencies is known: prefix, the number
+// right-aligned, and suffix starting with the currency.
+type formattedLine struct {
+	text           string
+	prefix, number string
+	suffix         string
+}
+
+func (f *formatter) format(toks []LedgerToken) string {
+	postingIndent := -1
+	for len(toks) > 0 && toks[0].Kind != TokenEOF {
+		end := 0
+		for toks[end].Kind != TokenNewline {
+			end++
+		}
+		line, newline := toks[:end], toks[end]
+		toks = toks[end+1:]
+
+		first, last := newline.Span.Line, newline.Span.Line
+		if len(line) > 0 {
+			first = line[0].Span.Line
+		}
+		if anyLine(f.broken, first, last) {
+			for n := first; n <= last; n++ {
+				f.lines = append(f.lines, formattedLine{text: f.source[n-1]})
+			}
+			postingIndent = -1
+			continue
+		}
+
+		var comment string
+		if n := len(line); n > 0 && line[n-1].Kind == TokenComment {
+			comment = strings.TrimRight(line[n-1].Text, " \t")
+			line = line[:n-1]
+		}
+		if len(line) == 0 || line[0].Kind != TokenIndent {
+			postingIndent = -1
+			f.header(line, comment)
+			continue
+		}
+
+		indent := strings.Repeat(" ", f.opts.Indent)
+		body := line[1:]
+		switch {
+		case len(body) == 0:
+			f.lines = append(f.lines, formattedLine{text: indent + comment})
+		case body[0].Kind == TokenKey:
+			if postingIndent >= 0 && len(line[0].Text) > postingIndent {
+				indent += indent
+			}
+			f.lines = append(f.lines, formattedLine{text: withComment(indent+joinTokens(body), comment)})
+		default:
+			postingIndent = len(line[0].Text)
+			f.posting(indent, body, comment)
+		}
+	}
+	return f.align()
+}
+
+// header lays out an unindented line: a directive, a comment or a blank
+// line. The amounts of balance and price directives are aligned.
+func (f *formatter) header(line []LedgerToken, comment string) {
+	if len(line) >= 2 && line[1].Kind == TokenKeyword && (line[1].Text == "balance" || line[1].Text == "price") {
+		for i := 2; i+1 < len(line); i++ {
+			if line[i].Kind == TokenNumber && line[i+1].Kind == TokenCurrency {
+				f.amount(joinTokens(line[:i]), line[i:], comment)
+				return
+			}
+		}
+	}
+	f.lines = append(f.lines, formattedLine{text: withComment(joinTokens(line), comment)})
+}
+
+// posting lays out a posting line: its flag and account after indent, then
+// its aligned amount, cost and price.
+func (f *formatter) posting(indent string, body []LedgerToken, comment string) {
+	i := 0
+	prefix := indent
+	if len(body) > 1 && body[1].Kind == TokenAccount && (body[0].Kind == TokenFlag || len(body[0].Text) == 1 && strings.Contains(flagLetters, body[0].Text)) {
+		prefix += body[0].Text + " "
+		i++
+	}
+	prefix += body[i].Text
+	rest := body[i+1:]
+	if len(rest) >= 2 && rest[0].Kind == TokenNumber && rest[1].Kind == TokenCurrency {
+		f.amount(prefix, rest, comment)
+		return
+	}
+	if len(rest) > 0 {
+		prefix += " " + joinTokens(rest)
+	}
+	f.lines = append(f.lines, formattedLine{text: withComment(prefix, comment)})
+}
+
+// amount adds a line whose tokens start with a number and a currency.
+func (f *formatter) amount(prefix string, toks []LedgerToken, comment string) {
+	f.lines = append(f.lines, formattedLine{
+		prefix: prefix,
+		number: toks[0].Text,
+		suffix: withComment(joinTokens(toks[1:]), comment),
+	})
+}
+
+// align completes the lines with amounts and joins all lines. Numbers end
+// two columns before the currency column, with at least two spaces between
+// a number and what precedes it.
+func (f *formatter) align() string {
+	numberEnd := f.opts.CurrencyColumn - 2
+	if f.opts.CurrencyColumn <= 0 {
+		for _, l := range f.lines {
+			if w := utf8.RuneCountInString(l.prefix) + 2 + utf8.RuneCountInString(l.number); l.number != "" && w > numberEnd {
+				numberEnd = w
+			}
+		}
+	}
+	var b strings.Builder
+	for _, l := range f.lines {
+		if l.number != "" {
+			pad := numberEnd - utf8.RuneCountInString(l.prefix) - utf8.RuneCountInString(l.number)
+			if pad < 2 {
+				pad = 2
+			}
+			l.text = l.prefix + strings.Repeat(" ", pad) + l.number + " " + l.suffix
+		}
+		b.WriteString(l.text)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// joinTokens joins the source text of tokens with single spaces, except
+// inside braces and parentheses and before commas.
+func joinTokens(toks []LedgerToken) string {
+	var b strings.Builder
+	for i, t := range toks {
+		if i > 0 {
+			prev := toks[i-1].Text
+			if prev != "{" && prev != "{{" && prev != "(" && t.Text != "}" && t.Text != "}}" && t.Text != ")" && t.Text != "," {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(t.Text)
+	}
+	return b.String()
+}
+
+func withComment(text, comment string) string {
+	switch {
+	case comment == "":
+		return text
+	case text == "" || strings.TrimSpace(text) == "":
+		return text + comment
+	}
+	return text + " " + comment
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFormatLedger(t *testing.T) {
+	input := `option   "title"  "Test"
+; Accounts
+2024-01-01 open Assets:Cash   USD,EUR
+2024-01-01   balance Assets:Cash    0.00 USD
+
+2024-01-05   *   "Grocer"   "Groceries"   #food
+    id:   42
+	Expenses:Food     45.20 USD   ; weekly
+        receipt: "r.pdf"
+  ! Assets:Cash  -45.20 USD
+   ; paid in cash
+  Assets:Broker 2 AAPL {150.00 USD} @@ 310.00 USD
+  Equity:Rounding
+
+
+2024-01-06 * "Broken" "Entry"
+  Assets:Cash    10
+`
+	want := `option "title" "Test"
+; Accounts
+2024-01-01 open Assets:Cash USD, EUR
+2024-01-01 balance Assets:Cash  0.00 USD
+
+2024-01-05 * "Grocer" "Groceries" #food
+  id: 42
+  Expenses:Food                45.20 USD ; weekly
+    receipt: "r.pdf"
+  ! Assets:Cash               -45.20 USD
+  ; paid in cash
+  Assets:Broker                    2 AAPL {150.00 USD} @@ 310.00 USD
+  Equity:Rounding
+
+
+2024-01-06 * "Broken" "Entry"
+  Assets:Cash    10
+`
+	if got := FormatLedger(input, FormatOptions{}); got != want {
+		t.Errorf("unexpected format:\n%s\nwant:\n%s", got, want)
+	}
+
+	got := FormatLedger("2024-01-05 * \"Shop\"\r\n    Expenses:Food 5 USD\r\n    Assets:Cash", FormatOptions{CurrencyColumn: 30, Indent: 4})
+	if want := "2024-01-05 * \"Shop\"\n    Expenses:Food          5 USD\n    Assets:Cash\n"; got != want {
+		t.Errorf("unexpected format with options:\n%q\nwant:\n%q", got, want)
+	}
+
+	// A column too narrow for an amount leaves two spaces before it.
+	got = FormatLedger("2024-01-05 * \"Shop\"\n  Expenses:Food 5 USD\n  Assets:Cash\n", FormatOptions{CurrencyColumn: 10})
+	if want := "2024-01-05 * \"Shop\"\n  Expenses:Food  5 USD\n  Assets:Cash\n"; got != want {
+		t.Errorf("unexpected overflow:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+// TestFormatSample checks that formatting keeps the meaning of a ledger and
+// is stable: formatting the output again changes nothing.
+func TestFormatSample(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.beancount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted := FormatLedger(string(data), FormatOptions{})
+	if again := FormatLedger(formatted, FormatOptions{}); again != formatted {
+		t.Errorf("formatting is not idempotent:\n%s", again)
+	}
+	if errs := CheckSyntax(formatted).Errors; len(errs) != 0 {
+		t.Errorf("formatted ledger has diagnostics: %+v", errs)
+	}
+
+	before := ParseLedger(string(data))
+	after := ParseLedger(formatted)
+	for i := range before.Transactions {
+		before.Transactions[i].Line, after.Transactions[i].Line = 0, 0
+	}
+	if !reflect.DeepEqual(before.Transactions, after.Transactions) {
+		t.Error("formatting changed the transactions of the ledger")
+	}
+}
@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Posting is a posting of a transaction. Cost is the {...} or {{...}}
+// cost as written, and Price the per-unit price after @ or, when
+// TotalPrice is set, the total price after @@. A posting has a price when
+// PriceCurrency is set.
+type Posting struct {
+	Flag          string     `json:"flag,omitempty"`
+	Account       string     `json:"account"`
+	Amount        float64    `json:"amount"`
+	Currency      string     `json:"currency"`
+	HasAmount     bool       `json:"has_amount"`
+	Cost          string     `json:"cost,omitempty"`
+	Price         float64    `json:"price,omitempty"`
+	PriceCurrency string     `json:"price_currency,omitempty"`
+	TotalPrice    bool       `json:"total_price,omitempty"`
+	Meta          []Metadata `json:"meta,omitempty"`
+
+	// number and priceNumber are Amount and Price as written in the
+	// ledger, which the printer keeps while they still hold the values.
+	number, priceNumber string
+}
+
+type Transaction struct {
+	Date      string     `json:"date"`
+	Flag      string     `json:"flag"`
+	Payee     string     `json:"payee"`
+	Narration string     `json:"narration"`
+	Tags      []string   `json:"tags,omitempty"`
+	Links     []string   `json:"links,omitempty"`
+	Meta      []Metadata `json:"meta,omitempty"`
+	Postings  []Posting  `json:"postings"`
+	File      string     `json:"file,omitempty"`
+	Line      int        `json:"line"`
+}
+
+// Metadata is a "key: value" line of a transaction or posting. Value is
+// the value as written, such as a quoted string, a number or an amount.
+type Metadata struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// Ledger is the query model of a ledger. Options holds the settings of
+// its option directives, and Entries its dated directives in load order,
+// as transformed by the plugins its plugin directives enable; Transactions
+// are built from the transactions among them. Errors lists the syntax
+// errors and warnings of its files and the errors found by plugins, each
+// with its file and span. Directives with syntax errors are left out, and
+// the rest of the ledger is kept.
+type Ledger struct {
+	Options      Options       `json:"options"`
+	Entries      []Entry       `json:"-"`
+	Transactions []Transaction `json:"transactions"`
+	Errors       []SyntaxError `json:"errors,omitempty"`
+
+	// plugins are the plugin directives of the ledger, in load order.
+	plugins []Entry
+}
+
+// ParseLedger parses a single-text ledger. Include directives are ignored.
+// A broken transaction does not stop parsing: it is skipped and its errors
+// are added to the ledger's Errors.
+func ParseLedger(text string) *Ledger {
+	return buildLedger(ParseBeancount("", text))
+}
+
+// buildLedger returns the ledger of one parsed file.
+func buildLedger(file *LedgerFile) *Ledger {
+	ledger := newLedger()
+	appendLedgerFile(ledger, file, nil)
+	ledger.finish()
+	return ledger
+}
+
+// newLedger returns an empty ledger with the default options.
+func newLedger() *Ledger {
+	return &Ledger{Options: DefaultOptions()}
+}
+
+// appendLedgerFile appends the dated directives of a parsed ledger file to
+// the entries of ledger, and the errors of the file to the ledger's
+// errors. Option directives set the ledger's options in file order, and
+// plugin directives are kept for finish. Transactions get the tags pushed
+// by pushtag and not yet popped in the same file. Directives with an error
+// are skipped. Include directives are passed to include in file order, or
+// ignored when include is nil; an include that fails stops loading.
+func appendLedgerFile(ledger *Ledger, file *LedgerFile, include func(pattern string, line int) error) error {
+	ledger.Errors = append(ledger.Errors, file.Errors...)
+	broken := errorLines(file.Errors)
+	var pushed []string
+	for _, d := range file.Directives {
+		if anyLine(broken, d.Span.Line, d.Span.EndLine) {
+			continue
+		}
+		switch {
+		case d.Kind == "option":
+			// Unknown options were reported as warnings.
+			args := d.Strings()
+			ledger.Options.set(args[0], args[1])
+		case d.Kind == "plugin":
+			ledger.plugins = append(ledger.plugins, Entry{File: file.Name, Directive: d})
+		case d.Kind == "pushtag":
+			pushed = append(pushed, d.Args[0].Value)
+		case d.Kind == "poptag":
+			// Pop the latest push of the tag; popping a tag never pushed does
+			// nothing.
+			for i := len(pushed) - 1; i >= 0; i-- {
+				if pushed[i] == d.Args[0].Value {
+					pushed = append(pushed[:i:i], pushed[i+1:]...)
+					break
+				}
+			}
+		case d.Kind == "include":
+			if include != nil {
+				if err := include(d.Strings()[0], d.Span.Line); err != nil {
+					return err
+				}
+			}
+		case d.Date != "":
+			if d.Kind == "transaction" && len(pushed) > 0 {
+				d = withTags(d, pushed)
+			}
+			ledger.Entries = append(ledger.Entries, Entry{File: file.Name, Directive: d})
+		}
+	}
+	return nil
+}
+
+// withTags returns a copy of a transaction with the given tags added after
+// its own, leaving out those it has.
+func withTags(d *Directive, tags []string) *Directive {
+	c := *d
+	c.Tags = append([]string(nil), d.Tags...)
+	for _, tag := range tags {
+		if !slices.Contains(c.Tags, tag) {
+			c.Tags = append(c.Tags, tag)
+		}
+	}
+	return &c
+}
+
+// finish runs the plugins of the ledger over its entries, once all its
+// files are appended, and builds its transactions from the result. Each
+// transaction is tagged with its file and line.
+func (l *Ledger) finish() {
+	entries, errs := runPlugins(l.Entries, l.plugins, &l.Options)
+	l.Entries = entries
+	l.Errors = append(l.Errors, errs...)
+	for _, e := range entries {
+		if e.Kind == "transaction" {
+			l.Transactions = append(l.Transactions, buildTransaction(e.File, e.Directive))
+		}
+	}
+}
+
+// errorLines returns the lines covered by the errors of diags. Warnings
+// do not count.
+func errorLines(diags []SyntaxError) map[int]bool {
+	lines := make(map[int]bool)
+	for _, e := range diags {
+		if e.Severity != SeverityError {
+			continue
+		}
+		for line := e.Line; line <= e.EndLine; line++ {
+			lines[line] = true
+		}
+	}
+	return lines
+}
+
+// anyLine reports whether a line from first to last is in lines.
+func anyLine(lines map[int]bool, first, last int) bool {
+	for n := first; n <= last; n++ {
+		if lines[n] {
+			return true
+		}
+	}
+	return false
+}
+
+// buildTransaction converts a transaction directive of file to the
+// transaction queries run against. Its numbers have been checked by the
+// parser.
+func buildTransaction(file string, d *Directive) Transaction {
+	txn := Transaction{
+		Date:      d.Date,
+		Flag:      d.Flag,
+		Payee:     d.Payee,
+		Narration: d.Narration,
+		Tags:      d.Tags,
+		Links:     d.Links,
+		Meta:      metadata(d.Meta),
+		Postings:  make([]Posting, 0, len(d.Postings)),
+		File:      file,
+		Line:      d.Span.Line,
+	}
+	for _, pn := range d.Postings {
+		posting := Posting{
+			Flag:       pn.Flag,
+			Account:    pn.Account,
+			Cost:       pn.Cost,
+			TotalPrice: pn.TotalPrice,
+			Meta:       metadata(pn.Meta),
+		}
+		if pn.Amount != nil {
+			posting.Amount, _ = parseNumber(pn.Amount.Number)
+			posting.Currency = pn.Amount.Currency
+			posting.HasAmount = true
+			posting.number = pn.Amount.Number
+		}
+		if pn.Price != nil {
+			posting.Price, _ = parseNumber(pn.Price.Number)
+			posting.PriceCurrency = pn.Price.Currency
+			posting.priceNumber = pn.Price.Number
+		}
+		txn.Postings = append(txn.Postings, posting)
+	}
+	return txn
+}
+
+// parseNumber returns the value of a number as written in a ledger, with
+// optional thousands separators.
+func parseNumber(text string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(text, ",", ""), 64)
+}
+
+// metadata returns the metadata lines of a directive or posting, or nil
+// when there are none.
+func metadata(items []*MetaItem) []Metadata {
+	if len(items) == 0 {
+		return nil
+	}
+	meta := make([]Metadata, len(items))
+	for i, item := range items {
+		meta[i] = Metadata{Key: item.Key, Value: item.Value}
+	}
+	return meta
+}
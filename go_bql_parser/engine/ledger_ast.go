@@ -0,0 +1,79 @@
+package engine
+
+// LedgerFile is the syntax tree of one Beancount file, as produced by
+// ParseBeancount. Errors lists the syntax errors found while parsing;
+// directives and postings with errors are left out of the tree or kept
+// with the parts that could be read.
+type LedgerFile struct {
+	Name       string        `json:"name,omitempty"`
+	Directives []*Directive  `json:"directives"`
+	Comments   []LedgerToken `json:"comments,omitempty"`
+	Errors     []SyntaxError `json:"errors,omitempty"`
+}
+
+// Directive is one entry of a ledger file. Kind is "transaction" for
+// transactions, and otherwise the directive keyword: open, close, balance,
+// pad, commodity, price, event, note, document, query, custom, or the
+// undated option, include, plugin, pushtag and poptag.
+//
+// Args holds the tokens of the header line after the keyword, or after the
+// flag of a transaction. Account is the first account of the header, if
+// any; Payee, Narration, Tags, Links and Postings are only set for
+// transactions.
+type Directive struct {
+	Kind      string         `json:"kind"`
+	Span      Span           `json:"span"`
+	Date      string         `json:"date,omitempty"`
+	Flag      string         `json:"flag,omitempty"`
+	Payee     string         `json:"payee,omitempty"`
+	Narration string         `json:"narration,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+	Links     []string       `json:"links,omitempty"`
+	Account   string         `json:"account,omitempty"`
+	Args      []LedgerToken  `json:"args,omitempty"`
+	Meta      []*MetaItem    `json:"meta,omitempty"`
+	Postings  []*PostingNode `json:"postings,omitempty"`
+}
+
+// Strings returns the decoded string arguments of the directive, such as
+// the name and value of an option or the path of an include.
+func (d *Directive) Strings() []string {
+	var out []string
+	for _, t := range d.Args {
+		if t.Kind == TokenString {
+			out = append(out, t.Value)
+		}
+	}
+	return out
+}
+
+// PostingNode is a posting line of a transaction. Amount is nil for a
+// posting whose amount is left to be balanced. Cost is the source text of
+// a {...} or {{...}} cost, and Price the amount after @ or, when
+// TotalPrice is set, @@.
+type PostingNode struct {
+	Span        Span        `json:"span"`
+	Flag        string      `json:"flag,omitempty"`
+	Account     string      `json:"account"`
+	AccountSpan Span        `json:"account_span"`
+	Amount      *AmountNode `json:"amount,omitempty"`
+	Cost        string      `json:"cost,omitempty"`
+	Price       *AmountNode `json:"price,omitempty"`
+	TotalPrice  bool        `json:"total_price,omitempty"`
+	Meta        []*MetaItem `json:"meta,omitempty"`
+}
+
+// AmountNode is a number and a currency as written in the ledger.
+type AmountNode struct {
+	Number   string `json:"number"`
+	Currency string `json:"currency"`
+	Span     Span   `json:"span"`
+}
+
+// MetaItem is a "key: value" metadata line. Value is the source text of
+// the value, empty when the key has none.
+type MetaItem struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	Span  Span   `json:"span"`
+}
@@ -0,0 +1,376 @@
+package engine
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LedgerTokenKind classifies the tokens of Beancount ledger text.
+type LedgerTokenKind int
+
+const (
+	TokenEOF LedgerTokenKind = iota
+	// TokenNewline ends every line, so a blank line is a lone newline.
+	TokenNewline
+	// TokenIndent is the leading whitespace of an indented line.
+	TokenIndent
+	TokenComment
+	TokenDate
+	TokenFlag
+	TokenString
+	TokenNumber
+	TokenAccount
+	TokenCurrency
+	// TokenKeyword is a lower-case word such as open, txn or include.
+	TokenKeyword
+	TokenTag
+	TokenLink
+	// TokenKey is a metadata key with its trailing colon.
+	TokenKey
+	// TokenPunct is one of { } {{ }} @ @@ , ~ ( ) + - /.
+	TokenPunct
+	// TokenIllegal is text that starts no token, or an unterminated string.
+	TokenIllegal
+)
+
+var tokenKindNames = [...]string{
+	TokenEOF:      "end of file",
+	TokenNewline:  "newline",
+	TokenIndent:   "indent",
+	TokenComment:  "comment",
+	TokenDate:     "date",
+	TokenFlag:     "flag",
+	TokenString:   "string",
+	TokenNumber:   "number",
+	TokenAccount:  "account",
+	TokenCurrency: "currency",
+	TokenKeyword:  "keyword",
+	TokenTag:      "tag",
+	TokenLink:     "link",
+	TokenKey:      "metadata key",
+	TokenPunct:    "punctuation",
+	TokenIllegal:  "illegal token",
+}
+
+func (k LedgerTokenKind) String() string {
+	if int(k) < len(tokenKindNames) {
+		return tokenKindNames[k]
+	}
+	return "unknown token"
+}
+
+// MarshalText encodes the kind by name in JSON.
+func (k LedgerTokenKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Span locates a node in a ledger file: the 1-based line and column of its
+// first character, and the line and column just after its last. Columns
+// count characters, not bytes.
+type Span struct {
+	Line      int `json:"line"`
+	Column    int `json:"column"`
+	EndLine   int `json:"end_line"`
+	EndColumn int `json:"end_column"`
+}
+
+// LedgerToken is one token of a ledger file. Text is the source text;
+// Value is the decoded string contents, the date with dashes, the tag or
+// link name, or the metadata key without its colon, and equals Text for
+// other tokens.
+type LedgerToken struct {
+	Kind  LedgerTokenKind `json:"kind"`
+	Text  string          `json:"text"`
+	Value string          `json:"value"`
+	Span  Span            `json:"span"`
+
+	off, end int
+}
+
+// ledgerLexer splits Beancount text into tokens. Whitespace between tokens
+// is skipped, except at the start of a line where it is an indent token.
+// Comments and newlines are tokens, so that the parser sees the line
+// structure.
+type ledgerLexer struct {
+	src       string
+	off       int
+	line, col int
+	lineStart bool
+	toks      []LedgerToken
+}
+
+// tokenizeLedger returns the tokens of text, ending with an EOF token.
+func tokenizeLedger(text string) []LedgerToken {
+	lx := &ledgerLexer{src: text, line: 1, col: 1, lineStart: true}
+	for lx.off < len(lx.src) {
+		lx.scan()
+	}
+	if n := len(lx.toks); n > 0 && lx.toks[n-1].Kind != TokenNewline {
+		lx.emit(TokenNewline, lx.off, lx.line, lx.col, "")
+	}
+	lx.emit(TokenEOF, lx.off, lx.line, lx.col, "")
+	return lx.toks
+}
+
+func (lx *ledgerLexer) peekRune(off int) rune {
+	if off >= len(lx.src) {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(lx.src[off:])
+	return r
+}
+
+// advance moves past one character, keeping track of lines and columns.
+func (lx *ledgerLexer) advance() rune {
+	r, size := utf8.DecodeRuneInString(lx.src[lx.off:])
+	lx.off += size
+	if r == '\n' {
+		lx.line++
+		lx.col = 1
+	} else {
+		lx.col++
+	}
+	return r
+}
+
+// emit appends the token that started at off, line and col and ends at the
+// current position.
+func (lx *ledgerLexer) emit(kind LedgerTokenKind, off, line, col int, value string) {
+	text := lx.src[off:lx.off]
+	if kind != TokenString && kind != TokenDate && kind != TokenTag && kind != TokenLink && kind != TokenKey && kind != TokenIllegal {
+		value = text
+	}
+	lx.toks = append(lx.toks, LedgerToken{
+		Kind:  kind,
+		Text:  text,
+		Value: value,
+		Span:  Span{Line: line, Column: col, EndLine: lx.line, EndColumn: lx.col},
+		off:   off,
+		end:   lx.off,
+	})
+}
+
+// restOfLineBlank reports whether only whitespace follows off on its line.
+func (lx *ledgerLexer) restOfLineBlank(off int) bool {
+	for ; off < len(lx.src); off++ {
+		switch lx.src[off] {
+		case ' ', '\t', '\r':
+		case '\n':
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (lx *ledgerLexer) scan() {
+	off, line, col := lx.off, lx.line, lx.col
+	r := lx.peekRune(lx.off)
+
+	if lx.lineStart {
+		lx.lineStart = false
+		if r == ' ' || r == '\t' {
+			for r == ' ' || r == '\t' {
+				lx.advance()
+				r = lx.peekRune(lx.off)
+			}
+			if !lx.restOfLineBlank(lx.off) {
+				lx.emit(TokenIndent, off, line, col, "")
+			}
+			return
+		}
+		// Org-mode headings, as Beancount allows for sectioning a ledger.
+		if r == '*' {
+			lx.scanToEOL()
+			lx.emit(TokenComment, off, line, col, "")
+			return
+		}
+	}
+
+	switch {
+	case r == '\n':
+		lx.advance()
+		lx.lineStart = true
+		lx.emit(TokenNewline, off, line, col, "")
+	case r == ' ' || r == '\t' || r == '\r':
+		lx.advance()
+	case unicode.IsSpace(r):
+		// Other spaces, such as the no-break spaces of pasted bank
+		// statements, separate tokens too.
+		lx.advance()
+	case r == ';':
+		lx.scanToEOL()
+		lx.emit(TokenComment, off, line, col, "")
+	case r == '"':
+		lx.scanString(off, line, col)
+	case isASCIIDigit(r):
+		lx.scanDateOrNumber(off, line, col)
+	case (r == '-' || r == '+') && startsNumber(lx.src[lx.off+1:]), r == '.' && startsNumber(lx.src[lx.off:]):
+		lx.advance()
+		lx.scanNumber()
+		lx.emit(TokenNumber, off, line, col, "")
+	case unicode.IsLetter(r):
+		lx.scanWord(off, line, col)
+	case (r == '#' || r == '^') && isTagRune(lx.peekRune(lx.off+1)):
+		lx.advance()
+		for isTagRune(lx.peekRune(lx.off)) {
+			lx.advance()
+		}
+		kind := TokenTag
+		if r == '^' {
+			kind = TokenLink
+		}
+		lx.emit(kind, off, line, col, lx.src[off+1:lx.off])
+	case strings.ContainsRune("*!&?%", r):
+		lx.advance()
+		lx.emit(TokenFlag, off, line, col, "")
+	case r == '{' || r == '}' || r == '@':
+		lx.advance()
+		if lx.peekRune(lx.off) == r {
+			lx.advance()
+		}
+		lx.emit(TokenPunct, off, line, col, "")
+	case strings.ContainsRune(",~()+-/", r):
+		lx.advance()
+		lx.emit(TokenPunct, off, line, col, "")
+	default:
+		lx.advance()
+		for lx.off < len(lx.src) && !unicode.IsSpace(lx.peekRune(lx.off)) {
+			lx.advance()
+		}
+		lx.emit(TokenIllegal, off, line, col, "unexpected "+lx.src[off:lx.off])
+	}
+}
+
+func (lx *ledgerLexer) scanToEOL() {
+	for lx.off < len(lx.src) && lx.src[lx.off] != '\n' {
+		lx.advance()
+	}
+	// The comment does not include the carriage return of a CRLF.
+	if lx.off > 0 && lx.src[lx.off-1] == '\r' {
+		lx.off--
+		lx.col--
+	}
+}
+
+// scanString scans a double-quoted string, which may span lines. A
+// backslash escapes a quote or a backslash; \n and \t stand for a newline
+// and a tab.
+func (lx *ledgerLexer) scanString(off, line, col int) {
+	lx.advance()
+	var b strings.Builder
+	for lx.off < len(lx.src) {
+		r := lx.advance()
+		switch r {
+		case '"':
+			lx.emit(TokenString, off, line, col, b.String())
+			return
+		case '\\':
+			if lx.off >= len(lx.src) {
+				continue
+			}
+			switch e := lx.advance(); e {
+			case 'n':
+				b.WriteRune('\n')
+			case 't':
+				b.WriteRune('\t')
+			case '"', '\\':
+				b.WriteRune(e)
+			default:
+				b.WriteRune('\\')
+				b.WriteRune(e)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	lx.emit(TokenIllegal, off, line, col, "unterminated string")
+}
+
+// scanDateOrNumber scans a YYYY-MM-DD or YYYY/MM/DD date, or a number.
+func (lx *ledgerLexer) scanDateOrNumber(off, line, col int) {
+	if s := lx.src[off:]; len(s) >= 10 && isDate(s[:10]) && (len(s) == 10 || !isWordRune(lx.peekRune(off+10))) {
+		for lx.off < off+10 {
+			lx.advance()
+		}
+		lx.emit(TokenDate, off, line, col, strings.ReplaceAll(s[:10], "/", "-"))
+		return
+	}
+	lx.scanNumber()
+	lx.emit(TokenNumber, off, line, col, "")
+}
+
+// scanNumber scans digits with optional thousands separators and an
+// optional decimal part.
+func (lx *ledgerLexer) scanNumber() {
+	for r := lx.peekRune(lx.off); isASCIIDigit(r) || r == ',' && isASCIIDigit(lx.peekRune(lx.off+1)); r = lx.peekRune(lx.off) {
+		lx.advance()
+	}
+	if lx.peekRune(lx.off) == '.' {
+		lx.advance()
+		for isASCIIDigit(lx.peekRune(lx.off)) {
+			lx.advance()
+		}
+	}
+}
+
+// scanWord scans a word and classifies it: a word ending in its only colon
+// is a metadata key, other words with colons are accounts, lower-case
+// words are keywords and the rest are currencies.
+func (lx *ledgerLexer) scanWord(off, line, col int) {
+	first := lx.peekRune(lx.off)
+	for isWordRune(lx.peekRune(lx.off)) {
+		lx.advance()
+	}
+	word := lx.src[off:lx.off]
+	colons := strings.Count(word, ":")
+	switch {
+	case colons == 1 && strings.HasSuffix(word, ":") && unicode.IsLower(first):
+		lx.emit(TokenKey, off, line, col, strings.TrimSuffix(word, ":"))
+	case colons > 0:
+		lx.emit(TokenAccount, off, line, col, "")
+	case unicode.IsLower(first):
+		lx.emit(TokenKeyword, off, line, col, "")
+	default:
+		lx.emit(TokenCurrency, off, line, col, "")
+	}
+}
+
+func isASCIIDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(":-_.'", r)
+}
+
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_/.", r)
+}
+
+// startsNumber reports whether s begins with a digit, or a point and a
+// digit.
+func startsNumber(s string) bool {
+	if s != "" && s[0] == '.' {
+		s = s[1:]
+	}
+	return s != "" && isASCIIDigit(rune(s[0]))
+}
+
+func isDate(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 4, 7:
+			if s[i] != '-' && s[i] != '/' {
+				return false
+			}
+		default:
+			if !isASCIIDigit(rune(s[i])) {
+				return false
+			}
+		}
+	}
+	return s[4] == s[7]
+}
@@ -0,0 +1,472 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// datedArgs lists, for each dated directive keyword, the kinds of its
+// required arguments. Further arguments, such as the currencies of an
+// open or the values of a custom directive, are allowed.
+var datedArgs = map[string][]LedgerTokenKind{
+	"open":      {TokenAccount},
+	"close":     {TokenAccount},
+	"balance":   {TokenAccount, TokenNumber, TokenCurrency},
+	"pad":       {TokenAccount, TokenAccount},
+	"commodity": {TokenCurrency},
+	"price":     {TokenCurrency, TokenNumber, TokenCurrency},
+	"event":     {TokenString, TokenString},
+	"note":      {TokenAccount, TokenString},
+	"document":  {TokenAccount, TokenString},
+	"query":     {TokenString, TokenString},
+	"custom":    {TokenString},
+}
+
+// undatedArgs is datedArgs for the directives that take no date.
+var undatedArgs = map[string][]LedgerTokenKind{
+	"option":  {TokenString, TokenString},
+	"include": {TokenString},
+	"plugin":  {TokenString},
+	"pushtag": {TokenTag},
+	"poptag":  {TokenTag},
+}
+
+// flagLetters are the letters Beancount accepts as transaction flags, in
+// addition to the symbols lexed as flag tokens.
+const flagLetters = "PSTCURM"
+
+// ParseBeancount parses the text of one Beancount file into its syntax
+// tree. name is recorded in the tree and its errors; it may be empty for
+// single-text ledgers. Parsing never fails: syntax errors are collected in
+// the tree, sorted by position.
+func ParseBeancount(name, text string) *LedgerFile {
+	p := &ledgerParser{src: text, toks: tokenizeLedger(text), file: &LedgerFile{Name: name, Directives: []*Directive{}}}
+	p.parse()
+	sortDiagnostics(p.file.Errors)
+	return p.file
+}
+
+type ledgerParser struct {
+	src  string
+	toks []LedgerToken
+	pos  int
+	file *LedgerFile
+
+	// last is the last token consumed other than a newline or a comment,
+	// where the span of the current directive ends.
+	last LedgerToken
+}
+
+func (p *ledgerParser) peek() LedgerToken {
+	return p.toks[p.pos]
+}
+
+func (p *ledgerParser) next() LedgerToken {
+	t := p.toks[p.pos]
+	if t.Kind == TokenEOF {
+		return t
+	}
+	p.pos++
+	if t.Kind != TokenNewline && t.Kind != TokenComment {
+		p.last = t
+	}
+	return t
+}
+
+// errorf records an error with the given code at span.
+func (p *ledgerParser) errorf(span Span, code string, format string, args ...interface{}) {
+	p.report(SeverityError, span, code, fmt.Sprintf(format, args...))
+}
+
+// warnf records a warning with the given code at span. Unlike errors,
+// warnings do not make the loader skip the directive.
+func (p *ledgerParser) warnf(span Span, code string, format string, args ...interface{}) {
+	p.report(SeverityWarning, span, code, fmt.Sprintf(format, args...))
+}
+
+func (p *ledgerParser) report(severity Severity, span Span, code, message string) {
+	p.file.Errors = append(p.file.Errors, SyntaxError{
+		File:     p.file.Name,
+		Span:     span,
+		Severity: severity,
+		Code:     code,
+		Message:  message,
+	})
+}
+
+// illegal reports the first illegal token of toks, if any, and returns
+// whether there was one.
+func (p *ledgerParser) illegal(toks []LedgerToken, context string) bool {
+	for _, t := range toks {
+		if t.Kind == TokenIllegal {
+			code := CodeUnexpectedToken
+			if t.Value == "unterminated string" {
+				code = CodeUnclosedString
+			}
+			p.errorf(t.Span, code, "%s%s", t.Value, context)
+			return true
+		}
+	}
+	return false
+}
+
+// restOfLine consumes the tokens up to the end of the line and returns
+// them without the newline and comments. Comments are kept in the file.
+func (p *ledgerParser) restOfLine() []LedgerToken {
+	var toks []LedgerToken
+	for {
+		t := p.next()
+		switch t.Kind {
+		case TokenNewline, TokenEOF:
+			return toks
+		case TokenComment:
+			p.file.Comments = append(p.file.Comments, t)
+		default:
+			toks = append(toks, t)
+		}
+	}
+}
+
+// span returns the span from the first to the last of toks.
+func span(toks []LedgerToken) Span {
+	return spanBetween(toks[0].Span, toks[len(toks)-1].Span)
+}
+
+// text returns the source text from the first to the last of toks.
+func (p *ledgerParser) text(toks []LedgerToken) string {
+	if len(toks) == 0 {
+		return ""
+	}
+	return p.src[toks[0].off:toks[len(toks)-1].end]
+}
+
+func (p *ledgerParser) parse() {
+	for {
+		t := p.peek()
+		switch {
+		case t.Kind == TokenEOF:
+			return
+		case t.Kind == TokenNewline, t.Kind == TokenComment:
+			p.restOfLine()
+		case t.Kind == TokenIndent:
+			p.next()
+			if toks := p.restOfLine(); len(toks) > 0 {
+				p.errorf(span(toks), CodeUnexpectedIndent, "unexpected indented line outside of a transaction")
+			}
+		case t.Kind == TokenDate:
+			p.parseDated()
+		case t.Kind == TokenKeyword && undatedArgs[t.Value] != nil:
+			p.next()
+			d := &Directive{Kind: t.Value, Span: t.Span}
+			p.parseDirective(d, undatedArgs[t.Value])
+		default:
+			toks := p.restOfLine()
+			p.errorf(span(toks), CodeUnrecognizedLine, "unrecognized line: %s", p.text(toks))
+		}
+	}
+}
+
+// parseDated parses a directive that starts with a date.
+func (p *ledgerParser) parseDated() {
+	date := p.next()
+	if _, err := time.Parse("2006-01-02", date.Value); err != nil {
+		p.errorf(date.Span, CodeInvalidDate, "invalid date %s", date.Text)
+	}
+	d := &Directive{Date: date.Value, Span: date.Span}
+	head := p.peek()
+	switch {
+	case head.Kind == TokenNewline, head.Kind == TokenEOF, head.Kind == TokenComment:
+		p.restOfLine()
+		p.errorf(date.Span, CodeMissingDirective, "missing directive after date")
+	case head.Kind == TokenFlag, head.Kind == TokenKeyword && head.Value == "txn",
+		head.Kind == TokenCurrency && len(head.Text) == 1 && strings.Contains(flagLetters, head.Text):
+		p.next()
+		d.Kind = "transaction"
+		d.Flag = head.Text
+		if head.Value == "txn" {
+			d.Flag = "*"
+		}
+		p.parseTransaction(d)
+		p.file.Directives = append(p.file.Directives, d)
+	case head.Kind == TokenString:
+		// Parse the rest as a transaction, so that its postings are not
+		// reported as well, but leave it out of the tree.
+		p.errorf(head.Span, CodeMissingFlag, "transaction must have a flag (* or !)")
+		p.parseTransaction(d)
+	case head.Kind == TokenKeyword && datedArgs[head.Value] != nil:
+		p.next()
+		d.Kind = head.Value
+		p.parseDirective(d, datedArgs[head.Value])
+	default:
+		p.restOfLine()
+		p.errorf(head.Span, CodeUnknownDirective, "unknown directive: %s", head.Text)
+	}
+}
+
+// parseDirective parses the arguments and metadata of a directive other
+// than a transaction, and adds it to the tree if its required arguments
+// are present.
+func (p *ledgerParser) parseDirective(d *Directive, required []LedgerTokenKind) {
+	keyword := p.last.Span
+	d.Args = p.restOfLine()
+	ok := !p.illegal(d.Args, "")
+	for i, kind := range required {
+		if !ok {
+			break
+		}
+		if i >= len(d.Args) || d.Args[i].Kind != kind {
+			// Point at the wrong argument, or at the keyword when the
+			// arguments stop short.
+			at := keyword
+			if i < len(d.Args) {
+				at = d.Args[i].Span
+			}
+			p.errorf(at, CodeDirectiveArguments, "%s directive requires %s", d.Kind, describeArgs(required))
+			ok = false
+		}
+	}
+	for _, t := range d.Args {
+		if t.Kind == TokenAccount {
+			d.Account = t.Text
+			break
+		}
+	}
+	p.parseBody(d, false)
+	d.Span = spanBetween(d.Span, p.last.Span)
+	if ok {
+		switch d.Kind {
+		case "option":
+			p.checkOption(d)
+		case "plugin":
+			if name := d.Args[0]; lookupPlugin(name.Value) == nil {
+				p.warnf(name.Span, CodeUnknownPlugin, "unknown plugin %q is ignored; only built-in plugins can run", name.Value)
+			}
+		}
+		p.file.Directives = append(p.file.Directives, d)
+	}
+}
+
+// checkOption reports an option with an invalid value as an error, and
+// one with an unknown name as a warning.
+func (p *ledgerParser) checkOption(d *Directive) {
+	name, value := d.Args[0], d.Args[1]
+	opts := DefaultOptions()
+	switch err := opts.set(name.Value, value.Value); {
+	case err == errUnknownOption:
+		p.warnf(name.Span, CodeUnknownOption, "unknown option %q", name.Value)
+	case err != nil:
+		p.errorf(value.Span, CodeInvalidOption, "option %s: %v", name.Value, err)
+	}
+}
+
+// describeArgs describes required arguments for an error message, as in
+// "an account and an amount".
+func describeArgs(kinds []LedgerTokenKind) string {
+	var parts []string
+	for i := 0; i < len(kinds); i++ {
+		var part string
+		switch kinds[i] {
+		case TokenAccount:
+			part = "an account"
+		case TokenNumber:
+			part = "an amount"
+			i++ // the currency of the amount
+		case TokenCurrency:
+			part = "a currency"
+		case TokenString:
+			part = "a string"
+		case TokenTag:
+			part = "a tag"
+		}
+		if n := len(parts); n > 0 && parts[n-1] == part {
+			parts[n-1] = "two " + strings.TrimPrefix(strings.TrimPrefix(part, "an "), "a ") + "s"
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " and ")
+}
+
+// parseTransaction parses the header after the flag and the postings of a
+// transaction.
+func (p *ledgerParser) parseTransaction(d *Directive) {
+	header := spanBetween(d.Span, p.last.Span)
+	d.Args = p.restOfLine()
+	if len(d.Args) > 0 {
+		header = spanBetween(header, d.Args[len(d.Args)-1].Span)
+	}
+
+	var strs []string
+	var stray []LedgerToken
+	for _, t := range d.Args {
+		switch t.Kind {
+		case TokenString:
+			strs = append(strs, t.Value)
+		case TokenTag:
+			d.Tags = append(d.Tags, t.Value)
+		case TokenLink:
+			d.Links = append(d.Links, t.Value)
+		default:
+			stray = append(stray, t)
+		}
+	}
+	switch {
+	case len(d.Args) == 0:
+		p.errorf(header, CodeMissingNarration, "transaction missing narration")
+	case p.illegal(stray, " in transaction header"):
+	case len(strs) == 0:
+		p.errorf(span(d.Args), CodeUnquotedNarration, "transaction narration must be quoted")
+	case len(strs) > 2:
+		p.errorf(span(d.Args), CodeTxnHeader, "transaction has more than a payee and a narration")
+	case len(stray) > 0:
+		p.errorf(stray[0].Span, CodeTxnHeader, "unexpected %s in transaction header", stray[0].Text)
+	}
+	switch len(strs) {
+	case 0:
+	case 1:
+		d.Narration = strs[0]
+	default:
+		d.Payee, d.Narration = strs[0], strs[1]
+	}
+
+	p.parseBody(d, true)
+	d.Span = spanBetween(d.Span, p.last.Span)
+	if len(d.Postings) == 0 {
+		p.errorf(header, CodeTxnNoPostings, "transaction has no postings")
+	}
+}
+
+// parseBody parses the indented lines after a directive header: metadata,
+// and the postings of a transaction. Metadata indented deeper than the
+// posting before it belongs to that posting.
+func (p *ledgerParser) parseBody(d *Directive, txn bool) {
+	postingIndent := 0
+	for p.peek().Kind == TokenIndent {
+		indent := p.next()
+		toks := p.restOfLine()
+		switch {
+		case len(toks) == 0:
+		case toks[0].Kind == TokenKey:
+			item := p.parseMeta(toks)
+			if item == nil {
+				continue
+			}
+			if n := len(d.Postings); n > 0 && len(indent.Text) > postingIndent {
+				d.Postings[n-1].Meta = append(d.Postings[n-1].Meta, item)
+			} else {
+				d.Meta = append(d.Meta, item)
+			}
+		case !txn:
+			p.errorf(span(toks), CodeUnexpectedIndent, "unexpected indented line outside of a transaction")
+		default:
+			posting, bad := p.parsePosting(toks)
+			if posting == nil {
+				at := toks[len(toks)-1].Span
+				if bad < len(toks) {
+					at = toks[bad].Span
+				}
+				p.errorf(at, CodeInvalidPosting, "invalid posting syntax: %s", p.text(toks))
+				continue
+			}
+			for _, a := range []*AmountNode{posting.Amount, posting.Price} {
+				if a == nil {
+					continue
+				}
+				if _, err := parseNumber(a.Number); err != nil {
+					p.errorf(a.Span, CodeInvalidAmount, "invalid amount %q: %v", a.Number, err.(*strconv.NumError).Err)
+				}
+			}
+			d.Postings = append(d.Postings, posting)
+			postingIndent = len(indent.Text)
+		}
+	}
+}
+
+// parseMeta parses a metadata line. The value is a single token or an
+// amount.
+func (p *ledgerParser) parseMeta(toks []LedgerToken) *MetaItem {
+	item := &MetaItem{Key: toks[0].Value, Span: span(toks)}
+	value := toks[1:]
+	switch {
+	case len(value) == 0:
+	case len(value) == 1 && value[0].Kind != TokenIllegal && value[0].Kind != TokenPunct:
+	case len(value) == 2 && value[0].Kind == TokenNumber && value[1].Kind == TokenCurrency:
+	default:
+		p.errorf(span(value), CodeInvalidMetadata, "invalid metadata: %s", p.text(toks))
+		return nil
+	}
+	item.Value = p.text(value)
+	return item
+}
+
+// parsePosting parses the tokens of a posting line: an optional flag, the
+// account, and an optional amount, cost and price. If the line is not a
+// posting it returns nil and the index of the first token that does not
+// fit, or len(toks) when the line stops short.
+func (p *ledgerParser) parsePosting(toks []LedgerToken) (*PostingNode, int) {
+	pn := &PostingNode{Span: span(toks)}
+	i := 0
+	if toks[i].Kind == TokenFlag {
+		pn.Flag = toks[i].Text
+		i++
+	}
+	if i >= len(toks) || toks[i].Kind != TokenAccount {
+		return nil, i
+	}
+	pn.Account = toks[i].Text
+	pn.AccountSpan = toks[i].Span
+	i++
+
+	if i < len(toks) && toks[i].Kind == TokenNumber {
+		if pn.Amount = amountAt(toks, i); pn.Amount == nil {
+			return nil, i + 1
+		}
+		i += 2
+	}
+	if i < len(toks) && (toks[i].Text == "{" || toks[i].Text == "{{") {
+		closing := strings.Repeat("}", len(toks[i].Text))
+		j := i + 1
+		for j < len(toks) && toks[j].Text != closing {
+			j++
+		}
+		if j == len(toks) {
+			return nil, i
+		}
+		pn.Cost = p.text(toks[i : j+1])
+		i = j + 1
+	}
+	if i < len(toks) && (toks[i].Text == "@" || toks[i].Text == "@@") {
+		pn.TotalPrice = toks[i].Text == "@@"
+		if pn.Price = amountAt(toks, i+1); pn.Price == nil {
+			if i+1 < len(toks) && toks[i+1].Kind == TokenNumber {
+				return nil, i + 2
+			}
+			return nil, i + 1
+		}
+		i += 3
+	}
+	if i != len(toks) {
+		return nil, i
+	}
+	return pn, 0
+}
+
+// amountAt returns the amount made of the number and currency tokens at
+// toks[i], or nil if there is none.
+func amountAt(toks []LedgerToken, i int) *AmountNode {
+	if i+1 >= len(toks) || toks[i].Kind != TokenNumber || toks[i+1].Kind != TokenCurrency {
+		return nil
+	}
+	return &AmountNode{
+		Number:   toks[i].Text,
+		Currency: toks[i+1].Text,
+		Span:     spanBetween(toks[i].Span, toks[i+1].Span),
+	}
+}
+
+// spanBetween returns the span from the start of first to the end of last.
+func spanBetween(first, last Span) Span {
+	return Span{Line: first.Line, Column: first.Column, EndLine: last.EndLine, EndColumn: last.EndColumn}
+}
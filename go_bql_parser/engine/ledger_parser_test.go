@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestTokenizeLedger(t *testing.T) {
+	toks := tokenizeLedger("2024-01-15 * \"Café\" #trip ^inv-1 ; note\n  Assets:Cash  -1,200.50 USD {10 EUR}\n")
+	want := []struct {
+		kind  LedgerTokenKind
+		value string
+	}{
+		{TokenDate, "2024-01-15"}, {TokenFlag, "*"}, {TokenString, "Café"}, {TokenTag, "trip"},
+		{TokenLink, "inv-1"}, {TokenComment, "; note"}, {TokenNewline, "\n"},
+		{TokenIndent, "  "}, {TokenAccount, "Assets:Cash"}, {TokenNumber, "-1,200.50"}, {TokenCurrency, "USD"},
+		{TokenPunct, "{"}, {TokenNumber, "10"}, {TokenCurrency, "EUR"}, {TokenPunct, "}"},
+		{TokenNewline, "\n"}, {TokenEOF, ""},
+	}
+	if len(toks) != len(want) {
+		t.Fatalf("expected %d tokens, got %d: %+v", len(want), len(toks), toks)
+	}
+	for i, w := range want {
+		if toks[i].Kind != w.kind || toks[i].Value != w.value {
+			t.Errorf("token %d: expected %s %q, got %s %q", i, w.kind, w.value, toks[i].Kind, toks[i].Value)
+		}
+	}
+	// Columns count characters: the é of Café is one column.
+	if tag := toks[3].Span; tag.Line != 1 || tag.Column != 21 || tag.EndColumn != 26 {
+		t.Errorf("unexpected tag span %+v", tag)
+	}
+}
+
+// TestTokenizeLedgerSpaces checks that spaces other than ASCII ones, as in
+// pasted bank statements, separate tokens rather than stall the lexer.
+func TestTokenizeLedgerSpaces(t *testing.T) {
+	for _, space := range []string{"\u00a0", "\v", "\f", "\u2003"} {
+		toks := tokenizeLedger("  Assets:Cash" + space + " 10" + space + "USD\n")
+		var got []LedgerTokenKind
+		for _, tok := range toks {
+			got = append(got, tok.Kind)
+		}
+		want := []LedgerTokenKind{TokenIndent, TokenAccount, TokenNumber, TokenCurrency, TokenNewline, TokenEOF}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %v, got %v", space, want, got)
+		}
+	}
+	// A character the lexer does not know is one illegal token, however
+	// short.
+	toks := tokenizeLedger("\u00a7\u00a0x")
+	if toks[0].Kind != TokenIllegal || toks[0].Text != "\u00a7" {
+		t.Errorf("expected an illegal token for \u00a7, got %+v", toks[0])
+	}
+
+	ledger := ParseLedger("2024-01-02 * \"Shop\"\n  Expenses:Food\u00a0 10.00 USD\n  Assets:Cash\n")
+	if len(ledger.Errors) != 0 || len(ledger.Transactions) != 1 || len(ledger.Transactions[0].Postings) != 2 {
+		t.Errorf("expected a transaction of two postings, got %+v", ledger)
+	}
+}
+
+func TestParseBeancount(t *testing.T) {
+	input := `option "title" "Test"
+include "other.beancount"
+
+2024-01-01 open Assets:Cash USD, EUR
+  description: "Wallet"
+
+2024-02-01 txn "Shop" "Shoes" #clothes
+  id: 42
+  Expenses:Clothes   30.00 EUR @ 1.10 USD
+    receipt: "r.pdf"
+  ! Assets:Cash     -33.00 USD
+  Assets:Broker       2 AAPL {150.00 USD} @@ 310.00 USD
+`
+	file := ParseBeancount("main.beancount", input)
+	if len(file.Errors) != 0 {
+		t.Fatalf("unexpected errors: %+v", file.Errors)
+	}
+	if len(file.Directives) != 4 {
+		t.Fatalf("expected 4 directives, got %d", len(file.Directives))
+	}
+
+	option := file.Directives[0]
+	if option.Kind != "option" || option.Strings()[1] != "Test" {
+		t.Errorf("unexpected option %+v", option)
+	}
+	if file.Directives[1].Kind != "include" || file.Directives[1].Strings()[0] != "other.beancount" {
+		t.Errorf("unexpected include %+v", file.Directives[1])
+	}
+
+	open := file.Directives[2]
+	if open.Kind != "open" || open.Account != "Assets:Cash" || len(open.Meta) != 1 || open.Meta[0].Value != `"Wallet"` {
+		t.Errorf("unexpected open %+v", open)
+	}
+	if open.Span != (Span{Line: 4, Column: 1, EndLine: 5, EndColumn: 24}) {
+		t.Errorf("unexpected open span %+v", open.Span)
+	}
+
+	txn := file.Directives[3]
+	if txn.Kind != "transaction" || txn.Flag != "*" || txn.Payee != "Shop" || txn.Narration != "Shoes" {
+		t.Errorf("unexpected transaction header %+v", txn)
+	}
+	if len(txn.Tags) != 1 || txn.Tags[0] != "clothes" || len(txn.Meta) != 1 || txn.Meta[0].Key != "id" {
+		t.Errorf("unexpected tags or metadata %+v %+v", txn.Tags, txn.Meta)
+	}
+	if len(txn.Postings) != 3 {
+		t.Fatalf("expected 3 postings, got %d", len(txn.Postings))
+	}
+	shoes := txn.Postings[0]
+	if shoes.Amount.Number != "30.00" || shoes.Price.Currency != "USD" || shoes.TotalPrice || len(shoes.Meta) != 1 {
+		t.Errorf("unexpected posting %+v", shoes)
+	}
+	if shoes.AccountSpan != (Span{Line: 9, Column: 3, EndLine: 9, EndColumn: 19}) {
+		t.Errorf("unexpected account span %+v", shoes.AccountSpan)
+	}
+	if txn.Postings[1].Flag != "!" {
+		t.Errorf("expected flagged posting, got %+v", txn.Postings[1])
+	}
+	if broker := txn.Postings[2]; broker.Cost != "{150.00 USD}" || !broker.TotalPrice {
+		t.Errorf("unexpected posting %+v", broker)
+	}
+}
+
+func TestParseBeancountErrors(t *testing.T) {
+	input := `2024-01-01 balance Assets:Cash
+2024-01-01 pad Assets:Cash
+option "title"
+
+2024-01-02 * "Shop" "Things" stray
+  Assets:Cash 10
+  Expenses:Misc
+
+2024-01-03 * "Shop" "Garbled
+`
+	file := ParseBeancount("", input)
+	want := []struct {
+		line, column int
+		code         string
+		message      string
+	}{
+		{1, 12, CodeDirectiveArguments, "balance directive requires an account and an amount"},
+		{2, 12, CodeDirectiveArguments, "pad directive requires two accounts"},
+		{3, 1, CodeDirectiveArguments, "option directive requires two strings"},
+		{5, 30, CodeTxnHeader, "unexpected stray in transaction header"},
+		{6, 15, CodeInvalidPosting, "invalid posting syntax: Assets:Cash 10"},
+		{9, 1, CodeTxnNoPostings, "transaction has no postings"},
+		{9, 21, CodeUnclosedString, "unterminated string in transaction header"},
+	}
+	if len(file.Errors) != len(want) {
+		t.Fatalf("expected %d errors, got %+v", len(want), file.Errors)
+	}
+	for i, w := range want {
+		e := file.Errors[i]
+		if e.Line != w.line || e.Column != w.column || e.Code != w.code || e.Message != w.message {
+			t.Errorf("error %d: expected %d:%d %s %s, got %d:%d %s %s", i, w.line, w.column, w.code, w.message, e.Line, e.Column, e.Code, e.Message)
+		}
+		if e.Severity != SeverityError {
+			t.Errorf("error %d: expected severity error, got %s", i, e.Severity)
+		}
+	}
+	if len(file.Directives) != 2 {
+		t.Errorf("expected the two transactions, got %+v", file.Directives)
+	}
+}
+
+// TestParserAndLoaderAgree checks that the loader builds its transactions
+// from the same tree the checker reports on: the transaction of a posting
+// reported as invalid is the one missing from the ledger, and the ledger
+// reports the same errors.
+func TestParserAndLoaderAgree(t *testing.T) {
+	input := `2024-01-01 * "Shop" "Things"
+  Expenses:Misc   10.00 USD
+  Assets:Cash     -10.00
+
+2024-01-02 * "Shop" "More things"
+  Expenses:Misc   5.00 USD
+  Assets:Cash
+`
+	errs := CheckSyntax(input).Errors
+	if len(errs) != 1 || errs[0].Line != 3 {
+		t.Fatalf("expected one error on line 3, got %+v", errs)
+	}
+	ledger := ParseLedger(input)
+	if len(ledger.Transactions) != 1 || ledger.Transactions[0].Narration != "More things" {
+		t.Errorf("expected only the valid transaction, got %+v", ledger.Transactions)
+	}
+	if !reflect.DeepEqual(ledger.Errors, errs) {
+		t.Errorf("expected the checker's errors %+v, got %+v", errs, ledger.Errors)
+	}
+
+	data, err := os.ReadFile("testdata/sample.beancount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := ParseBeancount("sample.beancount", string(data))
+	ledger = buildLedger(file)
+	txns := 0
+	for _, d := range file.Directives {
+		if d.Kind == "transaction" {
+			txns++
+		}
+	}
+	if txns == 0 || txns != len(ledger.Transactions) || ledger.Transactions[0].File != "sample.beancount" {
+		t.Errorf("expected %d transactions from sample.beancount, got %d", txns, len(ledger.Transactions))
+	}
+}
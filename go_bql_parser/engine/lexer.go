@@ -0,0 +1,247 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"unicode"
+)
+
+// BQLLexer holds the state of the scanner.
+type BQLLexer struct {
+	scanner.Scanner
+	err error
+
+	// results holds the statements parsed so far, in script order.
+	results []*Query
+
+	// tokens records every token handed to the parser, so that errors can
+	// point at the offending token and the expected set can be recomputed.
+	tokens []lexToken
+
+	// replay, when non-nil, is fed to the parser instead of scanning input.
+	// replayPos is the number of replayed tokens consumed and errAt the value
+	// of replayPos when the parser reported an error (-1 if it did not).
+	replay    []lexToken
+	replayPos int
+	errAt     int
+
+	// positional counts the ? parameters scanned so far.
+	positional int
+}
+
+// lexToken is a single token as returned to the parser.
+type lexToken struct {
+	tok  int
+	str  string
+	text string
+	pos  scanner.Position
+}
+
+// NewBQLLexer creates a new lexer for the given BQL query string.
+func NewBQLLexer(query string) *BQLLexer {
+	var s scanner.Scanner
+	s.Init(strings.NewReader(query))
+	// Identifiers are Unicode letters, digits and underscores, not starting
+	// with a digit. A '-' is left to the parser, so that "--" starts a
+	// comment.
+	s.IsIdentRune = func(ch rune, i int) bool {
+		return ch == '_' || unicode.IsLetter(ch) || (i > 0 && unicode.IsDigit(ch))
+	}
+	// Removing ScanChars is the key fix. This allows identifiers to be scanned correctly.
+	s.Mode = scanner.ScanIdents | scanner.ScanFloats
+	// Errors are reported through the parser, not printed to stderr.
+	s.Error = func(*scanner.Scanner, string) {}
+
+	return &BQLLexer{Scanner: s, errAt: -1}
+}
+
+// keywordMap maps BQL keywords to their token types.
+var keywordMap = map[string]int{
+	"SELECT": SELECT, "FROM": FROM, "WHERE": WHERE,
+	"GROUP": GROUP, "ORDER": ORDER, "BY": BY,
+	"ASC": ASC, "DESC": DESC, "IN": IN, "PIVOT": PIVOT,
+	"PRINT": PRINT,
+}
+
+// Lex is the main scanner function.
+func (l *BQLLexer) Lex(lval *yySymType) int {
+	if l.replay != nil {
+		if l.replayPos >= len(l.replay) {
+			return 0
+		}
+		t := l.replay[l.replayPos]
+		l.replayPos++
+		lval.str = t.str
+		return t.tok
+	}
+
+	t := l.scan()
+	l.tokens = append(l.tokens, t)
+	lval.str = t.str
+	return t.tok
+}
+
+func (l *BQLLexer) scan() lexToken {
+	tok := l.Scan()
+	pos := l.Position
+	if !pos.IsValid() {
+		pos = l.Pos()
+	}
+
+	switch {
+	case tok == '-' && l.Peek() == '-':
+		// A line comment runs to the end of the line.
+		for ch := l.Peek(); ch != '\n' && ch != scanner.EOF; ch = l.Peek() {
+			l.Next()
+		}
+		return l.scan()
+	case tok == '/' && l.Peek() == '*':
+		if !l.skipBlockComment() {
+			l.err = l.lexError(CodeUnclosedComment, "unclosed comment", pos)
+			return lexToken{tok: 0, pos: pos}
+		}
+		return l.scan()
+	case tok == '\'' || tok == '"':
+		return l.scanString(tok, pos)
+	}
+
+	switch tok {
+	case scanner.EOF:
+		return lexToken{tok: 0, pos: pos}
+	case '=':
+		return lexToken{tok: EQ, text: "=", pos: pos}
+	case '?':
+		l.positional++
+		return lexToken{tok: PARAM, str: strconv.Itoa(l.positional), text: "?", pos: pos}
+	case ':':
+		// A named parameter is a colon directly followed by an identifier.
+		if next := l.Peek(); next == '_' || unicode.IsLetter(next) {
+			l.Scan()
+			return lexToken{tok: PARAM, str: l.TokenText(), text: ":" + l.TokenText(), pos: pos}
+		}
+	case scanner.Int, scanner.Float:
+		return lexToken{tok: NUMBER, str: l.TokenText(), text: l.TokenText(), pos: pos}
+	}
+
+	if tok == scanner.Ident {
+		keyword := strings.ToUpper(l.TokenText())
+		if tokType, isKeyword := keywordMap[keyword]; isKeyword {
+			return lexToken{tok: tokType, str: l.TokenText(), text: l.TokenText(), pos: pos}
+		}
+		return lexToken{tok: IDENT, str: l.TokenText(), text: l.TokenText(), pos: pos}
+	}
+
+	return lexToken{tok: int(tok), text: l.TokenText(), pos: pos}
+}
+
+// scanString reads a string literal up to the closing quote, which has
+// already been scanned. Inside the literal, a doubled quote or a quote
+// after a backslash stands for the quote itself, and \\, \n and \t for a
+// backslash, newline and tab. Other backslashes are kept as written.
+func (l *BQLLexer) scanString(quote rune, pos scanner.Position) lexToken {
+	var value, text strings.Builder
+	text.WriteRune(quote)
+	for {
+		ch := l.Next()
+		if ch == scanner.EOF {
+			l.err = l.lexError(CodeUnclosedString, "unclosed string literal", pos)
+			return lexToken{tok: 0, pos: pos}
+		}
+		text.WriteRune(ch)
+		switch {
+		case ch == quote && l.Peek() == quote:
+			text.WriteRune(l.Next())
+			value.WriteRune(quote)
+		case ch == quote:
+			return lexToken{tok: STRING, str: value.String(), text: text.String(), pos: pos}
+		case ch == '\\':
+			switch next := l.Peek(); next {
+			case '\'', '"', '\\':
+				value.WriteRune(next)
+			case 'n':
+				value.WriteRune('\n')
+			case 't':
+				value.WriteRune('\t')
+			default:
+				value.WriteRune(ch)
+				continue
+			}
+			text.WriteRune(l.Next())
+		default:
+			value.WriteRune(ch)
+		}
+	}
+}
+
+// skipBlockComment consumes a /* */ comment whose "/" has been scanned. It
+// reports whether the comment was closed.
+func (l *BQLLexer) skipBlockComment() bool {
+	l.Next() // Consume the '*'.
+	for {
+		switch l.Next() {
+		case scanner.EOF:
+			return false
+		case '*':
+			if l.Peek() == '/' {
+				l.Next()
+				return true
+			}
+		}
+	}
+}
+
+// lexError returns an error found while scanning the token at pos, before
+// the parser has seen it.
+func (l *BQLLexer) lexError(code, message string, pos scanner.Position) *ParseError {
+	return &ParseError{
+		Code:       code,
+		Message:    message,
+		Line:       pos.Line,
+		Column:     pos.Column,
+		Offset:     pos.Offset,
+		tokenIndex: -1,
+	}
+}
+
+// Error is called by the parser on a syntax error.
+func (l *BQLLexer) Error(e string) {
+	if l.replay != nil {
+		if l.errAt < 0 {
+			l.errAt = l.replayPos
+		}
+		return
+	}
+	if l.err != nil {
+		return
+	}
+	if len(l.tokens) == 0 {
+		l.err = &ParseError{Code: CodeSyntax, Message: e, Line: 1, Column: 1, tokenIndex: -1}
+		return
+	}
+	last := len(l.tokens) - 1
+	t := l.tokens[last]
+	l.err = &ParseError{
+		Code:       CodeSyntax,
+		Message:    "syntax error: unexpected " + describeToken(t),
+		Line:       t.pos.Line,
+		Column:     t.pos.Column,
+		Offset:     t.pos.Offset,
+		Token:      t.text,
+		tokenIndex: last,
+	}
+}
+
+// describeToken renders a token for use in an error message. Tokens that
+// carry a value are shown together with their source text.
+func describeToken(t lexToken) string {
+	name := tokenDisplayName(t.tok)
+	switch t.tok {
+	case IDENT:
+		return fmt.Sprintf("%s %q", name, t.text)
+	case STRING, NUMBER, PARAM:
+		return fmt.Sprintf("%s %s", name, t.text)
+	}
+	return name
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileSource provides the files of a multi-file ledger to the loader.
+// Names are slash-separated paths.
+type FileSource interface {
+	ReadFile(name string) ([]byte, error)
+	Glob(pattern string) ([]string, error)
+}
+
+// MapSource is an in-memory FileSource mapping paths to file contents.
+type MapSource map[string]string
+
+func (m MapSource) ReadFile(name string) ([]byte, error) {
+	name = path.Clean(name)
+	if text, ok := m[name]; ok {
+		return []byte(text), nil
+	}
+	for p, text := range m {
+		if path.Clean(p) == name {
+			return []byte(text), nil
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m MapSource) Glob(pattern string) ([]string, error) {
+	var matches []string
+	for p := range m {
+		ok, err := path.Match(pattern, path.Clean(p))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, path.Clean(p))
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// DiskSource reads ledger files from the host filesystem. Inside the WASM
+// component this only works for directories the host has preopened.
+type DiskSource struct{}
+
+func (DiskSource) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.FromSlash(name))
+}
+
+func (DiskSource) Glob(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.FromSlash(pattern))
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range matches {
+		matches[i] = filepath.ToSlash(m)
+	}
+	return matches, nil
+}
+
+// SourceFile is one file read while loading a ledger, with its syntax
+// tree.
+type SourceFile struct {
+	Name   string
+	Text   string
+	Parsed *LedgerFile
+}
+
+// LoadLedger parses the ledger file entry from src and every file it
+// includes. Include paths are resolved relative to the including file and
+// may be glob patterns; a file included more than once is loaded once.
+// Transactions are tagged with the file and line they came from, the
+// options of every file apply to the whole ledger, and the plugins of
+// every file run once all files are loaded. The returned source files are
+// in load order, and are returned even when loading fails part way.
+func LoadLedger(src FileSource, entry string) (*Ledger, []SourceFile, error) {
+	l := &loader{src: src, ledger: newLedger(), loaded: make(map[string]bool)}
+	if err := l.load(path.Clean(entry), "", 0); err != nil {
+		return nil, l.files, err
+	}
+	l.ledger.finish()
+	return l.ledger, l.files, nil
+}
+
+type loader struct {
+	src    FileSource
+	ledger *Ledger
+	files  []SourceFile
+	loaded map[string]bool
+	stack  []string
+}
+
+// load parses name, which was included from line of file from (empty for
+// the entry file).
+func (l *loader) load(name string, from string, line int) error {
+	for i, open := range l.stack {
+		if open == name {
+			cycle := append(append([]string{}, l.stack[i:]...), name)
+			return &CodedError{
+				Code:    CodeIncludeCycle,
+				Message: "include cycle: " + strings.Join(cycle, " -> "),
+				File:    from,
+				Line:    line,
+			}
+		}
+	}
+	if l.loaded[name] {
+		return nil
+	}
+
+	data, err := l.src.ReadFile(name)
+	if err != nil {
+		return &CodedError{
+			Code:    CodeIncludeNotFound,
+			Message: fmt.Sprintf("cannot read ledger file %s: %v", name, err),
+			File:    from,
+			Line:    line,
+		}
+	}
+	l.loaded[name] = true
+	parsed := ParseBeancount(name, string(data))
+	l.files = append(l.files, SourceFile{Name: name, Text: string(data), Parsed: parsed})
+
+	l.stack = append(l.stack, name)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	return appendLedgerFile(l.ledger, parsed, func(pattern string, includeLine int) error {
+		return l.include(name, pattern, includeLine)
+	})
+}
+
+// include loads the files matched by an include directive of file.
+func (l *loader) include(file string, pattern string, line int) error {
+	if !path.IsAbs(pattern) {
+		pattern = path.Join(path.Dir(file), pattern)
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return l.load(path.Clean(pattern), file, line)
+	}
+
+	matches, err := l.src.Glob(pattern)
+	if err != nil {
+		return &CodedError{
+			Code:    CodeIncludeNotFound,
+			Message: fmt.Sprintf("invalid include pattern %s: %v", pattern, err),
+			File:    file,
+			Line:    line,
+		}
+	}
+	if len(matches) == 0 {
+		return &CodedError{
+			Code:    CodeIncludeNotFound,
+			Message: fmt.Sprintf("include pattern %s matched no files", pattern),
+			File:    file,
+			Line:    line,
+		}
+	}
+	for _, m := range matches {
+		if err := l.load(m, file, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var multiFileLedger = MapSource{
+	"main.beancount": `option "title" "Household"
+
+include "accounts.beancount"
+include "years/*.beancount"
+
+2024-03-01 * "Landlord" "March rent"
+  Expenses:Rent    1500.00 USD
+  Assets:Checking -1500.00 USD
+`,
+	"accounts.beancount": `2014-01-01 open Assets:Checking USD
+2014-01-01 open Expenses:Rent USD
+`,
+	"years/2023.beancount": `include "../accounts.beancount"
+
+2023-12-01 * "Landlord" "December rent"
+  Expenses:Rent    1400.00 USD
+  Assets:Checking -1400.00 USD
+`,
+	"years/2024.beancount": `2024-01-01 * "Landlord" "January rent"
+  Expenses:Rent    1500.00 USD
+  Assets:Checking -1500.00 USD
+`,
+}
+
+func TestLoadLedgerFollowsIncludes(t *testing.T) {
+	ledger, files, err := LoadLedger(multiFileLedger, "main.beancount")
+	if err != nil {
+		t.Fatalf("LoadLedger failed: %v", err)
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	wantNames := []string{"main.beancount", "accounts.beancount", "years/2023.beancount", "years/2024.beancount"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("loaded files = %v, want %v", names, wantNames)
+	}
+
+	if len(ledger.Transactions) != 3 {
+		t.Fatalf("expected 3 transactions, got %d", len(ledger.Transactions))
+	}
+	var sources []string
+	for _, txn := range ledger.Transactions {
+		sources = append(sources, txn.File+":"+txn.Narration)
+	}
+	wantSources := []string{"years/2023.beancount:December rent", "years/2024.beancount:January rent", "main.beancount:March rent"}
+	if !reflect.DeepEqual(sources, wantSources) {
+		t.Errorf("transaction sources = %v, want %v", sources, wantSources)
+	}
+	if ledger.Transactions[0].Line != 3 {
+		t.Errorf("expected December rent on line 3, got %d", ledger.Transactions[0].Line)
+	}
+	if ledger.Transactions[2].Line != 6 {
+		t.Errorf("expected March rent on line 6, got %d", ledger.Transactions[2].Line)
+	}
+}
+
+func TestLoadLedgerDetectsCycles(t *testing.T) {
+	src := MapSource{
+		"a.beancount":     "include \"b.beancount\"\n",
+		"b.beancount":     "include \"sub/c.beancount\"\n",
+		"sub/c.beancount": "\n\ninclude \"../a.beancount\"\n",
+	}
+	_, _, err := LoadLedger(src, "a.beancount")
+	cerr, ok := err.(*CodedError)
+	if !ok {
+		t.Fatalf("expected *CodedError, got %T (%v)", err, err)
+	}
+	if cerr.Code != CodeIncludeCycle {
+		t.Errorf("code = %s, want %s", cerr.Code, CodeIncludeCycle)
+	}
+	if cerr.File != "sub/c.beancount" || cerr.Line != 3 {
+		t.Errorf("location = %s:%d, want sub/c.beancount:3", cerr.File, cerr.Line)
+	}
+	if !strings.Contains(cerr.Message, "a.beancount -> b.beancount -> sub/c.beancount -> a.beancount") {
+		t.Errorf("unexpected message: %s", cerr.Message)
+	}
+}
+
+func TestLoadLedgerMissingInclude(t *testing.T) {
+	tests := []struct {
+		name    string
+		include string
+	}{
+		{"missing file", "missing.beancount"},
+		{"glob without matches", "archive/*.beancount"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := MapSource{"main.beancount": "include \"" + tt.include + "\"\n"}
+			_, _, err := LoadLedger(src, "main.beancount")
+			cerr, ok := err.(*CodedError)
+			if !ok || cerr.Code != CodeIncludeNotFound {
+				t.Fatalf("expected %s, got %v", CodeIncludeNotFound, err)
+			}
+			if cerr.File != "main.beancount" || cerr.Line != 1 {
+				t.Errorf("location = %s:%d, want main.beancount:1", cerr.File, cerr.Line)
+			}
+		})
+	}
+}
+
+func TestLoadLedgerFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range multiFileLedger {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ledger, files, err := LoadLedger(DiskSource{}, filepath.ToSlash(filepath.Join(dir, "main.beancount")))
+	if err != nil {
+		t.Fatalf("LoadLedger failed: %v", err)
+	}
+	if len(files) != 4 || len(ledger.Transactions) != 3 {
+		t.Errorf("expected 4 files and 3 transactions, got %d and %d", len(files), len(ledger.Transactions))
+	}
+}
+
+func TestExecuteBQLFiles(t *testing.T) {
+	jsonStr := ExecuteBQLFiles(
+		"SELECT filename, lineno, amount WHERE account = 'Expenses:Rent' ORDER BY amount",
+		multiFileLedger,
+		"main.beancount",
+	)
+	var result Result
+	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
+		t.Fatalf("failed to unmarshal: %v\nraw: %s", err, jsonStr)
+	}
+	if len(result.Rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d: %s", len(result.Rows), jsonStr)
+	}
+	if result.Rows[0][0] != "years/2023.beancount" || result.Rows[0][1] != float64(3) {
+		t.Errorf("unexpected first row: %v", result.Rows[0])
+	}
+}
+
+func TestLoadLedgerSessionCheckTagsFiles(t *testing.T) {
+	src := MapSource{
+		"main.beancount": "include \"bad.beancount\"\n",
+		"bad.beancount":  "garbage line\n",
+	}
+	result := LoadLedgerSession(src, "main.beancount").Check()
+	if result.Valid || len(result.Errors) != 1 {
+		t.Fatalf("expected 1 error, got %+v", result.Errors)
+	}
+	if result.Errors[0].File != "bad.beancount" || result.Errors[0].Line != 1 {
+		t.Errorf("unexpected error location: %+v", result.Errors[0])
+	}
+}
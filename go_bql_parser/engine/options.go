@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Options are the settings of a ledger, read from its option directives.
+// Options that take one value keep the last one given; operating_currency
+// and inferred_tolerance_default accumulate. All of them are printed back
+// by PrintLedger.
+type Options struct {
+	// Title and OperatingCurrency are shown by the shell's .stats command.
+	// The first operating currency is the one the value column converts
+	// amounts to.
+	Title             string   `json:"title,omitempty"`
+	OperatingCurrency []string `json:"operating_currency,omitempty"`
+
+	// The names of the five root accounts, Assets, Liabilities, Equity,
+	// Income and Expenses unless renamed. The checker reports accounts
+	// under any other root.
+	NameAssets      string `json:"name_assets"`
+	NameLiabilities string `json:"name_liabilities"`
+	NameEquity      string `json:"name_equity"`
+	NameIncome      string `json:"name_income"`
+	NameExpenses    string `json:"name_expenses"`
+
+	// BookingMethod is one of BookingMethods, STRICT unless set. The
+	// engine does not book lots, so it is validated and printed back.
+	BookingMethod string `json:"booking_method"`
+
+	// InferredToleranceDefault maps currencies to the tolerance of amounts
+	// in them whose precision cannot be inferred, those without decimals,
+	// when duplicate transactions are matched; "*" applies to all other
+	// currencies. See Tolerance.
+	InferredToleranceDefault map[string]float64 `json:"inferred_tolerance_default,omitempty"`
+
+	// RenderCommas makes text output group the digits of numbers in
+	// thousands.
+	RenderCommas bool `json:"render_commas"`
+}
+
+// BookingMethods lists the values of the booking_method option.
+var BookingMethods = []string{"STRICT", "STRICT_WITH_SIZE", "FIFO", "LIFO", "HIFO", "AVERAGE", "NONE"}
+
+// ignoredOptions are Beancount options that are accepted, since ledgers
+// written for Beancount use them, but have no effect here.
+var ignoredOptions = map[string]bool{
+	"account_current_conversions":  true,
+	"account_current_earnings":     true,
+	"account_previous_balances":    true,
+	"account_previous_conversions": true,
+	"account_previous_earnings":    true,
+	"account_rounding":             true,
+	"account_unrealized_gains":     true,
+	"conversion_currency":          true,
+	"documents":                    true,
+	"infer_tolerance_from_cost":    true,
+	"insert_pythonpath":            true,
+	"long_string_maxlines":         true,
+	"plugin_processing_mode":       true,
+	"tolerance_multiplier":         true,
+}
+
+// errUnknownOption is returned by Options.set for an option name it does
+// not know.
+var errUnknownOption = errors.New("unknown option")
+
+// DefaultOptions returns the options of a ledger without option
+// directives.
+func DefaultOptions() Options {
+	return Options{
+		NameAssets:      "Assets",
+		NameLiabilities: "Liabilities",
+		NameEquity:      "Equity",
+		NameIncome:      "Income",
+		NameExpenses:    "Expenses",
+		BookingMethod:   "STRICT",
+	}
+}
+
+// Roots returns the names of the root accounts: assets, liabilities,
+// equity, income and expenses, in that order.
+func (o *Options) Roots() []string {
+	return []string{o.NameAssets, o.NameLiabilities, o.NameEquity, o.NameIncome, o.NameExpenses}
+}
+
+// Tolerance returns the inferred_tolerance_default of currency: its own,
+// or the one given for "*", or 0.
+func (o *Options) Tolerance(currency string) float64 {
+	if t, ok := o.InferredToleranceDefault[currency]; ok {
+		return t
+	}
+	return o.InferredToleranceDefault["*"]
+}
+
+// set applies the option name with the given value. It returns
+// errUnknownOption for a name it does not know, and an error describing
+// the value when it is invalid, leaving the options unchanged.
+func (o *Options) set(name, value string) error {
+	switch name {
+	case "title":
+		o.Title = value
+	case "operating_currency":
+		if !isCurrency(value) {
+			return fmt.Errorf("invalid currency %q", value)
+		}
+		o.OperatingCurrency = append(o.OperatingCurrency, value)
+	case "name_assets", "name_liabilities", "name_equity", "name_income", "name_expenses":
+		return o.setRoot(name, value)
+	case "booking_method":
+		for _, m := range BookingMethods {
+			if value == m {
+				o.BookingMethod = value
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid booking method %q, expected one of %s", value, strings.Join(BookingMethods, ", "))
+	case "inferred_tolerance_default":
+		currency, number, ok := strings.Cut(value, ":")
+		if !ok || currency != "*" && !isCurrency(currency) {
+			return fmt.Errorf("invalid tolerance %q, expected CURRENCY:NUMBER", value)
+		}
+		t, err := parseNumber(number)
+		if err != nil || t < 0 {
+			return fmt.Errorf("invalid tolerance %q, expected CURRENCY:NUMBER", value)
+		}
+		if o.InferredToleranceDefault == nil {
+			o.InferredToleranceDefault = make(map[string]float64)
+		}
+		o.InferredToleranceDefault[currency] = t
+	case "render_commas":
+		switch strings.ToUpper(value) {
+		case "TRUE", "1":
+			o.RenderCommas = true
+		case "FALSE", "0":
+			o.RenderCommas = false
+		default:
+			return fmt.Errorf("invalid value %q, expected TRUE or FALSE", value)
+		}
+	default:
+		if !ignoredOptions[name] {
+			return errUnknownOption
+		}
+	}
+	return nil
+}
+
+// setRoot renames a root account. The name must be a capitalised account
+// component that no other root has.
+func (o *Options) setRoot(option, value string) error {
+	if !isAccountComponent(value) {
+		return fmt.Errorf("invalid account root %q, expected a capitalised name", value)
+	}
+	roots := map[string]*string{
+		"name_assets":      &o.NameAssets,
+		"name_liabilities": &o.NameLiabilities,
+		"name_equity":      &o.NameEquity,
+		"name_income":      &o.NameIncome,
+		"name_expenses":    &o.NameExpenses,
+	}
+	for name, root := range roots {
+		if name != option && *root == value {
+			return fmt.Errorf("account root %q is already the value of %s", value, name)
+		}
+	}
+	*roots[option] = value
+	return nil
+}
+
+// isCurrency reports whether s is lexed as a single currency.
+func isCurrency(s string) bool {
+	toks := tokenizeLedger(s)
+	return len(toks) == 3 && toks[0].Kind == TokenCurrency && toks[0].Text == s
+}
+
+// isAccountComponent reports whether s can name a root account: an
+// upper-case letter, or a letter without case, followed by letters, digits
+// and hyphens.
+func isAccountComponent(s string) bool {
+	for i, r := range s {
+		switch {
+		case i == 0 && !unicode.IsUpper(r) && !unicode.Is(unicode.Lo, r):
+			return false
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-':
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLedgerOptions(t *testing.T) {
+	ledger := ParseLedger(`option "title" "Household"
+option "operating_currency" "USD"
+option "operating_currency" "EUR"
+option "name_assets" "Actifs"
+option "booking_method" "FIFO"
+option "inferred_tolerance_default" "*:0.001"
+option "inferred_tolerance_default" "JPY:1"
+option "render_commas" "TRUE"
+option "documents" "receipts"
+
+2024-01-05 * "Grocer" "Groceries"
+  Expenses:Food     45.20 USD
+  Actifs:Cash
+`)
+	want := DefaultOptions()
+	want.Title = "Household"
+	want.OperatingCurrency = []string{"USD", "EUR"}
+	want.NameAssets = "Actifs"
+	want.BookingMethod = "FIFO"
+	want.InferredToleranceDefault = map[string]float64{"*": 0.001, "JPY": 1}
+	want.RenderCommas = true
+	if !reflect.DeepEqual(ledger.Options, want) {
+		t.Errorf("unexpected options:\n%+v\nwant:\n%+v", ledger.Options, want)
+	}
+	if len(ledger.Errors) != 0 {
+		t.Errorf("unexpected errors %+v", ledger.Errors)
+	}
+	if got := ledger.Options.Roots(); strings.Join(got, ",") != "Actifs,Liabilities,Equity,Income,Expenses" {
+		t.Errorf("unexpected roots %v", got)
+	}
+	if ledger.Options.Tolerance("JPY") != 1 || ledger.Options.Tolerance("USD") != 0.001 {
+		t.Errorf("unexpected tolerances %v", ledger.Options.InferredToleranceDefault)
+	}
+	if got := ParseLedger(PrintLedger(ledger)).Options; !reflect.DeepEqual(got, want) {
+		t.Errorf("printing lost options:\n%+v", got)
+	}
+	if got := ParseLedger("").Options; !reflect.DeepEqual(got, DefaultOptions()) || got.Tolerance("USD") != 0 {
+		t.Errorf("unexpected default options %+v", got)
+	}
+}
+
+// TestRootOptions checks that renamed roots are the roots the checker
+// accepts, and the default names are no longer.
+func TestRootOptions(t *testing.T) {
+	text := `2024-01-05 * "Grocer"
+  Expenses:Food   45.20 USD
+  Actifs:Cash    -45.20 USD
+`
+	result := CheckSyntax(text)
+	if len(result.Errors) != 1 || result.Errors[0].Code != CodeUnknownRoot || result.Errors[0].Line != 3 {
+		t.Errorf("expected Actifs to be an unknown root, got %+v", result.Errors)
+	}
+	result = CheckSyntax("option \"name_assets\" \"Actifs\"\n" + text + "  Assets:Cash   0 USD\n")
+	if len(result.Errors) != 1 || result.Errors[0].Code != CodeUnknownRoot || result.Errors[0].Line != 5 {
+		t.Errorf("expected only Assets to be an unknown root, got %+v", result.Errors)
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	text := `option "booking_method" "RANDOM"
+option "operating_currency" "usd"
+option "name_income" "revenue"
+option "name_income" "Expenses"
+option "inferred_tolerance_default" "0.01"
+option "render_commas" "yes"
+option "colour" "blue"
+option "title" "Kept"
+`
+	tests := []struct {
+		line     int
+		code     string
+		severity Severity
+		message  string
+	}{
+		{1, CodeInvalidOption, SeverityError, `option booking_method: invalid booking method "RANDOM", expected one of STRICT, STRICT_WITH_SIZE, FIFO, LIFO, HIFO, AVERAGE, NONE`},
+		{2, CodeInvalidOption, SeverityError, `option operating_currency: invalid currency "usd"`},
+		{3, CodeInvalidOption, SeverityError, `option name_income: invalid account root "revenue", expected a capitalised name`},
+		{4, CodeInvalidOption, SeverityError, `option name_income: account root "Expenses" is already the value of name_expenses`},
+		{5, CodeInvalidOption, SeverityError, `option inferred_tolerance_default: invalid tolerance "0.01", expected CURRENCY:NUMBER`},
+		{6, CodeInvalidOption, SeverityError, `option render_commas: invalid value "yes", expected TRUE or FALSE`},
+		{7, CodeUnknownOption, SeverityWarning, `unknown option "colour"`},
+	}
+	result := CheckSyntax(text)
+	if result.Valid || len(result.Errors) != len(tests) {
+		t.Fatalf("expected %d diagnostics, got %+v", len(tests), result.Errors)
+	}
+	for i, tt := range tests {
+		e := result.Errors[i]
+		if e.Line != tt.line || e.Code != tt.code || e.Severity != tt.severity || e.Message != tt.message {
+			t.Errorf("diagnostic %d: expected line %d %s %s %q, got %+v", i, tt.line, tt.severity, tt.code, tt.message, e)
+		}
+	}
+	if e := result.Errors[0]; e.Column != 25 || e.EndColumn != 33 {
+		t.Errorf("expected the value to be reported, got %+v", e)
+	}
+
+	// Invalid options are left out; the rest apply.
+	ledger := ParseLedger(text)
+	want := DefaultOptions()
+	want.Title = "Kept"
+	if !reflect.DeepEqual(ledger.Options, want) {
+		t.Errorf("unexpected options %+v", ledger.Options)
+	}
+	if !reflect.DeepEqual(ledger.Errors, result.Errors) {
+		t.Errorf("loader and checker disagree:\n%+v\n%+v", ledger.Errors, result.Errors)
+	}
+}
+
+// TestLoadOptions checks that options set in included files apply to the
+// whole ledger.
+func TestLoadOptions(t *testing.T) {
+	src := MapSource{
+		"main.beancount":    "option \"title\" \"Main\"\ninclude \"options.beancount\"\n",
+		"options.beancount": "option \"operating_currency\" \"CHF\"\n",
+	}
+	ledger, _, err := LoadLedger(src, "main.beancount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ledger.Options.Title != "Main" || strings.Join(ledger.Options.OperatingCurrency, ",") != "CHF" {
+		t.Errorf("unexpected options %+v", ledger.Options)
+	}
+}
+
+func TestRenderCommas(t *testing.T) {
+	ledger := ParseLedger(`option "render_commas" "TRUE"
+
+2024-01-05 * "Employer" "Salary"
+  Assets:Bank     12345.5 USD
+  Income:Salary  -12345.5 USD
+2024-01-06 * "Shop" "Pen"
+  Expenses:Office  2 USD
+  Assets:Bank     -2 USD
+`)
+	query, _ := Parse("SELECT account, position, amount")
+	result, err := Execute(query, ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `account                position     amount
+---------------  --------------  ---------
+Assets:Bank       12,345.50 USD   12,345.5
+Income:Salary    -12,345.50 USD  -12,345.5
+Expenses:Office        2.00 USD        2.0
+Assets:Bank           -2.00 USD       -2.0
+`
+	if got := renderText(result); got != want {
+		t.Errorf("unexpected text:\n%s\nwant:\n%s", got, want)
+	}
+	// Machine-readable formats are not affected.
+	if got, _ := Render(result, FormatCSV); !strings.Contains(got, "12345.50 USD,12345.5") {
+		t.Errorf("unexpected csv:\n%s", got)
+	}
+
+	// Printing the ledger keeps the option.
+	if printed := PrintLedger(ledger); !strings.HasPrefix(printed, "option \"render_commas\" \"TRUE\"\n\n2024-01-05") {
+		t.Errorf("unexpected printed ledger:\n%s", printed)
+	}
+
+	for in, want := range map[string]string{"0": "0", "999": "999", "-1000": "-1,000", "1234567.891": "1,234,567.891", "1,000": "1,000"} {
+		if got := groupThousands(in); got != want {
+			t.Errorf("groupThousands(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Params holds the values bound to query parameters, keyed by name for
+// :name parameters and by 1-based position ("1", "2", ...) for ?
+// parameters. Values are strings or numbers.
+type Params map[string]interface{}
+
+// ParseParams decodes parameter values from JSON: an object binds by name
+// or position, an array binds ? parameters in order. Empty text binds
+// nothing.
+func ParseParams(text string) (Params, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || text == "null" {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(text)))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, invalidParams(err.Error())
+	}
+	switch vals := v.(type) {
+	case map[string]interface{}:
+		return Params(vals), nil
+	case []interface{}:
+		params := make(Params, len(vals))
+		for i, val := range vals {
+			params[strconv.Itoa(i+1)] = val
+		}
+		return params, nil
+	}
+	return nil, invalidParams("parameters must be a JSON object or array")
+}
+
+func invalidParams(message string) error {
+	return &CodedError{
+		Code:    CodeInvalidParameters,
+		Message: "invalid parameters: " + message,
+		Hint:    `pass an object such as {"payee": "Trader Joe's"} or an array for ? parameters`,
+	}
+}
+
+// Params returns the parameters of the query and its subqueries in order
+// of first appearance: positions for ? parameters and names for :name
+// parameters.
+func (q *Query) Params() []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(p string) {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			names = append(names, p)
+		}
+	}
+	var walk func(q *Query)
+	walk = func(q *Query) {
+		add(q.FromParam)
+		if q.FromQuery != nil {
+			walk(q.FromQuery)
+		}
+		add(q.Where.Param)
+		if q.Where.Subquery != nil {
+			walk(q.Where.Subquery)
+		}
+	}
+	walk(q)
+	return names
+}
+
+// Bind returns a copy of the query with every parameter replaced by its
+// value from params. Every parameter must have a value, and every value a
+// parameter.
+func Bind(q *Query, params Params) (*Query, error) {
+	used := make(map[string]bool)
+	for _, name := range q.Params() {
+		if _, ok := params[name]; !ok {
+			return nil, &CodedError{
+				Code:    CodeMissingParameter,
+				Message: "no value for parameter " + paramDisplayName(name),
+				Hint:    "bind a value for every ? and :name in the query",
+			}
+		}
+		used[name] = true
+	}
+	for name := range params {
+		if !used[name] {
+			return nil, &CodedError{
+				Code:    CodeUnknownParameter,
+				Message: "the query has no parameter " + paramDisplayName(name),
+				Hint:    "parameters in the query: " + describeParams(q.Params()),
+			}
+		}
+	}
+
+	return bindQuery(q, params)
+}
+
+// bindQuery replaces the parameters of q and its subqueries, whose values
+// Bind has checked are present.
+func bindQuery(q *Query, params Params) (*Query, error) {
+	bound := *q
+	var err error
+	if q.FromQuery != nil {
+		if bound.FromQuery, err = bindQuery(q.FromQuery, params); err != nil {
+			return nil, err
+		}
+	}
+	if q.Where.Subquery != nil {
+		if bound.Where.Subquery, err = bindQuery(q.Where.Subquery, params); err != nil {
+			return nil, err
+		}
+	}
+	if q.FromParam != "" {
+		if bound.From, err = paramString(q.FromParam, params[q.FromParam]); err != nil {
+			return nil, err
+		}
+		bound.FromParam = ""
+	}
+	if q.Where.Param != "" {
+		value, err := paramString(q.Where.Param, params[q.Where.Param])
+		if err != nil {
+			return nil, err
+		}
+		bound.Where = Expression{Literal: value}
+	}
+	return &bound, nil
+}
+
+// paramString converts a bound value to the string it stands for. Values
+// compare as strings, so numbers are formatted as written.
+func paramString(name string, v interface{}) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case json.Number:
+		return val.String(), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(val), nil
+	}
+	return "", &CodedError{
+		Code:    CodeParameterType,
+		Message: fmt.Sprintf("parameter %s must be a string or a number, got %s", paramDisplayName(name), jsonTypeName(v)),
+	}
+}
+
+func paramDisplayName(name string) string {
+	if _, err := strconv.Atoi(name); err == nil {
+		return "?" + name
+	}
+	return ":" + name
+}
+
+func describeParams(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	display := make([]string, len(names))
+	for i, n := range names {
+		display[i] = paramDisplayName(n)
+	}
+	return strings.Join(display, ", ")
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// PreparedQuery is a query parsed and checked once, to be executed many
+// times against a ledger session with different parameter values.
+type PreparedQuery struct {
+	session *LedgerSession
+	query   *Query
+}
+
+// Prepare parses and checks a query for repeated execution. A session
+// whose ledger failed to load still prepares queries; executing them
+// reports the load error.
+func (s *LedgerSession) Prepare(query string) (*PreparedQuery, *ErrorInfo) {
+	ast, err := Parse(query)
+	if err != nil {
+		return nil, NewErrorInfo(PhaseParse, err)
+	}
+	ast = analyze(ast)
+	if err := checkQuery(ast); err != nil {
+		return nil, NewErrorInfo(PhaseExecute, err)
+	}
+	return &PreparedQuery{session: s, query: ast}, nil
+}
+
+// Params returns the parameters of the query, as Query.Params does.
+func (p *PreparedQuery) Params() []string {
+	return p.query.Params()
+}
+
+// Execute binds params and runs the query against the session's ledger.
+func (p *PreparedQuery) Execute(params Params) (*Result, *ErrorInfo) {
+	bound, err := Bind(p.query, params)
+	if err != nil {
+		return nil, NewErrorInfo(PhaseBind, err)
+	}
+	if p.session.loadErr != nil {
+		return nil, NewErrorInfo(PhaseLedger, p.session.loadErr)
+	}
+	result, err := executeRows(bound, p.session.rows)
+	if err != nil {
+		return nil, NewErrorInfo(PhaseExecute, err)
+	}
+	result.describe(p.session.Ledger)
+	return result, nil
+}
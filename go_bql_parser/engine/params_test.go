@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseParameters(t *testing.T) {
+	tests := []struct {
+		query        string
+		expectedJSON string
+		params       []string
+	}{
+		{
+			query:        "SELECT account WHERE payee = ?",
+			expectedJSON: `{"select":[{"literal":"account"}],"where":{"param":"1"},"where_field":"payee"}`,
+			params:       []string{"1"},
+		},
+		{
+			query:        "SELECT account FROM ? WHERE payee = ?",
+			expectedJSON: `{"select":[{"literal":"account"}],"from_param":"1","where":{"param":"2"},"where_field":"payee"}`,
+			params:       []string{"1", "2"},
+		},
+		{
+			query:        "SELECT date FROM :prefix WHERE payee = :payee",
+			expectedJSON: `{"select":[{"literal":"date"}],"from_param":"prefix","where":{"param":"payee"},"where_field":"payee"}`,
+			params:       []string{"prefix", "payee"},
+		},
+		{
+			query:        "SELECT date FROM (SELECT date, payee FROM ?) WHERE payee IN (SELECT payee WHERE account = :acct)",
+			expectedJSON: `{"select":[{"literal":"date"}],"from_query":{"select":[{"literal":"date"},{"literal":"payee"}],"from_param":"1","where":{}},"where":{"subquery":{"select":[{"literal":"payee"}],"where":{"param":"acct"},"where_field":"account"}},"where_field":"payee"}`,
+			params:       []string{"1", "acct"},
+		},
+		{
+			query:        "SELECT date FROM :p WHERE account = :p",
+			expectedJSON: `{"select":[{"literal":"date"}],"from_param":"p","where":{"param":"p"},"where_field":"account"}`,
+			params:       []string{"p"},
+		},
+	}
+
+	for _, tt := range tests {
+		ast, err := Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.query, err)
+		}
+		got, _ := json.Marshal(ast)
+		if string(got) != tt.expectedJSON {
+			t.Errorf("Parse(%q):\n%s\nwant:\n%s", tt.query, got, tt.expectedJSON)
+		}
+		if !reflect.DeepEqual(ast.Params(), tt.params) {
+			t.Errorf("Params(%q) = %q, want %q", tt.query, ast.Params(), tt.params)
+		}
+	}
+}
+
+func TestParseInvalidParameters(t *testing.T) {
+	for _, q := range []string{
+		"SELECT ? WHERE payee = 'x'",
+		"SELECT account WHERE ? = 'x'",
+		"SELECT account WHERE payee = : payee",
+		"SELECT account WHERE payee = :1",
+	} {
+		if _, err := Parse(q); err == nil {
+			t.Errorf("Parse(%q) expected an error", q)
+		}
+	}
+}
+
+func TestExecuteBQLParams(t *testing.T) {
+	var result Result
+	out := ExecuteBQLParams("SELECT date, account WHERE payee = :payee", testLedger, `{"payee": "Trader Joe's"}`)
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 2 || result.Rows[0][0] != "2024-02-03" {
+		t.Errorf("unexpected rows for Trader Joe's: %s", out)
+	}
+
+	out = ExecuteBQLParams("SELECT account FROM ? WHERE payee = ?", testLedger, `["Expenses:Food", "AcmeCo"]`)
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 0 {
+		t.Errorf("expected no rows, got %s", out)
+	}
+
+	out = ExecuteBQLParams("SELECT account WHERE lineno = :line", "2024-01-01 * \"P\" \"N\"\n  Assets:Cash 1 USD\n", `{"line": 1}`)
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 1 {
+		t.Errorf("expected numbers to bind as strings, got %s", out)
+	}
+
+	result = Result{}
+	out = ExecuteBQLParams("SELECT payee FROM (SELECT payee WHERE account = :acct)", testLedger, `{"acct": "Expenses:Rent"}`)
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 1 {
+		t.Errorf("expected parameters in subqueries to bind, got %s", out)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		params string
+		code   string
+	}{
+		{"missing value", "SELECT account WHERE payee = :payee", `{}`, CodeMissingParameter},
+		{"unbound query", "SELECT account WHERE payee = ?", ``, CodeMissingParameter},
+		{"unknown name", "SELECT account WHERE payee = :payee", `{"payee": "x", "payer": "y"}`, CodeUnknownParameter},
+		{"no parameters", "SELECT account", `["x"]`, CodeUnknownParameter},
+		{"wrong type", "SELECT account WHERE payee = ?", `[true]`, CodeParameterType},
+		{"null value", "SELECT account WHERE payee = :p", `{"p": null}`, CodeParameterType},
+		{"not json", "SELECT account WHERE payee = ?", `[`, CodeInvalidParameters},
+		{"scalar", "SELECT account WHERE payee = ?", `"x"`, CodeInvalidParameters},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var envelope struct {
+				Error *ErrorInfo `json:"error"`
+			}
+			out := ExecuteBQLParams(tt.query, testLedger, tt.params)
+			if err := json.Unmarshal([]byte(out), &envelope); err != nil || envelope.Error == nil {
+				t.Fatalf("expected an error envelope, got %s", out)
+			}
+			if envelope.Error.Code != tt.code || envelope.Error.Phase != PhaseBind {
+				t.Errorf("got %s in phase %s, want %s in phase bind", envelope.Error.Code, envelope.Error.Phase, tt.code)
+			}
+		})
+	}
+}
+
+func TestBindDoesNotModifyQuery(t *testing.T) {
+	ast, _ := Parse("SELECT account FROM :from WHERE payee = :payee")
+	bound, err := Bind(ast, Params{"from": "Expenses", "payee": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bound.From != "Expenses" || bound.Where.Literal != "x" || len(bound.Params()) != 0 {
+		t.Errorf("unexpected bound query: %+v", bound)
+	}
+	if ast.FromParam != "from" || ast.Where.Param != "payee" {
+		t.Errorf("Bind modified the prepared query: %+v", ast)
+	}
+}
+
+func TestPreparedQuery(t *testing.T) {
+	s := NewLedgerSession(testLedger)
+	p, errInfo := s.Prepare("SELECT date, amount WHERE payee = :payee ORDER BY date DESC")
+	if errInfo != nil {
+		t.Fatalf("Prepare: %+v", errInfo)
+	}
+	if !reflect.DeepEqual(p.Params(), []string{"payee"}) {
+		t.Errorf("unexpected params: %v", p.Params())
+	}
+
+	for payee, rows := range map[string]int{"AcmeCo": 4, "Trader Joe's": 2, "Nobody": 0} {
+		result, errInfo := p.Execute(Params{"payee": payee})
+		if errInfo != nil {
+			t.Fatalf("Execute(%q): %+v", payee, errInfo)
+		}
+		if len(result.Rows) != rows {
+			t.Errorf("Execute(%q): got %d rows, want %d", payee, len(result.Rows), rows)
+		}
+	}
+
+	if _, errInfo := p.Execute(nil); errInfo == nil || errInfo.Code != CodeMissingParameter {
+		t.Errorf("expected a missing parameter error, got %+v", errInfo)
+	}
+}
+
+func TestPrepareChecksQuery(t *testing.T) {
+	s := NewLedgerSession(testLedger)
+	if _, errInfo := s.Prepare("SELECT account, AVG(amount) GROUP BY account"); errInfo == nil || errInfo.Code != CodeUnknownFunction {
+		t.Errorf("expected an unknown function error at prepare time, got %+v", errInfo)
+	}
+	if _, errInfo := s.Prepare("SELECT SUM(amount, amount)"); errInfo == nil || errInfo.Code != CodeArgumentCount {
+		t.Errorf("expected an argument count error at prepare time, got %+v", errInfo)
+	}
+	if _, errInfo := s.Prepare("SELECT account WHERE"); errInfo == nil || errInfo.Phase != PhaseParse {
+		t.Errorf("expected a parse error, got %+v", errInfo)
+	}
+}
@@ -0,0 +1,348 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseValidQueries(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		expectedJSON string
+	}{
+		{
+			name:         "simple select",
+			query:        "SELECT account",
+			expectedJSON: `{"select":[{"literal":"account"}],"where":{}}`,
+		},
+		{
+			name:         "select with multiple expressions",
+			query:        "SELECT account, balance",
+			expectedJSON: `{"select":[{"literal":"account"},{"literal":"balance"}],"where":{}}`,
+		},
+		{
+			name:         "select from where group by order by",
+			query:        "SELECT account, balance FROM 'Expenses:Cash' WHERE category = 'Groceries' GROUP BY account ORDER BY balance DESC",
+			expectedJSON: `{"select":[{"literal":"account"},{"literal":"balance"}],"from":"Expenses:Cash","where":{"literal":"Groceries"},"where_field":"category","group_by":[{"literal":"account"}],"order_by":[{"expression":{"literal":"balance"},"ascending":false}]}`,
+		},
+		{
+			name:         "order by ascending implicit",
+			query:        "SELECT account ORDER BY account",
+			expectedJSON: `{"select":[{"literal":"account"}],"where":{},"order_by":[{"expression":{"literal":"account"},"ascending":true}]}`,
+		},
+		{
+			name:         "order by explicit ascending",
+			query:        "SELECT account ORDER BY account ASC",
+			expectedJSON: `{"select":[{"literal":"account"}],"where":{},"order_by":[{"expression":{"literal":"account"},"ascending":true}]}`,
+		},
+		{
+			name:         "pivot by",
+			query:        "SELECT account, ymonth, SUM(amount) GROUP BY account, ymonth PIVOT BY account, ymonth",
+			expectedJSON: `{"select":[{"literal":"account"},{"literal":"ymonth"},{"func_name":"SUM","func_args":[{"literal":"amount"}]}],"where":{},"group_by":[{"literal":"account"},{"literal":"ymonth"}],"pivot_by":[{"literal":"account"},{"literal":"ymonth"}]}`,
+		},
+		{
+			name:         "print",
+			query:        "PRINT FROM 'Expenses:Food' WHERE payee = :payee",
+			expectedJSON: `{"print":true,"select":[],"from":"Expenses:Food","where":{"param":"payee"},"where_field":"payee"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.query, err)
+			}
+
+			jsonResult, err := json.Marshal(ast)
+			if err != nil {
+				t.Fatalf("Failed to marshal AST to JSON: %v", err)
+			}
+
+			if string(jsonResult) != tt.expectedJSON {
+				t.Errorf("Parse(%q) got JSON:\n%s\nwant JSON:\n%s", tt.query, string(jsonResult), tt.expectedJSON)
+			}
+		})
+	}
+}
+
+func TestParseInvalidQueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{
+			name:  "missing select keyword",
+			query: "account",
+		},
+		{
+			name:  "invalid token in select list",
+			query: "SELECT account, 123 invalid",
+		},
+		{
+			name:  "unclosed string",
+			query: "SELECT account FROM 'Expenses:Cash",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			if err == nil {
+				t.Errorf("Parse(%q) expected an error, but got none", tt.query)
+			}
+		})
+	}
+}
+func TestParseErrorDetails(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		line     int
+		column   int
+		token    string
+		expected []string
+	}{
+		{
+			name:     "missing select keyword",
+			query:    "account",
+			line:     1,
+			column:   1,
+			token:    "account",
+			expected: []string{"SELECT", "PRINT"},
+		},
+		{
+			name:     "number in select list",
+			query:    "SELECT account, 123 invalid",
+			line:     1,
+			column:   17,
+			token:    "123",
+			expected: []string{"identifier"},
+		},
+		{
+			name:     "missing BY after GROUP",
+			query:    "SELECT account\n  GROUP account",
+			line:     2,
+			column:   9,
+			token:    "account",
+			expected: []string{"BY"},
+		},
+		{
+			name:     "truncated function call",
+			query:    "SELECT sum(",
+			line:     1,
+			column:   12,
+			expected: []string{"identifier", "'*'"},
+		},
+		{
+			name:     "where without value",
+			query:    "SELECT account WHERE payee =",
+			line:     1,
+			column:   29,
+			expected: []string{"string", "parameter"},
+		},
+		{
+			name:     "unclosed string",
+			query:    "SELECT account FROM 'Expenses:Cash",
+			line:     1,
+			column:   21,
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("Parse(%q) returned %T (%v), want *ParseError", tt.query, err, err)
+			}
+			if perr.Line != tt.line || perr.Column != tt.column {
+				t.Errorf("position = %d:%d, want %d:%d", perr.Line, perr.Column, tt.line, tt.column)
+			}
+			if perr.Token != tt.token {
+				t.Errorf("token = %q, want %q", perr.Token, tt.token)
+			}
+			if !reflect.DeepEqual(perr.Expected, tt.expected) {
+				t.Errorf("expected = %q, want %q", perr.Expected, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseErrorSnippet(t *testing.T) {
+	_, err := Parse("SELECT a b")
+	perr := err.(*ParseError)
+	want := "SELECT a b\n         ^"
+	if perr.Snippet != want {
+		t.Errorf("snippet = %q, want %q", perr.Snippet, want)
+	}
+	if !strings.Contains(perr.Error(), "end of query") {
+		t.Errorf("expected end of query among expected tokens, got %q", perr.Error())
+	}
+}
+
+func TestParseBQLToJSONError(t *testing.T) {
+	jsonStr := ParseBQLToJSON("SELECT account WHERE payee = x")
+	var envelope struct {
+		Error ErrorInfo `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &envelope); err != nil {
+		t.Fatalf("error output is not valid JSON: %v\nraw: %s", err, jsonStr)
+	}
+	e := envelope.Error
+	if e.Code != CodeSyntax || e.Phase != PhaseParse || e.Line != 1 || e.Column != 30 {
+		t.Errorf("unexpected error object: %+v", e)
+	}
+	if !reflect.DeepEqual(e.Expected, []string{"string", "parameter"}) {
+		t.Errorf("expected = %q, want [string parameter]", e.Expected)
+	}
+	if e.Hint != "expected string or parameter" {
+		t.Errorf("hint = %q, want %q", e.Hint, "expected string or parameter")
+	}
+}
+
+func TestParseBQLToJSONUnclosedString(t *testing.T) {
+	jsonStr := ParseBQLToJSON("SELECT account FROM 'Expenses")
+	var envelope struct {
+		Error ErrorInfo `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &envelope); err != nil {
+		t.Fatalf("error output is not valid JSON: %v\nraw: %s", err, jsonStr)
+	}
+	if envelope.Error.Code != CodeUnclosedString {
+		t.Errorf("code = %q, want %q", envelope.Error.Code, CodeUnclosedString)
+	}
+	if envelope.Error.Hint == "" {
+		t.Error("expected a hint for an unclosed string")
+	}
+}
+
+func TestParseSubqueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "IN subquery",
+			query: "SELECT date, amount WHERE payee IN (SELECT payee WHERE account = 'Expenses:Rent')",
+			want:  `{"select":[{"literal":"date"},{"literal":"amount"}],"where":{"subquery":{"select":[{"literal":"payee"}],"where":{"literal":"Expenses:Rent"},"where_field":"account"}},"where_field":"payee"}`,
+		},
+		{
+			name:  "FROM subquery",
+			query: "SELECT payee, COUNT(*) FROM (SELECT payee, account FROM 'Expenses') GROUP BY payee",
+			want:  `{"select":[{"literal":"payee"},{"func_name":"COUNT","func_args":[{"literal":"*"}]}],"from_query":{"select":[{"literal":"payee"},{"literal":"account"}],"from":"Expenses","where":{}},"where":{},"group_by":[{"literal":"payee"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ast, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.query, err)
+			}
+			got, _ := json.Marshal(ast)
+			if string(got) != tt.want {
+				t.Errorf("got JSON:\n%s\nwant JSON:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	// Nested statements are not statements of the script.
+	stmts, err := ParseScript("SELECT payee FROM (SELECT payee); SELECT account WHERE payee IN (SELECT payee)")
+	if err != nil || len(stmts) != 2 {
+		t.Errorf("expected 2 statements, got %d (%v)", len(stmts), err)
+	}
+}
+
+func TestParseStringLiterals(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"doubled quote", `SELECT date WHERE payee = 'Trader Joe''s'`, "Trader Joe's"},
+		{"escaped quote", `SELECT date WHERE payee = 'Trader Joe\'s'`, "Trader Joe's"},
+		{"double-quoted", `SELECT date WHERE payee = "Trader Joe's"`, "Trader Joe's"},
+		{"doubled double quote", `SELECT date WHERE narration = "say ""hi"""`, `say "hi"`},
+		{"escapes", `SELECT date WHERE narration = 'a\\b\tc\nd'`, "a\\b\tc\nd"},
+		{"unknown escape kept", `SELECT date WHERE narration = 'C:\dir'`, `C:\dir`},
+		{"non-ASCII", `SELECT date WHERE payee = 'Café Zürich 東京'`, "Café Zürich 東京"},
+		{"empty", `SELECT date WHERE payee = ''`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %v", tt.query, err)
+			}
+			if q.Where.Literal != tt.want {
+				t.Errorf("value = %q, want %q", q.Where.Literal, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	query := `-- Food spending by account
+SELECT account, /* total */ SUM(amount)
+FROM 'Expenses:Food' -- prefix match
+GROUP BY account /* trailing */`
+	q, err := Parse(query)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if len(q.Select) != 2 || q.From != "Expenses:Food" || len(q.GroupBy) != 1 {
+		t.Errorf("unexpected query: %+v", q)
+	}
+
+	// Comment markers inside strings are part of the string.
+	q, err = Parse(`SELECT date WHERE narration = 'a -- b /* c */'`)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if q.Where.Literal != "a -- b /* c */" {
+		t.Errorf("value = %q", q.Where.Literal)
+	}
+}
+
+func TestParseUnicodeIdentifiers(t *testing.T) {
+	q, err := Parse("SELECT größe, 日付")
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if q.Select[0].Literal != "größe" || q.Select[1].Literal != "日付" {
+		t.Errorf("unexpected select list: %+v", q.Select)
+	}
+}
+
+func TestParseLexErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		code   string
+		column int
+	}{
+		{"unclosed double-quoted string", `SELECT date WHERE payee = "Trader`, CodeUnclosedString, 27},
+		{"escaped closing quote", `SELECT date WHERE payee = 'Trader\'`, CodeUnclosedString, 27},
+		{"unclosed comment", "SELECT date /* never closed", CodeUnclosedComment, 13},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("Parse(%q) returned %T (%v), want *ParseError", tt.query, err, err)
+			}
+			if perr.Code != tt.code || perr.Line != 1 || perr.Column != tt.column {
+				t.Errorf("got %s at %d:%d, want %s at 1:%d", perr.Code, perr.Line, perr.Column, tt.code, tt.column)
+			}
+			if NewErrorInfo(PhaseParse, err).Hint == "" {
+				t.Error("expected a hint")
+			}
+		})
+	}
+}
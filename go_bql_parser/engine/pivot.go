@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// checkPivot reports whether the PIVOT BY clause of an analysed query names
+// two different selected columns, with at least one other column to hold
+// the values.
+func checkPivot(q *Query) error {
+	if len(q.PivotBy) == 0 {
+		return nil
+	}
+	const hint = "name the row column and the column whose values become columns, as in PIVOT BY account, ymonth"
+	if len(q.PivotBy) != 2 {
+		return &CodedError{
+			Code:    CodePivot,
+			Message: fmt.Sprintf("PIVOT BY takes two columns, got %d", len(q.PivotBy)),
+			Hint:    hint,
+		}
+	}
+	selected := make(map[string]bool)
+	for _, name := range columnNames(q.Select) {
+		selected[name] = true
+	}
+	for _, e := range q.PivotBy {
+		if name := exprName(e); !selected[name] {
+			return &CodedError{
+				Code:    CodePivot,
+				Message: fmt.Sprintf("PIVOT BY column %s is not selected", name),
+				Hint:    "add " + name + " to the SELECT list",
+			}
+		}
+	}
+	if exprName(q.PivotBy[0]) == exprName(q.PivotBy[1]) {
+		return &CodedError{Code: CodePivot, Message: "PIVOT BY columns must differ", Hint: hint}
+	}
+	if len(q.Select) < 3 {
+		return &CodedError{
+			Code:    CodePivot,
+			Message: "PIVOT BY needs a column of values besides the two pivot columns",
+			Hint:    "select a value such as SUM(amount)",
+		}
+	}
+	return nil
+}
+
+// applyPivot reshapes result for the PIVOT BY clause of query. The rows
+// are the distinct values of the first pivot column, in result order. The
+// distinct values of the second pivot column, sorted, become columns,
+// holding the other columns of the result: one column per value when there
+// is a single other column, else one per value and column, named
+// "value/column". Missing combinations are null.
+func applyPivot(result *Result, query *Query) *Result {
+	if len(query.PivotBy) == 0 {
+		return result
+	}
+	colIndex := make(map[string]int)
+	for i, c := range result.Columns {
+		colIndex[c] = i
+	}
+	rowCol := colIndex[exprName(query.PivotBy[0])]
+	keyCol := colIndex[exprName(query.PivotBy[1])]
+	var valueCols []int
+	for i := range result.Columns {
+		if i != rowCol && i != keyCol {
+			valueCols = append(valueCols, i)
+		}
+	}
+
+	var keys []interface{}
+	seen := make(map[string]bool)
+	for _, row := range result.Rows {
+		if k := formatCell(row[keyCol]); !seen[k] {
+			seen[k] = true
+			keys = append(keys, row[keyCol])
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return compareValues(keys[i], keys[j]) < 0
+	})
+	keyPos := make(map[string]int, len(keys))
+	columns := []string{result.Columns[rowCol]}
+	for i, k := range keys {
+		keyPos[formatCell(k)] = i
+		for _, v := range valueCols {
+			name := formatCell(k)
+			if len(valueCols) > 1 {
+				name += "/" + result.Columns[v]
+			}
+			columns = append(columns, name)
+		}
+	}
+
+	pivoted := &Result{Columns: columns}
+	rowPos := make(map[string]int)
+	for _, row := range result.Rows {
+		r := formatCell(row[rowCol])
+		i, ok := rowPos[r]
+		if !ok {
+			i = len(pivoted.Rows)
+			rowPos[r] = i
+			out := make([]interface{}, len(columns))
+			out[0] = row[rowCol]
+			pivoted.Rows = append(pivoted.Rows, out)
+		}
+		base := 1 + keyPos[formatCell(row[keyCol])]*len(valueCols)
+		for j, v := range valueCols {
+			pivoted.Rows[i][base+j] = row[v]
+		}
+	}
+	return pivoted
+}
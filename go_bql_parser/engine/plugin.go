@@ -0,0 +1,90 @@
+package engine
+
+import "sync"
+
+// Entry is a dated directive of a loaded ledger, with the file it was read
+// from. Entries added by plugins have the file and span of the entry or
+// posting they were made for. Transactions carry the tags pushed by the
+// pushtag directives around them; entries added by plugins carry only the
+// tags their plugin gives them.
+type Entry struct {
+	File string `json:"file,omitempty"`
+	*Directive
+}
+
+// Plugin transforms the entries of a ledger after loading, as a Beancount
+// plugin does. It receives the entries in load order, the ledger's options
+// and the configuration string of its plugin directive, which is empty
+// when the directive has none. It returns the entries to keep, including
+// any it adds, and the errors it finds. A plugin must not modify the
+// entries it is given; it replaces those it changes.
+type Plugin func(entries []Entry, opts *Options, config string) ([]Entry, []SyntaxError)
+
+// plugins maps the names used in plugin directives to the plugins they
+// enable. Beancount's plugins are written in Python, which cannot run here,
+// so the common ones are built in under their Beancount names. pluginsMu
+// guards it, since plugins may be registered while ledgers load.
+var (
+	pluginsMu sync.RWMutex
+	plugins   = map[string]Plugin{
+		"beancount.plugins.auto_accounts":   autoAccounts,
+		"beancount.plugins.implicit_prices": implicitPrices,
+		"beancount.plugins.check_commodity": checkCommodity,
+		"beancount.plugins.leafonly":        leafOnly,
+		"beancount.plugins.noduplicates":    noDuplicates,
+	}
+)
+
+// RegisterPlugin makes p run for plugin directives that name it. A plugin
+// registered under the name of a built-in one replaces it. It is safe to
+// call while other goroutines load ledgers, though a ledger loading at the
+// same time may run the plugin the name had before.
+func RegisterPlugin(name string, p Plugin) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	plugins[name] = p
+}
+
+// lookupPlugin returns the plugin registered under name, or nil.
+func lookupPlugin(name string) Plugin {
+	pluginsMu.RLock()
+	defer pluginsMu.RUnlock()
+	return plugins[name]
+}
+
+// runPlugins runs the plugins enabled by uses, a ledger's plugin
+// directives, in order over its entries. Unknown plugins are skipped; the
+// parser reported them.
+func runPlugins(entries []Entry, uses []Entry, opts *Options) ([]Entry, []SyntaxError) {
+	var errs []SyntaxError
+	for _, use := range uses {
+		args := use.Strings()
+		p := lookupPlugin(args[0])
+		if p == nil {
+			continue
+		}
+		config := ""
+		if len(args) > 1 {
+			config = args[1]
+		}
+		var pluginErrs []SyntaxError
+		entries, pluginErrs = p(entries, opts, config)
+		errs = append(errs, pluginErrs...)
+	}
+	return entries, errs
+}
+
+// accountRefs returns the accounts a directive refers to, as tokens with
+// their spans: the accounts of its header, then those of its postings.
+func (d *Directive) accountRefs() []LedgerToken {
+	var refs []LedgerToken
+	for _, t := range d.Args {
+		if t.Kind == TokenAccount {
+			refs = append(refs, t)
+		}
+	}
+	for _, pn := range d.Postings {
+		refs = append(refs, LedgerToken{Kind: TokenAccount, Text: pn.Account, Value: pn.Account, Span: pn.AccountSpan})
+	}
+	return refs
+}
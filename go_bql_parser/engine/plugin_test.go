@@ -0,0 +1,261 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// printEntries prints entries as Beancount text, without blank lines
+// between them.
+func printEntries(entries []Entry) string {
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteString(PrintDirective(e.Directive))
+	}
+	return b.String()
+}
+
+func TestAutoAccountsAndImplicitPrices(t *testing.T) {
+	text := `plugin "beancount.plugins.auto_accounts"
+plugin "beancount.plugins.implicit_prices"
+
+2024-01-01 open Assets:Broker
+2024-01-05 * "Buy"
+  Assets:Broker   2 AAPL {150.00 USD}
+  Assets:Cash  -300.00 USD
+2024-01-06 * "Sell"
+  Assets:Broker  -2 AAPL @@ 320 USD
+  Assets:Cash     320 USD
+2024-01-06 price AAPL 160.00 USD
+2024-01-04 balance Assets:Savings  0 USD
+`
+	ledger := ParseLedger(text)
+	want := `2024-01-01 open Assets:Broker
+2024-01-05 open Assets:Cash
+2024-01-05 * "Buy"
+  Assets:Broker      2 AAPL {150.00 USD}
+  Assets:Cash  -300.00 USD
+2024-01-05 price AAPL  150 USD
+2024-01-06 * "Sell"
+  Assets:Broker  -2 AAPL @@ 320 USD
+  Assets:Cash   320 USD
+2024-01-06 price AAPL  160.00 USD
+2024-01-04 open Assets:Savings
+2024-01-04 balance Assets:Savings  0 USD
+`
+	if got := printEntries(ledger.Entries); got != want {
+		t.Errorf("unexpected entries:\n%s\nwant:\n%s", got, want)
+	}
+	if len(ledger.Transactions) != 2 || len(ledger.Errors) != 0 {
+		t.Errorf("unexpected ledger %+v", ledger)
+	}
+	if open := ledger.Entries[1]; open.Span != (Span{Line: 7, Column: 3, EndLine: 7, EndColumn: 14}) {
+		t.Errorf("expected the open at the first use, got %+v", open.Span)
+	}
+
+	// Without the plugin, the postings to Assets:Cash are reported as
+	// using an account never opened.
+	if result := CheckSyntax(text); len(result.Errors) != 0 {
+		t.Errorf("unexpected diagnostics %+v", result.Errors)
+	}
+	without := CheckSyntax(strings.Replace(text, `plugin "beancount.plugins.auto_accounts"`, "", 1))
+	if len(without.Errors) != 2 || without.Errors[0].Code != CodeAccountNotOpen {
+		t.Errorf("expected accounts not open, got %+v", without.Errors)
+	}
+}
+
+func TestPluginErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []SyntaxError
+	}{
+		{
+			name: "check_commodity",
+			text: `plugin "beancount.plugins.check_commodity"
+2024-01-01 commodity USD
+2024-01-01 open Assets:Cash USD,CHF
+2024-01-02 * "Swap"
+  Assets:Cash   10 EUR @ 1.1 USD
+  Assets:Cash  -11 USD
+2024-01-03 * "Again"
+  Assets:Cash   5 EUR
+  Assets:Cash  -5 EUR
+`,
+			want: []SyntaxError{
+				{Span: Span{Line: 3, Column: 33, EndLine: 3, EndColumn: 36}, Severity: SeverityError, Code: CodeUndeclaredCommodity, Message: "commodity CHF is used but not declared"},
+				{Span: Span{Line: 5, Column: 20, EndLine: 5, EndColumn: 23}, Severity: SeverityError, Code: CodeUndeclaredCommodity, Message: "commodity EUR is used but not declared"},
+			},
+		},
+		{
+			name: "leafonly",
+			text: `plugin "beancount.plugins.leafonly"
+2024-01-02 * "Lunch"
+  Expenses:Food   10 USD
+  Assets:Cash
+2024-01-03 * "Groceries"
+  Expenses:Food:Groceries   5 USD
+  Assets:Cash
+`,
+			want: []SyntaxError{
+				{Span: Span{Line: 3, Column: 3, EndLine: 3, EndColumn: 16}, Severity: SeverityError, Code: CodeNonLeafAccount, Message: "posting to non-leaf account Expenses:Food"},
+			},
+		},
+		{
+			name: "noduplicates",
+			text: `plugin "beancount.plugins.noduplicates"
+2024-01-02 * "Shop" "Pen"
+  Expenses:Office   2.50 USD
+  Assets:Cash
+2024-01-02 * "Shop" "Pen"
+  id: "x"
+  Expenses:Office   2.5 USD
+  Assets:Cash
+2024-01-02 * "Shop" "Pencil"
+  Expenses:Office   1.20 USD
+  Assets:Cash
+`,
+			want: []SyntaxError{
+				{
+					Span: Span{Line: 5, Column: 1, EndLine: 5, EndColumn: 11}, Severity: SeverityError, Code: CodeDuplicateTransaction, Message: `duplicate transaction 2024-01-02 "Pen"`,
+					Related: []RelatedLocation{{Span: Span{Line: 2, Column: 1, EndLine: 2, EndColumn: 11}, Message: "first entered here"}},
+				},
+			},
+		},
+		{
+			name: "unknown plugin",
+			text: "plugin \"fava.plugins.link_documents\"\n",
+			want: []SyntaxError{
+				{Span: Span{Line: 1, Column: 8, EndLine: 1, EndColumn: 37}, Severity: SeverityWarning, Code: CodeUnknownPlugin, Message: `unknown plugin "fava.plugins.link_documents" is ignored; only built-in plugins can run`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CheckSyntax(tt.text)
+			if got, want := formatDiagnostics(result.Errors), formatDiagnostics(tt.want); got != want {
+				t.Errorf("unexpected diagnostics:\n%s\nwant:\n%s", got, want)
+			}
+			// The loader reports the same errors, and keeps the transactions.
+			ledger := ParseLedger(tt.text)
+			if got, want := formatDiagnostics(ledger.Errors), formatDiagnostics(tt.want); got != want {
+				t.Errorf("unexpected ledger errors:\n%s\nwant:\n%s", got, want)
+			}
+			if n := strings.Count(tt.text, " * "); len(ledger.Transactions) != n {
+				t.Errorf("expected %d transactions, got %d", n, len(ledger.Transactions))
+			}
+		})
+	}
+}
+
+// formatDiagnostics returns one line per diagnostic, for comparing them
+// in test failures.
+func formatDiagnostics(diags []SyntaxError) string {
+	var b strings.Builder
+	for _, d := range diags {
+		fmt.Fprintf(&b, "%s %+v %s %s %q %+v\n", d.File, d.Span, d.Severity, d.Code, d.Message, d.Related)
+	}
+	return b.String()
+}
+
+// TestRegisterPlugin checks that a plugin registered in code runs with the
+// configuration of its directive, and that plugins enabled in an included
+// file apply to the whole ledger.
+func TestRegisterPlugin(t *testing.T) {
+	RegisterPlugin("test.drop_flag", func(entries []Entry, opts *Options, config string) ([]Entry, []SyntaxError) {
+		var kept []Entry
+		for _, e := range entries {
+			if e.Kind != "transaction" || e.Flag != config {
+				kept = append(kept, e)
+			}
+		}
+		return kept, nil
+	})
+	defer delete(plugins, "test.drop_flag")
+
+	src := MapSource{
+		"main.beancount": `include "plugins.beancount"
+2024-01-02 * "Shop" "Pen"
+  Expenses:Office   2.50 USD
+  Assets:Cash
+2024-01-03 ! "Shop" "Unsure"
+  Expenses:Office   9 USD
+  Assets:Cash
+`,
+		"plugins.beancount": "plugin \"test.drop_flag\" \"!\"\nplugin \"beancount.plugins.auto_accounts\"\n",
+	}
+	session := LoadLedgerSession(src, "main.beancount")
+	if err := session.LoadError(); err != nil {
+		t.Fatal(err)
+	}
+	if txns := session.Ledger.Transactions; len(txns) != 1 || txns[0].Narration != "Pen" {
+		t.Errorf("expected the flagged transaction to be dropped, got %+v", txns)
+	}
+	if n := len(session.Ledger.Entries); n != 3 {
+		t.Errorf("expected two opens and a transaction, got %d entries", n)
+	}
+	if result := session.Check(); !result.Valid || len(result.Errors) != 0 {
+		t.Errorf("unexpected diagnostics %+v", result.Errors)
+	}
+}
+
+// TestPluginPushedTags checks that plugins see the tags pushed around the
+// transactions they are given, and that the transactions they add get
+// none.
+func TestPluginPushedTags(t *testing.T) {
+	RegisterPlugin("test.copy_tagged", func(entries []Entry, opts *Options, config string) ([]Entry, []SyntaxError) {
+		out := entries
+		for _, e := range entries {
+			if e.Kind == "transaction" && strings.Join(e.Tags, ",") == "trip" {
+				c := *e.Directive
+				c.Tags = nil
+				c.Narration = "Copy"
+				out = append(out, Entry{File: e.File, Directive: &c})
+			}
+		}
+		return out, nil
+	})
+	defer delete(plugins, "test.copy_tagged")
+
+	ledger := ParseLedger(`plugin "test.copy_tagged"
+pushtag #trip
+2024-01-02 * "Taxi"
+  Expenses:Travel   20 EUR
+  Assets:Cash
+poptag #trip
+2024-01-03 * "Lunch"
+  Expenses:Food   10 EUR
+  Assets:Cash
+`)
+	var got []string
+	for _, txn := range ledger.Transactions {
+		got = append(got, fmt.Sprintf("%s %v", txn.Narration, txn.Tags))
+	}
+	if want := "Taxi [trip], Lunch [], Copy []"; strings.Join(got, ", ") != want {
+		t.Errorf("expected %s, got %s", want, strings.Join(got, ", "))
+	}
+}
+
+// TestRegisterPluginConcurrently registers plugins while ledgers load, for
+// the race detector.
+func TestRegisterPluginConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := range 4 {
+		name := fmt.Sprintf("test.noop%d", i)
+		defer delete(plugins, name)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterPlugin(name, func(entries []Entry, opts *Options, config string) ([]Entry, []SyntaxError) {
+				return entries, nil
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			ParseLedger(fmt.Sprintf("plugin %q\nplugin \"beancount.plugins.auto_accounts\"\n", name))
+		}()
+	}
+	wg.Wait()
+}
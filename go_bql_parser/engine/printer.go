@@ -0,0 +1,272 @@
+package engine
+
+import (
+	"sort"
+	"strings"
+)
+
+// PrintLedger returns the options of ledger that differ from the defaults,
+// followed by its entries in order, as Beancount text separated by blank
+// lines. Transactions are printed from Transactions, so that changes made
+// to them in code are kept, and transactions appended to it in code follow
+// the entries. The entries are the output of the ledger's plugins, so its
+// plugin directives are left out, as are pushtag and poptag, whose tags
+// the transactions carry. Amounts are aligned across the whole ledger, so
+// that FormatLedger leaves the text as it is.
+func PrintLedger(ledger *Ledger) string {
+	f := newPrinter()
+	for _, line := range optionLines(&ledger.Options) {
+		f.lines = append(f.lines, formattedLine{text: line})
+	}
+	add := func(d *Directive) {
+		if len(f.lines) > 0 {
+			f.lines = append(f.lines, formattedLine{})
+		}
+		f.directive(d)
+	}
+	n := 0
+	for _, e := range ledger.Entries {
+		if e.Kind != "transaction" {
+			add(e.Directive)
+		} else if n < len(ledger.Transactions) {
+			add(transactionDirective(&ledger.Transactions[n]))
+			n++
+		}
+	}
+	for ; n < len(ledger.Transactions); n++ {
+		add(transactionDirective(&ledger.Transactions[n]))
+	}
+	return f.align()
+}
+
+// optionLines returns the option directives that set o, leaving out the
+// options that have their default values.
+func optionLines(o *Options) []string {
+	var lines []string
+	add := func(name, value string) {
+		lines = append(lines, "option "+quoteString(name)+" "+quoteString(value))
+	}
+	if o.Title != "" {
+		add("title", o.Title)
+	}
+	for _, c := range o.OperatingCurrency {
+		add("operating_currency", c)
+	}
+	defaults := DefaultOptions()
+	roots, defaultRoots := o.Roots(), defaults.Roots()
+	for i, name := range []string{"name_assets", "name_liabilities", "name_equity", "name_income", "name_expenses"} {
+		if roots[i] != defaultRoots[i] {
+			add(name, roots[i])
+		}
+	}
+	if o.BookingMethod != defaults.BookingMethod {
+		add("booking_method", o.BookingMethod)
+	}
+	currencies := make([]string, 0, len(o.InferredToleranceDefault))
+	for c := range o.InferredToleranceDefault {
+		currencies = append(currencies, c)
+	}
+	sort.Strings(currencies)
+	for _, c := range currencies {
+		add("inferred_tolerance_default", c+":"+formatNumber(o.InferredToleranceDefault[c]))
+	}
+	if o.RenderCommas {
+		add("render_commas", "TRUE")
+	}
+	return lines
+}
+
+// PrintTransaction returns txn as Beancount text: its header with payee,
+// narration, tags and links, its metadata, and its postings with their
+// flags, amounts, costs, prices and metadata. Numbers read from a ledger
+// are printed as they were written; others are printed as in query
+// results.
+func PrintTransaction(txn *Transaction) string {
+	f := newPrinter()
+	f.directive(transactionDirective(txn))
+	return f.align()
+}
+
+// PrintDirective returns a directive of a syntax tree as Beancount text,
+// laid out as FormatLedger lays it out. Strings are printed on one line,
+// with newlines, quotes and backslashes escaped.
+func PrintDirective(d *Directive) string {
+	f := newPrinter()
+	f.directive(d)
+	return f.align()
+}
+
+// PrintFile returns the directives of a syntax tree as Beancount text,
+// separated by blank lines. Comments are not printed.
+func PrintFile(file *LedgerFile) string {
+	f := newPrinter()
+	for i, d := range file.Directives {
+		if i > 0 {
+			f.lines = append(f.lines, formattedLine{})
+		}
+		f.directive(d)
+	}
+	return f.align()
+}
+
+// newPrinter returns a formatter to print directives into, with the
+// default layout.
+func newPrinter() *formatter {
+	return &formatter{opts: FormatOptions{Indent: DefaultIndent}}
+}
+
+// directive adds the lines of a directive.
+func (f *formatter) directive(d *Directive) {
+	indent := strings.Repeat(" ", f.opts.Indent)
+	if d.Kind == "transaction" {
+		f.lines = append(f.lines, formattedLine{text: transactionHeader(d)})
+	} else {
+		f.header(directiveHeader(d), "")
+	}
+	f.meta(indent, d.Meta)
+	for _, pn := range d.Postings {
+		prefix := indent + pn.Account
+		if pn.Flag != "" {
+			prefix = indent + pn.Flag + " " + pn.Account
+		}
+		var rest []string
+		if pn.Cost != "" {
+			rest = append(rest, canonicalText(pn.Cost))
+		}
+		if pn.Price != nil {
+			at := "@"
+			if pn.TotalPrice {
+				at = "@@"
+			}
+			rest = append(rest, at, pn.Price.Number, pn.Price.Currency)
+		}
+		switch {
+		case pn.Amount != nil:
+			suffix := strings.Join(append([]string{pn.Amount.Currency}, rest...), " ")
+			f.lines = append(f.lines, formattedLine{prefix: prefix, number: pn.Amount.Number, suffix: suffix})
+		case len(rest) > 0:
+			f.lines = append(f.lines, formattedLine{text: prefix + " " + strings.Join(rest, " ")})
+		default:
+			f.lines = append(f.lines, formattedLine{text: prefix})
+		}
+		f.meta(indent+indent, pn.Meta)
+	}
+}
+
+// meta adds metadata lines after indent.
+func (f *formatter) meta(indent string, items []*MetaItem) {
+	for _, item := range items {
+		text := indent + item.Key + ":"
+		if item.Value != "" {
+			text += " " + canonicalText(item.Value)
+		}
+		f.lines = append(f.lines, formattedLine{text: text})
+	}
+}
+
+// transactionHeader returns the header line of a transaction directive.
+func transactionHeader(d *Directive) string {
+	parts := []string{d.Date, d.Flag}
+	if d.Payee != "" {
+		parts = append(parts, quoteString(d.Payee))
+	}
+	parts = append(parts, quoteString(d.Narration))
+	for _, tag := range d.Tags {
+		parts = append(parts, "#"+tag)
+	}
+	for _, link := range d.Links {
+		parts = append(parts, "^"+link)
+	}
+	return strings.Join(parts, " ")
+}
+
+// directiveHeader returns the tokens of the header line of a directive
+// other than a transaction, with its strings quoted canonically.
+func directiveHeader(d *Directive) []LedgerToken {
+	var toks []LedgerToken
+	if d.Date != "" {
+		toks = append(toks, LedgerToken{Kind: TokenDate, Text: d.Date})
+	}
+	toks = append(toks, LedgerToken{Kind: TokenKeyword, Text: d.Kind})
+	for _, t := range d.Args {
+		if t.Kind == TokenString {
+			t.Text = quoteString(t.Value)
+		}
+		toks = append(toks, t)
+	}
+	return toks
+}
+
+// transactionDirective returns the directive txn was read from, or would
+// be read from when it was built by hand.
+func transactionDirective(txn *Transaction) *Directive {
+	flag := txn.Flag
+	if flag == "" {
+		flag = "*"
+	}
+	d := &Directive{
+		Kind:      "transaction",
+		Date:      txn.Date,
+		Flag:      flag,
+		Payee:     txn.Payee,
+		Narration: txn.Narration,
+		Tags:      txn.Tags,
+		Links:     txn.Links,
+		Meta:      metaItems(txn.Meta),
+	}
+	for _, p := range txn.Postings {
+		pn := &PostingNode{
+			Flag:       p.Flag,
+			Account:    p.Account,
+			Cost:       p.Cost,
+			TotalPrice: p.TotalPrice,
+			Meta:       metaItems(p.Meta),
+		}
+		if p.HasAmount {
+			pn.Amount = &AmountNode{Number: numberText(p.Amount, p.number), Currency: p.Currency}
+		}
+		if p.PriceCurrency != "" {
+			pn.Price = &AmountNode{Number: numberText(p.Price, p.priceNumber), Currency: p.PriceCurrency}
+		}
+		d.Postings = append(d.Postings, pn)
+	}
+	return d
+}
+
+func metaItems(meta []Metadata) []*MetaItem {
+	items := make([]*MetaItem, len(meta))
+	for i, m := range meta {
+		items[i] = &MetaItem{Key: m.Key, Value: m.Value}
+	}
+	return items
+}
+
+// numberText returns written, the number as read from a ledger, if it
+// still holds the value v, and otherwise v formatted as in query results.
+func numberText(v float64, written string) string {
+	if n, err := parseNumber(written); err == nil && n == v {
+		return written
+	}
+	return formatNumber(v)
+}
+
+// quoteString returns s as a Beancount string.
+func quoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// canonicalText returns the tokens of text joined as FormatLedger joins
+// them, with strings quoted canonically.
+func canonicalText(text string) string {
+	var toks []LedgerToken
+	for _, t := range tokenizeLedger(text) {
+		switch t.Kind {
+		case TokenEOF, TokenNewline, TokenIndent, TokenComment:
+			continue
+		case TokenString:
+			t.Text = quoteString(t.Value)
+		}
+		toks = append(toks, t)
+	}
+	return joinTokens(toks)
+}
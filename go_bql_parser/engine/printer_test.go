@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestPrintTransaction(t *testing.T) {
+	ledger := ParseLedger(`2024-01-05 txn "Grocer \"Joe\""   "Groceries" #food ^receipt-42
+    id:   42
+  Expenses:Food     45.20 USD
+      receipt: "r.pdf"
+  ! Assets:Broker 2 AAPL { 150.00  USD , 2024-01-01 } @@ 310.00 USD
+  Assets:Cash 1,000 EUR @ 1.10 USD
+  Equity:Rounding
+`)
+	want := `2024-01-05 * "Grocer \"Joe\"" "Groceries" #food ^receipt-42
+  id: 42
+  Expenses:Food  45.20 USD
+    receipt: "r.pdf"
+  ! Assets:Broker    2 AAPL {150.00 USD, 2024-01-01} @@ 310.00 USD
+  Assets:Cash    1,000 EUR @ 1.10 USD
+  Equity:Rounding
+`
+	if got := PrintTransaction(&ledger.Transactions[0]); got != want {
+		t.Errorf("unexpected entry:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestPrintBuiltTransaction prints a transaction built in code, as an
+// import tool builds them.
+func TestPrintBuiltTransaction(t *testing.T) {
+	txn := &Transaction{
+		Date:      "2024-03-01",
+		Narration: "Line 1\nLine 2",
+		Links:     []string{"stmt-3"},
+		Postings: []Posting{
+			{Account: "Expenses:Fees", Amount: 2.5, Currency: "EUR", HasAmount: true, Meta: []Metadata{{Key: "source", Value: `"bank"`}}},
+			{Account: "Assets:Bank", Amount: -2.5, Currency: "EUR", HasAmount: true},
+		},
+	}
+	want := `2024-03-01 * "Line 1\nLine 2" ^stmt-3
+  Expenses:Fees  2.5 EUR
+    source: "bank"
+  Assets:Bank   -2.5 EUR
+`
+	if got := PrintTransaction(txn); got != want {
+		t.Errorf("unexpected entry:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A changed amount is printed from its value, not as it was written.
+	ledger := ParseLedger("2024-03-01 * \"Fee\"\n  Expenses:Fees  2.50 EUR\n  Assets:Bank\n")
+	ledger.Transactions[0].Postings[0].Amount = 3
+	if got, want := PrintLedger(ledger), "2024-03-01 * \"Fee\"\n  Expenses:Fees  3 EUR\n  Assets:Bank\n"; got != want {
+		t.Errorf("unexpected entry:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestPrintDirective(t *testing.T) {
+	file := ParseBeancount("", `option   "title"  "Test"
+2024-01-01 open Assets:Cash   USD,EUR
+  note:  "petty"
+2024-01-02   balance Assets:Cash    0.00 USD
+2024-01-03 price AAPL   150 USD
+2024-01-04 event "location" "Paris,
+France"
+`)
+	want := `option "title" "Test"
+
+2024-01-01 open Assets:Cash USD, EUR
+  note: "petty"
+
+2024-01-02 balance Assets:Cash  0.00 USD
+
+2024-01-03 price AAPL            150 USD
+
+2024-01-04 event "location" "Paris,\nFrance"
+`
+	if got := PrintFile(file); got != want {
+		t.Errorf("unexpected directives:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := PrintDirective(file.Directives[1]), "2024-01-01 open Assets:Cash USD, EUR\n  note: \"petty\"\n"; got != want {
+		t.Errorf("unexpected directive:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+// TestPrintSample checks that printing the sample ledger and reading it
+// back gives the same transactions, and that the printed text is already
+// formatted.
+func TestPrintSample(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.beancount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := ParseLedger(string(data))
+	printed := PrintLedger(before)
+	if errs := CheckSyntax(printed).Errors; len(errs) != 0 {
+		t.Errorf("printed ledger has diagnostics: %+v", errs)
+	}
+	if formatted := FormatLedger(printed, FormatOptions{}); formatted != printed {
+		t.Errorf("printed ledger is not formatted:\n%s", formatted)
+	}
+	checkRoundTrip(t, before, ParseLedger(printed))
+
+	file := ParseBeancount("", string(data))
+	if again := PrintFile(ParseBeancount("", PrintFile(file))); again != PrintFile(file) {
+		t.Errorf("printing the directives is not stable:\n%s", again)
+	}
+}
+
+// TestPrintLedgerDirectives checks that printing a ledger keeps every
+// directive, not only its transactions.
+func TestPrintLedgerDirectives(t *testing.T) {
+	before := ParseLedger(`option "title" "All"
+2024-01-01 commodity USD
+  name: "US Dollar"
+2024-01-01 open Assets:Cash USD
+2024-01-01 open Equity:Opening
+2024-01-01 open Expenses:Food
+2024-01-02 pad Assets:Cash Equity:Opening
+2024-01-03 balance Assets:Cash  100.00 USD
+2024-01-04 * "Grocer" "Food" #weekly
+  Expenses:Food   20.00 USD
+  Assets:Cash
+2024-01-04 price EUR  1.10 USD
+2024-01-05 event "location" "Paris"
+2024-01-05 note Assets:Cash "Counted"
+2024-01-05 document Assets:Cash "receipts/2024-01-05.pdf"
+2024-01-06 custom "budget" Expenses:Food "monthly" 200.00 USD
+2024-01-07 query "food" "SELECT account WHERE account ~ 'Food'"
+2024-12-31 close Expenses:Food
+`)
+	printed := PrintLedger(before)
+	after := ParseLedger(printed)
+	if len(after.Entries) != 14 {
+		t.Errorf("expected 14 entries, got %d:\n%s", len(after.Entries), printed)
+	}
+	checkRoundTrip(t, before, after)
+}
+
+// checkRoundTrip checks that a ledger read back from its printed text has
+// the same options, entries and transactions.
+func checkRoundTrip(t *testing.T, before, after *Ledger) {
+	t.Helper()
+	if !reflect.DeepEqual(before.Options, after.Options) {
+		t.Errorf("printing changed the options of the ledger: %+v", after.Options)
+	}
+	if len(after.Entries) != len(before.Entries) {
+		t.Fatalf("expected %d entries, got %d", len(before.Entries), len(after.Entries))
+	}
+	for i, e := range before.Entries {
+		// Spans differ once printed, so entries are compared as text.
+		if got, want := PrintDirective(after.Entries[i].Directive), PrintDirective(e.Directive); got != want {
+			t.Errorf("entry %d changed:\n%s\nwant:\n%s", i, got, want)
+		}
+	}
+	if len(after.Transactions) != len(before.Transactions) {
+		t.Fatalf("expected %d transactions, got %d", len(before.Transactions), len(after.Transactions))
+	}
+	for i := range before.Transactions {
+		before.Transactions[i].Line, after.Transactions[i].Line = 0, 0
+	}
+	if !reflect.DeepEqual(before.Transactions, after.Transactions) {
+		t.Error("printing changed the transactions of the ledger")
+	}
+}
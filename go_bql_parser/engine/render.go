@@ -0,0 +1,413 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format names an output format for query results.
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatCSV      Format = "csv"
+	FormatTSV      Format = "tsv"
+	FormatMarkdown Format = "markdown"
+	FormatText     Format = "text"
+	FormatHTML     Format = "html"
+)
+
+// Formats lists the supported output formats.
+var Formats = []Format{FormatJSON, FormatCSV, FormatTSV, FormatMarkdown, FormatText, FormatHTML}
+
+// ParseFormat returns the format with the given name. Names are case
+// insensitive, and "md" and "table" are accepted for markdown and text.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(name))); f {
+	case FormatJSON, FormatCSV, FormatTSV, FormatMarkdown, FormatText, FormatHTML:
+		return f, nil
+	case "md":
+		return FormatMarkdown, nil
+	case "table":
+		return FormatText, nil
+	}
+	names := make([]string, len(Formats))
+	for i, f := range Formats {
+		names[i] = string(f)
+	}
+	return "", &CodedError{
+		Code:    CodeUnknownFormat,
+		Message: fmt.Sprintf("unknown output format %q", name),
+		Hint:    "use one of " + strings.Join(names, ", "),
+	}
+}
+
+// Render writes result in the given format. JSON output is the same object
+// ExecuteBQL returns; the other formats have a header row of column names.
+func Render(result *Result, format Format) (string, error) {
+	switch format {
+	case FormatJSON:
+		out, err := json.Marshal(result)
+		return string(out), err
+	case FormatCSV:
+		return renderCSV(result)
+	case FormatTSV:
+		return renderTSV(result), nil
+	case FormatMarkdown:
+		return renderMarkdown(result), nil
+	case FormatText:
+		return renderText(result), nil
+	case FormatHTML:
+		return renderHTML(result), nil
+	}
+	_, err := ParseFormat(string(format))
+	return "", err
+}
+
+// RenderScript writes the results of a script in the given format. JSON
+// output is the object ExecuteScript returns; in the other formats each
+// result is rendered as by Render, separated by blank lines.
+func RenderScript(results []*Result, format Format) (string, error) {
+	if format == FormatJSON {
+		out, err := json.Marshal(ScriptResult{Results: results})
+		return string(out), err
+	}
+	parts := make([]string, len(results))
+	for i, result := range results {
+		out, err := Render(result, format)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = out
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// RenderQuery runs query with RunQuery and renders the result by format
+// name. An unknown format is reported before the query runs.
+func RenderQuery(query, ledgerText, format string) (string, *ErrorInfo) {
+	f, err := ParseFormat(format)
+	if err != nil {
+		return "", NewErrorInfo(PhaseSerialize, err)
+	}
+	result, errInfo := RunQuery(query, ledgerText)
+	if errInfo != nil {
+		return "", errInfo
+	}
+	return renderInfo(result, f)
+}
+
+// renderInfo renders result, reporting failures as an envelope error.
+func renderInfo(result *Result, format Format) (string, *ErrorInfo) {
+	out, err := Render(result, format)
+	if err != nil {
+		return "", NewErrorInfo(PhaseSerialize, err)
+	}
+	return out, nil
+}
+
+func renderCSV(result *Result) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(result.Columns)
+	for _, row := range result.Rows {
+		w.Write(cellStrings(row))
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// renderTSV writes tab-separated values. Tabs and newlines inside values
+// are replaced by spaces, since TSV has no quoting.
+func renderTSV(result *Result) string {
+	clean := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+	var b strings.Builder
+	writeLine := func(vals []string) {
+		for i, v := range vals {
+			if i > 0 {
+				b.WriteByte('\t')
+			}
+			b.WriteString(clean.Replace(v))
+		}
+		b.WriteByte('\n')
+	}
+	writeLine(result.Columns)
+	for _, row := range result.Rows {
+		writeLine(cellStrings(row))
+	}
+	return b.String()
+}
+
+// renderMarkdown writes a GitHub-flavoured Markdown table. Numeric columns
+// are right-aligned.
+func renderMarkdown(result *Result) string {
+	clean := strings.NewReplacer("|", `\|`, "\r", " ", "\n", " ")
+	numeric := numericColumns(result)
+	var b strings.Builder
+	writeLine := func(vals []string) {
+		b.WriteString("|")
+		for _, v := range vals {
+			b.WriteString(" " + clean.Replace(v) + " |")
+		}
+		b.WriteByte('\n')
+	}
+	writeLine(result.Columns)
+	rules := make([]string, len(result.Columns))
+	for i := range rules {
+		rules[i] = "---"
+		if numeric[i] {
+			rules[i] = "---:"
+		}
+	}
+	writeLine(rules)
+	for _, row := range result.Rows {
+		writeLine(cellStrings(row))
+	}
+	return b.String()
+}
+
+func renderHTML(result *Result) string {
+	numeric := numericColumns(result)
+	var b strings.Builder
+	b.WriteString("<table>\n<thead>\n<tr>")
+	for _, c := range result.Columns {
+		b.WriteString("<th>" + html.EscapeString(c) + "</th>")
+	}
+	b.WriteString("</tr>\n</thead>\n<tbody>\n")
+	for _, row := range result.Rows {
+		b.WriteString("<tr>")
+		for i, v := range cellStrings(row) {
+			if i < len(numeric) && numeric[i] {
+				b.WriteString(`<td class="number">`)
+			} else {
+				b.WriteString("<td>")
+			}
+			b.WriteString(html.EscapeString(v) + "</td>")
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	return b.String()
+}
+
+// positionRe matches an amount with a currency, as in the position column.
+var positionRe = regexp.MustCompile(`^(-?[0-9][0-9,]*(?:\.[0-9]+)?) ([A-Z][A-Z0-9'._-]*)$`)
+
+// renderText writes fixed-width columns under a header and a rule line.
+// Numeric columns are right-aligned with a common number of decimals, and
+// columns of positions are aligned on the number and the currency.
+// Trailing spaces are trimmed from every line.
+func renderText(result *Result) string {
+	if result.entries {
+		return renderEntries(result)
+	}
+	cells := make([][]string, len(result.Rows))
+	for r, row := range result.Rows {
+		cells[r] = cellStrings(row)
+	}
+
+	numeric := numericColumns(result)
+	right := make([]bool, len(result.Columns))
+	for i := range result.Columns {
+		switch {
+		case numeric[i]:
+			alignDecimals(result.Rows, cells, i, result.commas)
+			right[i] = true
+		case alignPositions(cells, i, result.commas):
+			right[i] = true
+		}
+	}
+
+	widths := make([]int, len(result.Columns))
+	for i, c := range result.Columns {
+		widths[i] = utf8.RuneCountInString(c)
+	}
+	for _, row := range cells {
+		for i, v := range row {
+			if n := utf8.RuneCountInString(v); i < len(widths) && n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var b strings.Builder
+	writeLine := func(vals []string) {
+		var line strings.Builder
+		for i, v := range vals {
+			if i > 0 {
+				line.WriteString("  ")
+			}
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(v))
+			if right[i] {
+				line.WriteString(pad + v)
+			} else {
+				line.WriteString(v + pad)
+			}
+		}
+		b.WriteString(strings.TrimRight(line.String(), " ") + "\n")
+	}
+	writeLine(result.Columns)
+	rules := make([]string, len(widths))
+	for i, n := range widths {
+		rules[i] = strings.Repeat("-", n)
+	}
+	writeLine(rules)
+	for _, row := range cells {
+		writeLine(row)
+	}
+	return b.String()
+}
+
+// renderEntries writes the entries of a PRINT result as a ledger: one
+// after the other, separated by blank lines.
+func renderEntries(result *Result) string {
+	entries := make([]string, len(result.Rows))
+	for i, row := range result.Rows {
+		entries[i] = formatCell(row[0])
+	}
+	return strings.Join(entries, "\n")
+}
+
+// alignDecimals reformats the numbers of column col with the largest
+// number of decimals found in the column, so that decimal points line up,
+// and with their digits grouped in thousands if commas is set.
+func alignDecimals(rows [][]interface{}, cells [][]string, col int, commas bool) {
+	decimals := 0
+	for _, row := range rows {
+		if v, ok := row[col].(float64); ok {
+			s := formatNumber(v)
+			if i := strings.IndexByte(s, '.'); i >= 0 && len(s)-i-1 > decimals {
+				decimals = len(s) - i - 1
+			}
+		}
+	}
+	for r, row := range rows {
+		if v, ok := row[col].(float64); ok {
+			cells[r][col] = strconv.FormatFloat(v, 'f', decimals, 64)
+			if commas {
+				cells[r][col] = groupThousands(cells[r][col])
+			}
+		}
+	}
+}
+
+// alignPositions pads the number and currency of every cell in column col
+// to common widths, if all non-empty cells are positions, grouping the
+// digits of the numbers in thousands if commas is set. It reports whether
+// the column was aligned.
+func alignPositions(cells [][]string, col int, commas bool) bool {
+	numWidth, curWidth, found := 0, 0, false
+	for _, row := range cells {
+		if row[col] == "" {
+			continue
+		}
+		m := positionRe.FindStringSubmatch(row[col])
+		if m == nil {
+			return false
+		}
+		found = true
+		if commas {
+			m[1] = groupThousands(m[1])
+		}
+		numWidth = max(numWidth, len(m[1]))
+		curWidth = max(curWidth, len(m[2]))
+	}
+	if !found {
+		return false
+	}
+	for _, row := range cells {
+		if m := positionRe.FindStringSubmatch(row[col]); m != nil {
+			if commas {
+				m[1] = groupThousands(m[1])
+			}
+			row[col] = fmt.Sprintf("%*s %-*s", numWidth, m[1], curWidth, m[2])
+		}
+	}
+	return true
+}
+
+// groupThousands inserts commas between the thousands of the integer part
+// of a formatted number, as in 1,234,567.89. Numbers that already have
+// commas are returned as they are.
+func groupThousands(s string) string {
+	if strings.Contains(s, ",") {
+		return s
+	}
+	sign, digits := "", s
+	if strings.HasPrefix(s, "-") {
+		sign, digits = "-", s[1:]
+	}
+	frac := ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		digits, frac = digits[:i], digits[i:]
+	}
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String() + frac
+}
+
+// numericColumns reports, for each column, whether it holds numbers: at
+// least one number and nothing but numbers and missing values.
+func numericColumns(result *Result) []bool {
+	numeric := make([]bool, len(result.Columns))
+	for i := range numeric {
+		seen, other := false, false
+		for _, row := range result.Rows {
+			switch row[i].(type) {
+			case float64:
+				seen = true
+			case nil:
+			default:
+				other = true
+			}
+		}
+		numeric[i] = seen && !other
+	}
+	return numeric
+}
+
+func cellStrings(row []interface{}) []string {
+	vals := make([]string, len(row))
+	for i, v := range row {
+		vals[i] = formatCell(v)
+	}
+	return vals
+}
+
+// formatCell returns the display form of a result value. Missing values
+// are empty.
+func formatCell(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return formatNumber(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// formatNumber formats v with at most 8 decimals and no trailing zeros, so
+// that float rounding in sums (607.6499999999999) is not displayed.
+func formatNumber(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 8, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+var renderResult = &Result{
+	Columns: []string{"account", "position", "sum"},
+	Rows: [][]interface{}{
+		{"Assets:Cash", "-1500.00 USD", -1500.0},
+		{"Expenses:Food|Dining", "45.20 USD", 45.2},
+		{"Equity:Opening", "", nil},
+	},
+}
+
+func TestRenderCSVAndTSV(t *testing.T) {
+	out, err := Render(renderResult, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "account,position,sum\nAssets:Cash,-1500.00 USD,-1500\nExpenses:Food|Dining,45.20 USD,45.2\nEquity:Opening,,\n"
+	if out != want {
+		t.Errorf("csv:\n%q\nwant:\n%q", out, want)
+	}
+
+	out, _ = Render(&Result{Columns: []string{"narration"}, Rows: [][]interface{}{{"tab\there"}}}, FormatTSV)
+	if out != "narration\ntab here\n" {
+		t.Errorf("tsv: %q", out)
+	}
+}
+
+func TestRenderRoundsFloatSums(t *testing.T) {
+	out, _ := Render(&Result{Columns: []string{"sum"}, Rows: [][]interface{}{{607.6499999999999}, {-0.000000001}}}, FormatCSV)
+	if out != "sum\n607.65\n0\n" {
+		t.Errorf("unexpected csv: %q", out)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	out, _ := Render(renderResult, FormatMarkdown)
+	want := "| account | position | sum |\n" +
+		"| --- | --- | ---: |\n" +
+		"| Assets:Cash | -1500.00 USD | -1500 |\n" +
+		"| Expenses:Food\\|Dining | 45.20 USD | 45.2 |\n" +
+		"| Equity:Opening |  |  |\n"
+	if out != want {
+		t.Errorf("markdown:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	out, _ := Render(renderResult, FormatText)
+	want := "account                   position      sum\n" +
+		"--------------------  ------------  -------\n" +
+		"Assets:Cash           -1500.00 USD  -1500.0\n" +
+		"Expenses:Food|Dining     45.20 USD     45.2\n" +
+		"Equity:Opening\n"
+	if out != want {
+		t.Errorf("text:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	out, _ := Render(&Result{Columns: []string{"payee", "n"}, Rows: [][]interface{}{{"A & B <Co>", 2.0}}}, FormatHTML)
+	for _, want := range []string{
+		"<th>payee</th><th>n</th>",
+		"<td>A &amp; B &lt;Co&gt;</td><td class=\"number\">2</td>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("html output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]Format{"CSV": FormatCSV, "md": FormatMarkdown, "table": FormatText, "html": FormatHTML} {
+		if got, err := ParseFormat(name); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	_, errInfo := RenderQuery("SELECT account", testLedger, "xml")
+	if errInfo == nil || errInfo.Code != CodeUnknownFormat || errInfo.Phase != PhaseSerialize {
+		t.Fatalf("expected an unknown format error, got %+v", errInfo)
+	}
+	if !strings.Contains(errInfo.Hint, "markdown") {
+		t.Errorf("expected the hint to list the formats, got %q", errInfo.Hint)
+	}
+}
+
+func TestRenderQuery(t *testing.T) {
+	out, errInfo := RenderQuery("SELECT account, COUNT(*) GROUP BY account ORDER BY account", testLedger, "markdown")
+	if errInfo != nil {
+		t.Fatalf("unexpected error: %+v", errInfo)
+	}
+	if !strings.HasPrefix(out, "| account | count(*) |\n| --- | ---: |\n") {
+		t.Errorf("unexpected markdown:\n%s", out)
+	}
+}
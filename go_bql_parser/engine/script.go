@@ -0,0 +1,96 @@
+package engine
+
+import "encoding/json"
+
+// ScriptResult holds the results of a script, one per statement in script
+// order.
+type ScriptResult struct {
+	Results []*Result `json:"results"`
+}
+
+// ParseScript parses one or more BQL statements separated by semicolons.
+func ParseScript(script string) ([]*Query, error) {
+	lexer := NewBQLLexer(script)
+	if yyParse(lexer) != 0 || lexer.err != nil {
+		return nil, newParseError(script, lexer)
+	}
+	return lexer.results, nil
+}
+
+// ExecuteScript runs every statement of script against ledgerText and
+// returns {"results": [...]} with one result per statement, or an error
+// envelope.
+func ExecuteScript(script string, ledgerText string) string {
+	results, errInfo := RunScript(script, ledgerText)
+	if errInfo != nil {
+		return envelopeJSON(errInfo)
+	}
+	jsonResult, err := json.Marshal(ScriptResult{Results: results})
+	if err != nil {
+		return errorJSON(PhaseSerialize, err)
+	}
+	return string(jsonResult)
+}
+
+// RunScript parses script and ledgerText and runs the statements in order
+// against one parse of the ledger. The ledger is only parsed once the whole
+// script has parsed; the first statement that fails stops the script, and
+// its error names the statement.
+func RunScript(script string, ledgerText string) ([]*Result, *ErrorInfo) {
+	stmts, errInfo := prepareScript(script)
+	if errInfo != nil {
+		return nil, errInfo
+	}
+	ledger := ParseLedger(ledgerText)
+	return runStatements(stmts, buildRows(ledger), ledger)
+}
+
+// QueryScript runs every statement of script against the ledger, as
+// RunScript does.
+func (s *LedgerSession) QueryScript(script string) ([]*Result, *ErrorInfo) {
+	stmts, errInfo := prepareScript(script)
+	if errInfo != nil {
+		return nil, errInfo
+	}
+	if s.loadErr != nil {
+		return nil, NewErrorInfo(PhaseLedger, s.loadErr)
+	}
+	return runStatements(stmts, s.rows, s.Ledger)
+}
+
+// prepareScript parses script and binds its statements. Scripts take no
+// parameter values, so a statement with parameters fails to bind.
+func prepareScript(script string) ([]*Query, *ErrorInfo) {
+	stmts, err := ParseScript(script)
+	if err != nil {
+		return nil, NewErrorInfo(PhaseParse, err)
+	}
+	for i, q := range stmts {
+		if stmts[i], err = Bind(q, nil); err != nil {
+			return nil, statementError(PhaseBind, err, i)
+		}
+	}
+	return stmts, nil
+}
+
+// runStatements runs bound statements over the posting rows of ledger.
+// Every result reports the errors of the ledger.
+func runStatements(stmts []*Query, rows []postingRow, ledger *Ledger) ([]*Result, *ErrorInfo) {
+	results := make([]*Result, len(stmts))
+	for i, q := range stmts {
+		result, err := executeRows(q, rows)
+		if err != nil {
+			return nil, statementError(PhaseExecute, err, i)
+		}
+		result.describe(ledger)
+		results[i] = result
+	}
+	return results, nil
+}
+
+// statementError builds the envelope error of the statement at index i.
+func statementError(phase string, err error, i int) *ErrorInfo {
+	info := NewErrorInfo(phase, err)
+	info.Statement = i + 1
+	return info
+}
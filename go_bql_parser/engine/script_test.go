@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScript(t *testing.T) {
+	stmts, err := ParseScript(`
+-- Balance sheet
+SELECT account, SUM(amount) FROM 'Assets' GROUP BY account;
+SELECT payee, COUNT(*) GROUP BY payee ORDER BY payee;
+`)
+	if err != nil {
+		t.Fatalf("ParseScript returned error: %v", err)
+	}
+	if len(stmts) != 2 || stmts[0].From != "Assets" || stmts[1].OrderBy == nil {
+		t.Errorf("unexpected statements: %+v", stmts)
+	}
+
+	stmts, err = ParseScript("SELECT account")
+	if err != nil || len(stmts) != 1 {
+		t.Errorf("single statement: %v, %v", stmts, err)
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		line   int
+		column int
+	}{
+		{"empty", "", 1, 1},
+		{"empty statement", "SELECT account;; SELECT payee", 1, 16},
+		{"error in second statement", "SELECT account;\nSELECT payee FROM", 2, 18},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseScript(tt.script)
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("ParseScript(%q) returned %T (%v), want *ParseError", tt.script, err, err)
+			}
+			if perr.Line != tt.line || perr.Column != tt.column {
+				t.Errorf("position = %d:%d, want %d:%d", perr.Line, perr.Column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestParseSingleStatement(t *testing.T) {
+	if _, err := Parse("SELECT account;"); err != nil {
+		t.Errorf("trailing semicolon: %v", err)
+	}
+
+	_, err := Parse("SELECT account; SELECT payee")
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError, got %T (%v)", err, err)
+	}
+	if perr.Column != 17 || perr.Token != "SELECT" || !reflect.DeepEqual(perr.Expected, []string{"end of query"}) {
+		t.Errorf("unexpected error: %+v", perr)
+	}
+}
+
+func TestExecuteScript(t *testing.T) {
+	out := ExecuteScript("SELECT account, SUM(amount) FROM 'Expenses:Rent' GROUP BY account; SELECT COUNT(*)", testLedger)
+	var got ScriptResult
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("invalid JSON %s: %v", out, err)
+	}
+	if len(got.Results) != 2 {
+		t.Fatalf("expected 2 results, got %s", out)
+	}
+	if got.Results[1].Rows[0][0] != 12.0 {
+		t.Errorf("expected 12 postings, got %v", got.Results[1].Rows)
+	}
+}
+
+func TestRunScriptStatementError(t *testing.T) {
+	_, errInfo := RunScript("SELECT account; SELECT AVG(amount); SELECT payee", testLedger)
+	if errInfo == nil {
+		t.Fatal("expected an error")
+	}
+	if errInfo.Code != CodeUnknownFunction || errInfo.Phase != PhaseExecute || errInfo.Statement != 2 {
+		t.Errorf("unexpected error: %+v", errInfo)
+	}
+
+	_, errInfo = RunScript("SELECT account; SELECT date WHERE payee = ?", testLedger)
+	if errInfo == nil || errInfo.Phase != PhaseBind || errInfo.Statement != 2 {
+		t.Errorf("expected a bind error in statement 2, got %+v", errInfo)
+	}
+
+	_, errInfo = RunScript("SELECT account; SELECT", testLedger)
+	if errInfo == nil || errInfo.Phase != PhaseParse || errInfo.Statement != 0 {
+		t.Errorf("expected a parse error without a statement, got %+v", errInfo)
+	}
+}
+
+func TestSessionQueryScript(t *testing.T) {
+	s := NewLedgerSession(testLedger)
+	results, errInfo := s.QueryScript("SELECT account; SELECT payee WHERE payee = 'AcmeCo'")
+	if errInfo != nil {
+		t.Fatalf("unexpected error: %+v", errInfo)
+	}
+	if len(results) != 2 || len(results[1].Rows) != 4 {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	s = NewLedgerSession(testLedger + "\n2024-03-01 * \"Payee\" \"Narration\"\n  Assets:Cash  1" + strings.Repeat("0", 400) + " USD\n")
+	results, errInfo = s.QueryScript("SELECT account; SELECT payee")
+	if errInfo != nil {
+		t.Fatalf("unexpected error: %+v", errInfo)
+	}
+	for _, r := range results {
+		if len(r.Rows) != 12 || len(r.LedgerErrors) != 1 || r.LedgerErrors[0].Code != CodeInvalidAmount {
+			t.Errorf("expected the valid postings and the ledger error, got %+v", r)
+		}
+	}
+}
+
+func TestRenderScript(t *testing.T) {
+	results := []*Result{
+		{Columns: []string{"a"}, Rows: [][]interface{}{{"x"}}},
+		{Columns: []string{"n"}, Rows: [][]interface{}{{1.0}}},
+	}
+	out, err := RenderScript(results, FormatCSV)
+	if err != nil || out != "a\nx\n\nn\n1\n" {
+		t.Errorf("csv: %q, %v", out, err)
+	}
+	out, err = RenderScript(results, FormatJSON)
+	if err != nil || out != `{"results":[{"columns":["a"],"rows":[["x"]]},{"columns":["n"],"rows":[[1]]}]}` {
+		t.Errorf("json: %s, %v", out, err)
+	}
+}
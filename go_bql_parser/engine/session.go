@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"sort"
+)
+
+// LedgerSession is a parsed ledger kept in memory so that many queries can
+// run against it without re-parsing the text. It backs the WIT ledger
+// resource.
+type LedgerSession struct {
+	Ledger *Ledger
+
+	files   []SourceFile
+	loadErr error
+	syntax  *SyntaxResult
+
+	// Indexes derived once at load time.
+	rows       []postingRow
+	accounts   []string
+	currencies []string
+}
+
+// LedgerStats summarises a loaded ledger.
+type LedgerStats struct {
+	Transactions int      `json:"transactions"`
+	Postings     int      `json:"postings"`
+	Accounts     int      `json:"accounts"`
+	Currencies   []string `json:"currencies"`
+	FirstDate    string   `json:"first_date,omitempty"`
+	LastDate     string   `json:"last_date,omitempty"`
+}
+
+// NewLedgerSession parses text and builds the indexes used by queries. The
+// syntax errors of the ledger are reported with the result of every query.
+func NewLedgerSession(text string) *LedgerSession {
+	parsed := ParseBeancount("", text)
+	return newLedgerSession(buildLedger(parsed), []SourceFile{{Text: text, Parsed: parsed}}, nil)
+}
+
+// LoadLedgerSession loads a multi-file ledger starting at entry, resolving
+// include directives through src. An include that cannot be loaded is kept
+// and reported by every subsequent query.
+func LoadLedgerSession(src FileSource, entry string) *LedgerSession {
+	ledger, files, err := LoadLedger(src, entry)
+	return newLedgerSession(ledger, files, err)
+}
+
+func newLedgerSession(ledger *Ledger, files []SourceFile, err error) *LedgerSession {
+	s := &LedgerSession{files: files}
+	if err != nil {
+		s.loadErr = err
+		s.Ledger = newLedger()
+		return s
+	}
+	s.Ledger = ledger
+	s.rows = buildRows(ledger)
+
+	accounts := make(map[string]bool)
+	currencies := make(map[string]bool)
+	for _, r := range s.rows {
+		accounts[r.pst.Account] = true
+		if r.pst.Currency != "" {
+			currencies[r.pst.Currency] = true
+		}
+	}
+	s.accounts = sortedKeys(accounts)
+	s.currencies = sortedKeys(currencies)
+	return s
+}
+
+// LoadError returns the error that prevented the ledger from loading, or
+// nil if it loaded.
+func (s *LedgerSession) LoadError() error {
+	return s.loadErr
+}
+
+// Files returns the files of the ledger in load order, with their syntax
+// trees. A ledger that failed to load keeps the files read before the
+// failure.
+func (s *LedgerSession) Files() []SourceFile {
+	return s.files
+}
+
+// Query parses and executes a BQL query against the ledger.
+func (s *LedgerSession) Query(query string) (*Result, *ErrorInfo) {
+	return s.QueryParams(query, nil)
+}
+
+// QueryParams parses a BQL query, binds its parameters to params and
+// executes it against the ledger.
+func (s *LedgerSession) QueryParams(query string, params Params) (*Result, *ErrorInfo) {
+	ast, err := Parse(query)
+	if err != nil {
+		return nil, NewErrorInfo(PhaseParse, err)
+	}
+	ast, err = Bind(ast, params)
+	if err != nil {
+		return nil, NewErrorInfo(PhaseBind, err)
+	}
+	if s.loadErr != nil {
+		return nil, NewErrorInfo(PhaseLedger, s.loadErr)
+	}
+	result, err := executeRows(ast, s.rows)
+	if err != nil {
+		return nil, NewErrorInfo(PhaseExecute, err)
+	}
+	result.describe(s.Ledger)
+	return result, nil
+}
+
+// QueryFormat executes a BQL query and renders the result in the named
+// output format.
+func (s *LedgerSession) QueryFormat(query, format string) (string, *ErrorInfo) {
+	f, err := ParseFormat(format)
+	if err != nil {
+		return "", NewErrorInfo(PhaseSerialize, err)
+	}
+	result, errInfo := s.Query(query)
+	if errInfo != nil {
+		return "", errInfo
+	}
+	return renderInfo(result, f)
+}
+
+// Check returns the diagnostics of every file of the ledger: the syntax
+// errors found when the files were parsed for loading, the errors of its
+// plugins, and the account checks across files. A ledger that failed to
+// load is checked as the files read before the failure. The result is
+// computed on first use and cached.
+func (s *LedgerSession) Check() *SyntaxResult {
+	if s.syntax == nil {
+		parsed := make([]*LedgerFile, len(s.files))
+		for i, f := range s.files {
+			parsed[i] = f.Parsed
+		}
+		ledger := s.Ledger
+		if s.loadErr != nil {
+			ledger = newLedger()
+			for _, f := range parsed {
+				appendLedgerFile(ledger, f, nil)
+			}
+			ledger.finish()
+		}
+		s.syntax = checkLedger(parsed, ledger)
+	}
+	return s.syntax
+}
+
+// Accounts returns the sorted names of all accounts used by postings.
+func (s *LedgerSession) Accounts() []string {
+	return s.accounts
+}
+
+// Stats returns counts and the date range of the ledger.
+func (s *LedgerSession) Stats() LedgerStats {
+	stats := LedgerStats{
+		Transactions: len(s.Ledger.Transactions),
+		Postings:     len(s.rows),
+		Accounts:     len(s.accounts),
+		Currencies:   s.currencies,
+	}
+	for _, txn := range s.Ledger.Transactions {
+		if stats.FirstDate == "" || txn.Date < stats.FirstDate {
+			stats.FirstDate = txn.Date
+		}
+		if txn.Date > stats.LastDate {
+			stats.LastDate = txn.Date
+		}
+	}
+	return stats
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLedgerSessionQueriesReuseParsedLedger(t *testing.T) {
+	s := NewLedgerSession(testLedger)
+
+	result, errInfo := s.Query("SELECT account, SUM(amount) WHERE account = 'Expenses:Food:Groceries' GROUP BY account")
+	if errInfo != nil {
+		t.Fatalf("Query failed: %+v", errInfo)
+	}
+	if len(result.Rows) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(result.Rows))
+	}
+
+	result, errInfo = s.Query("SELECT date, account")
+	if errInfo != nil {
+		t.Fatalf("Query failed: %+v", errInfo)
+	}
+	if len(result.Rows) != 12 {
+		t.Errorf("expected 12 rows, got %d", len(result.Rows))
+	}
+
+	// A filtering query must not affect the shared rows of later queries.
+	if _, errInfo := s.Query("SELECT account FROM 'Expenses:Rent'"); errInfo != nil {
+		t.Fatalf("Query failed: %+v", errInfo)
+	}
+	result, _ = s.Query("SELECT account")
+	if len(result.Rows) != 12 {
+		t.Errorf("expected 12 rows after filtered query, got %d", len(result.Rows))
+	}
+}
+
+func TestLedgerSessionQueryError(t *testing.T) {
+	s := NewLedgerSession(testLedger)
+	_, errInfo := s.Query("SELECT")
+	if errInfo == nil || errInfo.Phase != PhaseParse {
+		t.Fatalf("expected parse error, got %+v", errInfo)
+	}
+}
+
+func TestLedgerSessionLoadError(t *testing.T) {
+	s := LoadLedgerSession(MapSource{"main.beancount": "include \"missing.beancount\"\n"}, "main.beancount")
+	_, errInfo := s.Query("SELECT account")
+	if errInfo == nil || errInfo.Phase != PhaseLedger || errInfo.Code != CodeIncludeNotFound {
+		t.Fatalf("expected ledger error, got %+v", errInfo)
+	}
+}
+
+func TestLedgerSessionStats(t *testing.T) {
+	s := NewLedgerSession(testLedger)
+	stats := s.Stats()
+	want := LedgerStats{
+		Transactions: 6,
+		Postings:     12,
+		Accounts:     6,
+		Currencies:   []string{"USD"},
+		FirstDate:    "2024-01-15",
+		LastDate:     "2024-02-25",
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestLedgerSessionCheck(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.beancount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewLedgerSession(string(data))
+	if result := s.Check(); !result.Valid {
+		t.Errorf("expected valid ledger, got errors: %+v", result.Errors)
+	}
+
+	s = NewLedgerSession("garbage line\n")
+	if result := s.Check(); result.Valid {
+		t.Error("expected invalid ledger")
+	}
+}
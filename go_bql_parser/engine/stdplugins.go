@@ -0,0 +1,288 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// autoAccounts is beancount.plugins.auto_accounts: it opens every account
+// that is used but never opened, on the earliest date it is used. Each
+// open is inserted before the first entry that uses the account.
+func autoAccounts(entries []Entry, opts *Options, config string) ([]Entry, []SyntaxError) {
+	opened := make(map[string]bool)
+	firstDate := make(map[string]string)
+	for _, e := range entries {
+		if e.Kind == "open" {
+			opened[e.Account] = true
+			continue
+		}
+		for _, ref := range e.accountRefs() {
+			if d, ok := firstDate[ref.Text]; !ok || e.Date < d {
+				firstDate[ref.Text] = e.Date
+			}
+		}
+	}
+
+	out := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		if e.Kind != "open" {
+			for _, ref := range e.accountRefs() {
+				if opened[ref.Text] {
+					continue
+				}
+				opened[ref.Text] = true
+				out = append(out, Entry{File: e.File, Directive: &Directive{
+					Kind:    "open",
+					Span:    ref.Span,
+					Date:    firstDate[ref.Text],
+					Account: ref.Text,
+					Args:    []LedgerToken{ref},
+				}})
+			}
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// implicitPrices is beancount.plugins.implicit_prices: it adds a price
+// entry for every posting with a price, or else with a cost, on the date
+// of its transaction. The price is per unit, so a total price or cost is
+// divided by the number of units. A price already entered for the same
+// date, commodity and value is not added again.
+func implicitPrices(entries []Entry, opts *Options, config string) ([]Entry, []SyntaxError) {
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if e.Kind == "price" {
+			seen[priceKey(e.Date, e.Args[0].Text, e.Args[1].Text, e.Args[2].Text)] = true
+		}
+	}
+
+	out := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e)
+		if e.Kind != "transaction" {
+			continue
+		}
+		for _, pn := range e.Postings {
+			if pn.Amount == nil {
+				continue
+			}
+			value, currency, ok := postingPrice(pn)
+			if !ok {
+				continue
+			}
+			number := formatNumber(value)
+			key := priceKey(e.Date, pn.Amount.Currency, number, currency)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, Entry{File: e.File, Directive: &Directive{
+				Kind: "price",
+				Span: pn.Span,
+				Date: e.Date,
+				Args: []LedgerToken{
+					{Kind: TokenCurrency, Text: pn.Amount.Currency, Value: pn.Amount.Currency, Span: pn.Amount.Span},
+					{Kind: TokenNumber, Text: number, Value: number, Span: pn.Span},
+					{Kind: TokenCurrency, Text: currency, Value: currency, Span: pn.Span},
+				},
+			}})
+		}
+	}
+	return out, nil
+}
+
+func priceKey(date, commodity, number, currency string) string {
+	if v, err := parseNumber(number); err == nil {
+		number = formatNumber(v)
+	}
+	return date + " " + commodity + " " + number + " " + currency
+}
+
+// postingPrice returns the price of one unit of a posting: its @ price, its
+// @@ price divided by its units, or else the number and currency that
+// start its cost, divided by its units for a {{...}} total cost.
+func postingPrice(pn *PostingNode) (float64, string, bool) {
+	units, err := parseNumber(pn.Amount.Number)
+	if err != nil {
+		return 0, "", false
+	}
+	perUnit := func(total float64) (float64, bool) {
+		if units == 0 {
+			return 0, false
+		}
+		return math.Abs(total / units), true
+	}
+
+	if pn.Price != nil {
+		v, err := parseNumber(pn.Price.Number)
+		if err != nil {
+			return 0, "", false
+		}
+		if pn.TotalPrice {
+			var ok bool
+			if v, ok = perUnit(v); !ok {
+				return 0, "", false
+			}
+		}
+		return v, pn.Price.Currency, true
+	}
+
+	toks := tokenizeLedger(pn.Cost)
+	for i := 0; i+1 < len(toks); i++ {
+		if toks[i].Kind != TokenNumber || toks[i+1].Kind != TokenCurrency {
+			continue
+		}
+		v, err := parseNumber(toks[i].Text)
+		if err != nil {
+			return 0, "", false
+		}
+		if strings.HasPrefix(pn.Cost, "{{") {
+			var ok bool
+			if v, ok = perUnit(v); !ok {
+				return 0, "", false
+			}
+		}
+		return v, toks[i+1].Text, true
+	}
+	return 0, "", false
+}
+
+// checkCommodity is beancount.plugins.check_commodity: it reports every
+// currency that is used without a commodity directive, once, where it is
+// first used.
+func checkCommodity(entries []Entry, opts *Options, config string) ([]Entry, []SyntaxError) {
+	declared := make(map[string]bool)
+	for _, e := range entries {
+		if e.Kind == "commodity" {
+			declared[e.Args[0].Text] = true
+		}
+	}
+	var errs []SyntaxError
+	report := func(file, currency string, at Span) {
+		if declared[currency] {
+			return
+		}
+		declared[currency] = true
+		errs = append(errs, SyntaxError{
+			File:     file,
+			Span:     at,
+			Severity: SeverityError,
+			Code:     CodeUndeclaredCommodity,
+			Message:  fmt.Sprintf("commodity %s is used but not declared", currency),
+		})
+	}
+	for _, e := range entries {
+		if e.Kind == "commodity" {
+			continue
+		}
+		for _, t := range e.Args {
+			if t.Kind == TokenCurrency {
+				report(e.File, t.Text, t.Span)
+			}
+		}
+		for _, pn := range e.Postings {
+			for _, a := range []*AmountNode{pn.Amount, pn.Price} {
+				if a != nil {
+					report(e.File, a.Currency, currencySpan(a))
+				}
+			}
+		}
+	}
+	return entries, errs
+}
+
+// currencySpan returns the span of the currency of an amount.
+func currencySpan(a *AmountNode) Span {
+	return Span{
+		Line:      a.Span.EndLine,
+		Column:    a.Span.EndColumn - utf8.RuneCountInString(a.Currency),
+		EndLine:   a.Span.EndLine,
+		EndColumn: a.Span.EndColumn,
+	}
+}
+
+// leafOnly is beancount.plugins.leafonly: it reports every posting to an
+// account that has sub-accounts, opened or used anywhere in the ledger.
+func leafOnly(entries []Entry, opts *Options, config string) ([]Entry, []SyntaxError) {
+	parents := make(map[string]bool)
+	for _, e := range entries {
+		for _, ref := range e.accountRefs() {
+			for i := strings.LastIndexByte(ref.Text, ':'); i > 0; i = strings.LastIndexByte(ref.Text[:i], ':') {
+				parents[ref.Text[:i]] = true
+			}
+		}
+	}
+	var errs []SyntaxError
+	for _, e := range entries {
+		for _, pn := range e.Postings {
+			if parents[pn.Account] {
+				errs = append(errs, SyntaxError{
+					File:     e.File,
+					Span:     pn.AccountSpan,
+					Severity: SeverityError,
+					Code:     CodeNonLeafAccount,
+					Message:  fmt.Sprintf("posting to non-leaf account %s", pn.Account),
+				})
+			}
+		}
+	}
+	return entries, errs
+}
+
+// noDuplicates is beancount.plugins.noduplicates: it reports every
+// transaction that repeats an earlier one exactly, apart from metadata.
+// Numbers are compared by value, so 45.2 repeats 45.20.
+func noDuplicates(entries []Entry, opts *Options, config string) ([]Entry, []SyntaxError) {
+	first := make(map[string]Entry)
+	var errs []SyntaxError
+	for _, e := range entries {
+		if e.Kind != "transaction" {
+			continue
+		}
+		key := transactionKey(e.Directive)
+		orig, ok := first[key]
+		if !ok {
+			first[key] = e
+			continue
+		}
+		errs = append(errs, SyntaxError{
+			File:     e.File,
+			Span:     headerSpan(e.Directive),
+			Severity: SeverityError,
+			Code:     CodeDuplicateTransaction,
+			Message:  fmt.Sprintf("duplicate transaction %s %q", e.Date, e.Narration),
+			Related:  []RelatedLocation{{File: orig.File, Span: headerSpan(orig.Directive), Message: "first entered here"}},
+		})
+	}
+	return entries, errs
+}
+
+// transactionKey returns a string that two transactions share when they
+// are the same apart from metadata.
+func transactionKey(d *Directive) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %q %q %q %q", d.Date, d.Flag, d.Payee, d.Narration, d.Tags, d.Links)
+	amount := func(a *AmountNode) string {
+		if a == nil {
+			return ""
+		}
+		if v, err := parseNumber(a.Number); err == nil {
+			return formatNumber(v) + " " + a.Currency
+		}
+		return a.Number + " " + a.Currency
+	}
+	for _, pn := range d.Postings {
+		fmt.Fprintf(&b, "\n%s %s %s %s %t %s", pn.Flag, pn.Account, amount(pn.Amount), canonicalText(pn.Cost), pn.TotalPrice, amount(pn.Price))
+	}
+	return b.String()
+}
+
+// headerSpan returns the span of the date that starts a directive, where
+// diagnostics about the whole directive point.
+func headerSpan(d *Directive) Span {
+	return Span{Line: d.Span.Line, Column: d.Span.Column, EndLine: d.Span.Line, EndColumn: d.Span.Column + len(d.Date)}
+}
@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Severity ranks a diagnostic. Only errors make a ledger invalid.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Stable codes of ledger diagnostics. Errors start with E_ and warnings
+// with W_; unterminated strings share CodeUnclosedString with BQL.
+const (
+	CodeUnrecognizedLine   = "E_UNRECOGNIZED_LINE"
+	CodeUnexpectedIndent   = "E_UNEXPECTED_INDENT"
+	CodeUnexpectedToken    = "E_UNEXPECTED_TOKEN"
+	CodeInvalidDate        = "E_INVALID_DATE"
+	CodeMissingDirective   = "E_MISSING_DIRECTIVE"
+	CodeUnknownDirective   = "E_UNKNOWN_DIRECTIVE"
+	CodeDirectiveArguments = "E_DIRECTIVE_ARGUMENTS"
+	CodeMissingFlag        = "E_MISSING_FLAG"
+	CodeMissingNarration   = "E_MISSING_NARRATION"
+	CodeUnquotedNarration  = "E_UNQUOTED_NARRATION"
+	CodeTxnHeader          = "E_TXN_HEADER"
+	CodeTxnNoPostings      = "E_TXN_NO_POSTINGS"
+	CodeInvalidPosting     = "E_INVALID_POSTING"
+	CodeInvalidMetadata    = "E_INVALID_METADATA"
+	CodeDuplicateOpen      = "E_DUPLICATE_OPEN"
+	CodeInvalidOption      = "E_INVALID_OPTION"
+	CodeInvalidAccount     = "E_INVALID_ACCOUNT"
+	CodeUnknownRoot        = "E_UNKNOWN_ACCOUNT_ROOT"
+
+	// Errors of the built-in plugins.
+	CodeUndeclaredCommodity  = "E_UNDECLARED_COMMODITY"
+	CodeNonLeafAccount       = "E_NON_LEAF_ACCOUNT"
+	CodeDuplicateTransaction = "E_DUPLICATE_TRANSACTION"
+
+	CodeAccountNotOpen    = "W_ACCOUNT_NOT_OPEN"
+	CodeUnusedAccount     = "W_UNUSED_ACCOUNT"
+	CodeUnknownOption     = "W_UNKNOWN_OPTION"
+	CodeUnknownPlugin     = "W_UNKNOWN_PLUGIN"
+	CodePossibleDuplicate = "W_POSSIBLE_DUPLICATE"
+)
+
+// SyntaxError is a diagnostic of the ledger checker: a syntax error, or a
+// warning about the ledger's accounts. The embedded span gives its start
+// and end line and column. Related points at other places involved, such
+// as the first open of an account opened twice.
+type SyntaxError struct {
+	File string `json:"file,omitempty"`
+	Span
+	Severity Severity          `json:"severity"`
+	Code     string            `json:"code"`
+	Message  string            `json:"message"`
+	Related  []RelatedLocation `json:"related,omitempty"`
+}
+
+// RelatedLocation is a place in a ledger referred to by a diagnostic.
+type RelatedLocation struct {
+	File string `json:"file,omitempty"`
+	Span
+	Message string `json:"message"`
+}
+
+// SyntaxResult is the outcome of checking a ledger. Valid is false when
+// any diagnostic is an error.
+type SyntaxResult struct {
+	Valid  bool          `json:"valid"`
+	Errors []SyntaxError `json:"errors"`
+}
+
+// CheckSyntax parses a Beancount ledger and returns its syntax errors, the
+// errors of the plugins it enables, the account checks of checkAccounts,
+// its invalid account names and its likely duplicate transactions. The
+// ledger loader uses the same parser, so every line reported as a syntax
+// error is one the loader skips. The other errors, such as
+// E_DUPLICATE_OPEN, E_INVALID_ACCOUNT, E_UNKNOWN_ACCOUNT_ROOT and those of
+// plugins, are advisory: the loader keeps the entries they point at.
+func CheckSyntax(text string) *SyntaxResult {
+	file := ParseBeancount("", text)
+	return checkLedger([]*LedgerFile{file}, buildLedger(file))
+}
+
+// checkLedger returns the diagnostics of a ledger loaded from the parsed
+// files: its errors, the account checks of its entries, their invalid
+// account names and their likely duplicates, grouped by file in order and
+// sorted by position within each file. Duplicates reported by the
+// noduplicates plugin are not reported again as likely ones.
+func checkLedger(files []*LedgerFile, ledger *Ledger) *SyntaxResult {
+	byFile := make(map[string][]SyntaxError)
+	reported := make(map[RelatedLocation]bool)
+	diags := append(append([]SyntaxError{}, ledger.Errors...), checkAccounts(ledger.Entries)...)
+	for _, d := range append(diags, checkAccountNames(ledger.Entries, &ledger.Options)...) {
+		byFile[d.File] = append(byFile[d.File], d)
+		if d.Code == CodeDuplicateTransaction {
+			reported[RelatedLocation{File: d.File, Span: d.Span}] = true
+		}
+	}
+	for _, d := range checkDuplicates(ledger.Entries, DuplicateOptions{tolerances: &ledger.Options}) {
+		if !reported[RelatedLocation{File: d.File, Span: d.Span}] {
+			byFile[d.File] = append(byFile[d.File], d)
+		}
+	}
+	result := &SyntaxResult{Valid: true, Errors: []SyntaxError{}}
+	for _, f := range files {
+		diags := byFile[f.Name]
+		sortDiagnostics(diags)
+		for _, d := range diags {
+			if d.Severity == SeverityError {
+				result.Valid = false
+			}
+		}
+		result.Errors = append(result.Errors, diags...)
+	}
+	return result
+}
+
+// sortDiagnostics sorts diagnostics of one file by position, keeping the
+// order of those at the same place.
+func sortDiagnostics(diags []SyntaxError) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Column < diags[j].Column
+	})
+}
+
+// checkAccounts checks the accounts of a ledger's entries. An account
+// opened twice is an error; an account opened and never used is a
+// warning. When the ledger opens any account, postings to accounts it
+// never opens are warnings too; ledgers without open directives are taken
+// to be fragments and not checked for them.
+func checkAccounts(entries []Entry) []SyntaxError {
+	type opening struct {
+		file string
+		span Span
+	}
+	opens := make(map[string]opening)
+	var order []string
+	used := make(map[string]bool)
+	var diags []SyntaxError
+
+	for _, e := range entries {
+		if e.Kind != "open" {
+			for _, ref := range e.accountRefs() {
+				used[ref.Text] = true
+			}
+			continue
+		}
+		at := accountSpan(e.Directive)
+		if first, ok := opens[e.Account]; ok {
+			diags = append(diags, SyntaxError{
+				File:     e.File,
+				Span:     at,
+				Severity: SeverityError,
+				Code:     CodeDuplicateOpen,
+				Message:  fmt.Sprintf("account %s is already open", e.Account),
+				Related:  []RelatedLocation{{File: first.file, Span: first.span, Message: "first opened here"}},
+			})
+			continue
+		}
+		opens[e.Account] = opening{file: e.File, span: at}
+		order = append(order, e.Account)
+	}
+
+	for _, account := range order {
+		if !used[account] {
+			o := opens[account]
+			diags = append(diags, SyntaxError{
+				File:     o.file,
+				Span:     o.span,
+				Severity: SeverityWarning,
+				Code:     CodeUnusedAccount,
+				Message:  fmt.Sprintf("account %s is opened but never used", account),
+			})
+		}
+	}
+	if len(opens) == 0 {
+		return diags
+	}
+	for _, e := range entries {
+		for _, pn := range e.Postings {
+			if _, ok := opens[pn.Account]; !ok {
+				diags = append(diags, SyntaxError{
+					File:     e.File,
+					Span:     pn.AccountSpan,
+					Severity: SeverityWarning,
+					Code:     CodeAccountNotOpen,
+					Message:  fmt.Sprintf("account %s is used but never opened", pn.Account),
+				})
+			}
+		}
+	}
+	return diags
+}
+
+// checkAccountNames reports every account of entries whose name breaks
+// Beancount's rules: its root must be one of the roots of opts, and each
+// other component must start with a capital letter or a digit and contain
+// only letters, digits and hyphens. Letters without case, as in Chinese or
+// Japanese, count as capitals. Each diagnostic points at the component at
+// fault.
+func checkAccountNames(entries []Entry, opts *Options) []SyntaxError {
+	roots := opts.Roots()
+	seen := make(map[RelatedLocation]bool)
+	var diags []SyntaxError
+	for _, e := range entries {
+		for _, ref := range e.accountRefs() {
+			// Opens added by auto_accounts share the span of the use.
+			at := RelatedLocation{File: e.File, Span: ref.Span}
+			if seen[at] {
+				continue
+			}
+			seen[at] = true
+			i, code, msg := accountNameError(ref.Text, roots)
+			if code == "" {
+				continue
+			}
+			diags = append(diags, SyntaxError{
+				File:     e.File,
+				Span:     componentSpan(ref, i),
+				Severity: SeverityError,
+				Code:     code,
+				Message:  msg,
+			})
+		}
+	}
+	return diags
+}
+
+// accountNameError returns the index of the first invalid component of
+// account, with the code and message of its diagnostic, or an empty code
+// when the name is valid.
+func accountNameError(account string, roots []string) (int, string, string) {
+	components := strings.Split(account, ":")
+	root := components[0]
+	if !slices.Contains(roots, root) {
+		msg := fmt.Sprintf("account %s has unknown root %q, expected one of %s", account, root, strings.Join(roots, ", "))
+		for _, r := range roots {
+			if strings.EqualFold(r, root) {
+				msg = fmt.Sprintf("account %s has unknown root %q, did you mean %s?", account, root, r)
+			}
+		}
+		return 0, CodeUnknownRoot, msg
+	}
+	for i, c := range components[1:] {
+		first, _ := utf8.DecodeRuneInString(c)
+		switch {
+		case c == "":
+			return i + 1, CodeInvalidAccount, fmt.Sprintf("account %s has an empty component", account)
+		case !unicode.IsUpper(first) && !unicode.IsDigit(first) && !unicode.Is(unicode.Lo, first):
+			return i + 1, CodeInvalidAccount, fmt.Sprintf("account component %q of %s must start with a capital letter or a digit", c, account)
+		}
+		for _, r := range c {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' {
+				return i + 1, CodeInvalidAccount, fmt.Sprintf("account component %q of %s contains %q; only letters, digits and hyphens are allowed", c, account, r)
+			}
+		}
+	}
+	return 0, "", ""
+}
+
+// componentSpan returns the span of the i-th colon-separated component of
+// an account token.
+func componentSpan(ref LedgerToken, i int) Span {
+	components := strings.Split(ref.Text, ":")
+	col := ref.Span.Column
+	for _, c := range components[:i] {
+		col += utf8.RuneCountInString(c) + 1
+	}
+	return Span{Line: ref.Span.Line, Column: col, EndLine: ref.Span.Line, EndColumn: col + utf8.RuneCountInString(components[i])}
+}
+
+// accountSpan returns the span of the account argument of a directive.
+func accountSpan(d *Directive) Span {
+	for _, t := range d.Args {
+		if t.Kind == TokenAccount {
+			return t.Span
+		}
+	}
+	return d.Span
+}
+
+func CheckBeancountSyntax(ledgerText string) string {
+	result := CheckSyntax(ledgerText)
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		return errorJSON(PhaseSerialize, err)
+	}
+	return string(jsonResult)
+}
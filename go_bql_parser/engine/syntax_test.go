@@ -1,4 +1,4 @@
-package main
+package engine
 
 import (
 	"encoding/json"
@@ -200,3 +200,74 @@ func TestCheckSyntax_TransactionNoPostingsAtEOF(t *testing.T) {
 		t.Errorf("unexpected message: %s", result.Errors[0].Message)
 	}
 }
+
+func TestCheckSyntax_Diagnostics(t *testing.T) {
+	input := `2024-01-01 open Assets:Cash USD
+2024-01-01 open Expenses:Food USD
+
+2024-01-05 * "Grocer" "Groceries"
+  Expenses:Food     12.00 USD
+  Assets:Wallet    -12.00 USD
+`
+	result := CheckSyntax(input)
+	if !result.Valid {
+		t.Fatalf("expected warnings only, got %+v", result.Errors)
+	}
+	if len(result.Errors) != 2 {
+		t.Fatalf("expected 2 warnings, got %+v", result.Errors)
+	}
+	unused, unopened := result.Errors[0], result.Errors[1]
+	if unused.Code != CodeUnusedAccount || unused.Span != (Span{Line: 1, Column: 17, EndLine: 1, EndColumn: 28}) {
+		t.Errorf("unexpected unused account warning: %+v", unused)
+	}
+	if unopened.Code != CodeAccountNotOpen || unopened.Severity != SeverityWarning || unopened.Line != 6 || unopened.Column != 3 {
+		t.Errorf("unexpected unopened account warning: %+v", unopened)
+	}
+}
+
+func TestCheckSyntax_DuplicateOpen(t *testing.T) {
+	input := "2024-01-01 open Assets:Cash\n2024-02-01 open Assets:Cash\n2024-03-01 close Assets:Cash\n"
+	result := CheckSyntax(input)
+	if result.Valid || len(result.Errors) != 1 {
+		t.Fatalf("expected one error, got %+v", result.Errors)
+	}
+	e := result.Errors[0]
+	if e.Code != CodeDuplicateOpen || e.Line != 2 || len(e.Related) != 1 || e.Related[0].Line != 1 || e.Related[0].Column != 17 {
+		t.Errorf("unexpected diagnostic: %+v", e)
+	}
+}
+
+func TestCheckSyntax_AccountNames(t *testing.T) {
+	input := `option "name_assets" "Vermögen"
+2024-01-01 open Vermögen:Bank:Girokonto
+2024-01-01 open Assets:Cash
+2024-01-02 * "Shop"
+  expenses:food   5 EUR
+  Expenses:Café:2024   5 EUR
+  Expenses:資産   1 EUR
+  Expenses:My_Stuff   1 EUR
+  Expenses:food   1 EUR
+  Vermögen:Bank:Girokonto
+`
+	want := []SyntaxError{
+		{Span: Span{Line: 3, Column: 17, EndLine: 3, EndColumn: 23}, Severity: SeverityError, Code: CodeUnknownRoot, Message: `account Assets:Cash has unknown root "Assets", expected one of Vermögen, Liabilities, Equity, Income, Expenses`},
+		{Span: Span{Line: 5, Column: 3, EndLine: 5, EndColumn: 11}, Severity: SeverityError, Code: CodeUnknownRoot, Message: `account expenses:food has unknown root "expenses", did you mean Expenses?`},
+		{Span: Span{Line: 8, Column: 12, EndLine: 8, EndColumn: 20}, Severity: SeverityError, Code: CodeInvalidAccount, Message: `account component "My_Stuff" of Expenses:My_Stuff contains '_'; only letters, digits and hyphens are allowed`},
+		{Span: Span{Line: 9, Column: 12, EndLine: 9, EndColumn: 16}, Severity: SeverityError, Code: CodeInvalidAccount, Message: `account component "food" of Expenses:food must start with a capital letter or a digit`},
+	}
+	var got []SyntaxError
+	for _, d := range CheckSyntax(input).Errors {
+		if d.Code == CodeUnknownRoot || d.Code == CodeInvalidAccount {
+			got = append(got, d)
+		}
+	}
+	if got, want := formatDiagnostics(got), formatDiagnostics(want); got != want {
+		t.Errorf("unexpected diagnostics:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Accounts opened by auto_accounts are reported once, at their use.
+	result := CheckSyntax("plugin \"beancount.plugins.auto_accounts\"\n2024-01-02 * \"Shop\"\n  Expenses:Food:   5 EUR\n  Assets:Cash\n")
+	if len(result.Errors) != 1 || result.Errors[0].Code != CodeInvalidAccount || result.Errors[0].Message != "account Expenses:Food: has an empty component" {
+		t.Errorf("expected one empty component, got %+v", result.Errors)
+	}
+}
@@ -1,7 +1,7 @@
 // Code generated by goyacc -o y.go bql.y. DO NOT EDIT.
 
 //line bql.y:2
-package main
+package engine
 
 import __yyfmt__ "fmt"
 
@@ -30,9 +30,14 @@ const ORDER = 57350
 const BY = 57351
 const ASC = 57352
 const DESC = 57353
-const IDENT = 57354
-const STRING = 57355
-const EQ = 57356
+const IN = 57354
+const PIVOT = 57355
+const PRINT = 57356
+const IDENT = 57357
+const STRING = 57358
+const NUMBER = 57359
+const PARAM = 57360
+const EQ = 57361
 
 var yyToknames = [...]string{
 	"$end",
@@ -46,9 +51,15 @@ var yyToknames = [...]string{
 	"BY",
 	"ASC",
 	"DESC",
+	"IN",
+	"PIVOT",
+	"PRINT",
 	"IDENT",
 	"STRING",
+	"NUMBER",
+	"PARAM",
 	"EQ",
+	"';'",
 	"','",
 	"'('",
 	"')'",
@@ -61,7 +72,7 @@ const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line bql.y:133
+//line bql.y:206
 
 //line yacctab:1
 var yyExca = [...]int8{
@@ -72,51 +83,65 @@ var yyExca = [...]int8{
 
 const yyPrivate = 57344
 
-const yyLast = 40
+const yyLast = 68
 
 var yyAct = [...]int8{
-	4, 30, 21, 3, 5, 7, 8, 20, 12, 9,
-	15, 32, 7, 14, 25, 28, 7, 13, 5, 34,
-	35, 26, 19, 24, 23, 17, 11, 31, 27, 2,
-	18, 33, 29, 31, 36, 22, 16, 10, 6, 1,
+	11, 53, 10, 12, 4, 22, 17, 23, 36, 24,
+	55, 45, 30, 28, 18, 43, 37, 19, 26, 17,
+	57, 9, 29, 20, 27, 39, 23, 12, 24, 32,
+	17, 6, 38, 35, 47, 59, 60, 3, 51, 48,
+	25, 7, 42, 41, 44, 49, 34, 15, 21, 54,
+	50, 14, 6, 8, 56, 2, 1, 31, 54, 61,
+	58, 52, 46, 40, 33, 13, 16, 5,
 }
 
 var yyPact = [...]int16{
-	25, -1000, 6, 1, -1000, -7, 20, 6, 4, -8,
-	18, 10, -1000, -1000, -10, -15, 16, 14, -1000, 0,
-	-1000, -1000, -1000, 12, 6, 2, 6, -3, -1000, -4,
-	-1000, 9, 6, -1000, -1000, -1000, -1000,
+	27, -1000, 1, -1000, -1000, -1000, 12, 46, -1000, 27,
+	9, -1000, -5, 42, 10, -1000, 42, 12, -9, -12,
+	-1000, 14, -1000, -1000, -1000, 39, -1000, -1000, 48, -15,
+	-7, -1000, 13, 35, 33, -8, -1000, -1000, 10, -11,
+	21, 30, 12, -1000, -1000, 48, -1000, 29, 12, -2,
+	-13, 12, -1, -1000, 25, -1000, -2, 12, -1000, -1000,
+	-1000, -1000,
 }
 
 var yyPgo = [...]int8{
-	0, 39, 3, 0, 38, 37, 36, 35, 32, 1,
-	31, 30,
+	0, 37, 4, 67, 2, 0, 66, 65, 5, 23,
+	64, 63, 62, 61, 1, 60, 57, 56, 55, 53,
 }
 
 var yyR1 = [...]int8{
-	0, 1, 2, 2, 3, 3, 3, 4, 4, 5,
-	5, 11, 6, 6, 7, 7, 8, 8, 9, 10,
-	10, 10,
+	0, 17, 18, 18, 19, 19, 1, 1, 3, 2,
+	4, 4, 5, 5, 5, 6, 6, 6, 7, 7,
+	9, 9, 16, 16, 8, 8, 10, 10, 11, 11,
+	13, 13, 14, 12, 12, 15, 15, 15,
 }
 
 var yyR2 = [...]int8{
-	0, 6, 1, 3, 1, 4, 4, 0, 2, 0,
-	2, 3, 0, 3, 0, 3, 1, 3, 2, 0,
-	1, 1,
+	0, 2, 1, 3, 0, 1, 1, 1, 3, 7,
+	1, 3, 1, 4, 4, 0, 2, 4, 0, 2,
+	0, 2, 3, 5, 1, 1, 0, 3, 0, 3,
+	1, 3, 2, 0, 3, 0, 1, 1,
 }
 
 var yyChk = [...]int16{
-	-1000, -1, 4, -2, -3, 12, -4, 15, 5, 16,
-	-5, 6, -3, 13, -2, 18, -6, 7, -11, 12,
-	17, 17, -7, 8, 9, 14, 9, -2, 13, -8,
-	-9, -3, 15, -10, 10, 11, -9,
+	-1000, -17, -18, -1, -2, -3, 4, 14, -19, 20,
+	-4, -5, 15, -7, 5, -1, -6, 21, 5, 22,
+	-9, 6, -8, 16, 18, -9, -5, -8, 22, -4,
+	24, -16, 15, -10, 7, -2, 23, 23, 19, 12,
+	-11, 8, 9, 23, -8, 22, -12, 13, 9, -4,
+	-2, 9, -13, -14, -5, 23, -4, 21, -15, 10,
+	11, -14,
 }
 
 var yyDef = [...]int8{
-	0, -2, 0, 7, 2, 4, 9, 0, 0, 0,
-	12, 0, 3, 8, 0, 0, 14, 0, 10, 0,
-	5, 6, 1, 0, 0, 0, 0, 13, 11, 15,
-	16, 19, 0, 18, 20, 21, 17,
+	0, -2, 4, 2, 6, 7, 0, 18, 1, 5,
+	15, 10, 12, 20, 0, 3, 20, 0, 0, 0,
+	8, 0, 19, 24, 25, 26, 11, 16, 0, 0,
+	0, 21, 0, 28, 0, 0, 13, 14, 0, 0,
+	33, 0, 0, 17, 22, 0, 9, 0, 0, 27,
+	0, 0, 29, 30, 35, 23, 34, 0, 32, 36,
+	37, 31,
 }
 
 var yyTok1 = [...]int8{
@@ -124,12 +149,13 @@ var yyTok1 = [...]int8{
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	16, 17, 18, 3, 15,
+	22, 23, 24, 3, 21, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 20,
 }
 
 var yyTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
-	12, 13, 14,
+	12, 13, 14, 15, 16, 17, 18, 19,
 }
 
 var yyTok3 = [...]int8{
@@ -473,139 +499,217 @@ yydefault:
 	// dummy call; replaced with literal code
 	switch yynt {
 
-	case 1:
-		yyDollar = yyS[yypt-6 : yypt+1]
-//line bql.y:41
+	case 6:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line bql.y:62
+		{
+			l := yylex.(*BQLLexer)
+			l.results = append(l.results, yyDollar[1].query)
+		}
+	case 7:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line bql.y:67
+		{
+			l := yylex.(*BQLLexer)
+			l.results = append(l.results, yyDollar[1].query)
+		}
+	case 8:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line bql.y:77
+		{
+			yyVAL.query = &Query{
+				Print:      true,
+				Select:     []Expression{},
+				From:       yyDollar[2].expr.Literal,
+				FromParam:  yyDollar[2].expr.Param,
+				Where:      yyDollar[3].whereClause.expr,
+				WhereField: yyDollar[3].whereClause.field,
+			}
+		}
+	case 9:
+		yyDollar = yyS[yypt-7 : yypt+1]
+//line bql.y:91
 		{
 			yyVAL.query = &Query{
 				Select:     yyDollar[2].exprs,
-				From:       yyDollar[3].str,
+				From:       yyDollar[3].expr.Literal,
+				FromParam:  yyDollar[3].expr.Param,
+				FromQuery:  yyDollar[3].expr.Subquery,
 				Where:      yyDollar[4].whereClause.expr,
 				WhereField: yyDollar[4].whereClause.field,
 				GroupBy:    yyDollar[5].exprs,
 				OrderBy:    yyDollar[6].orderBys,
+				PivotBy:    yyDollar[7].exprs,
 			}
-			yylex.(*BQLLexer).result = yyVAL.query
 		}
-	case 2:
+	case 10:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line bql.y:56
+//line bql.y:108
 		{
 			yyVAL.exprs = []Expression{yyDollar[1].expr}
 		}
-	case 3:
+	case 11:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line bql.y:60
+//line bql.y:112
 		{
 			yyVAL.exprs = append(yyDollar[1].exprs, yyDollar[3].expr)
 		}
-	case 4:
+	case 12:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line bql.y:67
+//line bql.y:119
 		{
 			yyVAL.expr = Expression{Literal: yyDollar[1].str}
 		}
-	case 5:
+	case 13:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line bql.y:71
+//line bql.y:123
 		{
 			yyVAL.expr = Expression{FuncName: yyDollar[1].str, FuncArgs: yyDollar[3].exprs}
 		}
-	case 6:
+	case 14:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line bql.y:75
+//line bql.y:127
 		{
 			yyVAL.expr = Expression{FuncName: yyDollar[1].str, FuncArgs: []Expression{{Literal: "*"}}}
 		}
-	case 7:
+	case 15:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line bql.y:81
+//line bql.y:133
 		{
-			yyVAL.str = ""
+			yyVAL.expr = Expression{}
 		}
-	case 8:
+	case 16:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line bql.y:82
+//line bql.y:134
 		{
-			yyVAL.str = yyDollar[2].str
+			yyVAL.expr = yyDollar[2].expr
 		}
-	case 9:
+	case 17:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line bql.y:135
+		{
+			yyVAL.expr = Expression{Subquery: yyDollar[3].query}
+		}
+	case 18:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line bql.y:139
+		{
+			yyVAL.expr = Expression{}
+		}
+	case 19:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line bql.y:140
+		{
+			yyVAL.expr = yyDollar[2].expr
+		}
+	case 20:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line bql.y:86
+//line bql.y:144
 		{
 			yyVAL.whereClause.field = ""
 			yyVAL.whereClause.expr = Expression{}
 		}
-	case 10:
+	case 21:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line bql.y:87
+//line bql.y:145
 		{
 			yyVAL.whereClause = yyDollar[2].whereClause
 		}
-	case 11:
+	case 22:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line bql.y:92
+//line bql.y:150
 		{
 			yyVAL.whereClause.field = yyDollar[1].str
-			yyVAL.whereClause.expr = Expression{Literal: yyDollar[3].str}
+			yyVAL.whereClause.expr = yyDollar[3].expr
 		}
-	case 12:
+	case 23:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line bql.y:155
+		{
+			yyVAL.whereClause.field = yyDollar[1].str
+			yyVAL.whereClause.expr = Expression{Subquery: yyDollar[4].query}
+		}
+	case 24:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line bql.y:162
+		{
+			yyVAL.expr = Expression{Literal: yyDollar[1].str}
+		}
+	case 25:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line bql.y:163
+		{
+			yyVAL.expr = Expression{Param: yyDollar[1].str}
+		}
+	case 26:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line bql.y:100
+//line bql.y:168
 		{
 			yyVAL.exprs = nil
 		}
-	case 13:
+	case 27:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line bql.y:101
+//line bql.y:169
 		{
 			yyVAL.exprs = yyDollar[3].exprs
 		}
-	case 14:
+	case 28:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line bql.y:105
+//line bql.y:173
 		{
 			yyVAL.orderBys = nil
 		}
-	case 15:
+	case 29:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line bql.y:106
+//line bql.y:174
 		{
 			yyVAL.orderBys = yyDollar[3].orderBys
 		}
-	case 16:
+	case 30:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line bql.y:111
+//line bql.y:179
 		{
 			yyVAL.orderBys = []OrderBy{yyDollar[1].orderBy}
 		}
-	case 17:
+	case 31:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line bql.y:115
+//line bql.y:183
 		{
 			yyVAL.orderBys = append(yyDollar[1].orderBys, yyDollar[3].orderBy)
 		}
-	case 18:
+	case 32:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line bql.y:122
+//line bql.y:190
 		{
 			yyVAL.orderBy = OrderBy{Expression: yyDollar[1].expr, Ascending: (yyDollar[2].str != "DESC")}
 		}
-	case 19:
+	case 33:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line bql.y:196
+		{
+			yyVAL.exprs = nil
+		}
+	case 34:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line bql.y:197
+		{
+			yyVAL.exprs = yyDollar[3].exprs
+		}
+	case 35:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line bql.y:128
+//line bql.y:201
 		{
 			yyVAL.str = "ASC"
 		}
-	case 20:
+	case 36:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line bql.y:129
+//line bql.y:202
 		{
 			yyVAL.str = "ASC"
 		}
-	case 21:
+	case 37:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line bql.y:130
+//line bql.y:203
 		{
 			yyVAL.str = "DESC"
 		}
@@ -0,0 +1,142 @@
+// Package host runs the WASI Preview 1 build of the BQL engine under
+// wazero and calls its exports with Go strings. It is used to test the
+// compiled module, and lets Go programs embed it without cgo.
+//
+// The module must be a reactor, built with -buildmode=c-shared:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o bql_parser.wasm .
+//	tinygo build -target wasip1 -buildmode=c-shared -o bql_parser.wasm .
+package host
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Module is an instance of the compiled engine. Calls are serialised, since
+// the module has a single linear memory and Go runtime.
+type Module struct {
+	mu      sync.Mutex
+	runtime wazero.Runtime
+	mod     api.Module
+
+	alloc, free, parse, execute, params, script, check api.Function
+}
+
+// Load compiles and instantiates the module in a new runtime.
+func Load(ctx context.Context, wasm []byte) (*Module, error) {
+	r := wazero.NewRuntime(ctx)
+	m, err := load(ctx, r, wasm)
+	if err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+	return m, nil
+}
+
+func load(ctx context.Context, r wazero.Runtime, wasm []byte) (*Module, error) {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		return nil, err
+	}
+	compiled, err := r.CompileModule(ctx, wasm)
+	if err != nil {
+		return nil, fmt.Errorf("compile module: %w", err)
+	}
+	mod, err := r.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, fmt.Errorf("instantiate module: %w", err)
+	}
+
+	m := &Module{runtime: r, mod: mod}
+	for name, fn := range map[string]*api.Function{
+		"bql_alloc":              &m.alloc,
+		"bql_free":               &m.free,
+		"parse_bql_to_json":      &m.parse,
+		"execute_bql":            &m.execute,
+		"execute_bql_params":     &m.params,
+		"execute_bql_script":     &m.script,
+		"check_beancount_syntax": &m.check,
+	} {
+		if *fn = mod.ExportedFunction(name); *fn == nil {
+			return nil, fmt.Errorf("module does not export %s", name)
+		}
+	}
+	return m, nil
+}
+
+// Close releases the module and its runtime.
+func (m *Module) Close(ctx context.Context) error {
+	return m.runtime.Close(ctx)
+}
+
+// ParseBQLToJSON calls the module's parse_bql_to_json export.
+func (m *Module) ParseBQLToJSON(ctx context.Context, query string) (string, error) {
+	return m.call(ctx, m.parse, query)
+}
+
+// ExecuteBQL calls the module's execute_bql export.
+func (m *Module) ExecuteBQL(ctx context.Context, query, ledgerText string) (string, error) {
+	return m.call(ctx, m.execute, query, ledgerText)
+}
+
+// ExecuteBQLParams calls the module's execute_bql_params export.
+func (m *Module) ExecuteBQLParams(ctx context.Context, query, ledgerText, paramsJSON string) (string, error) {
+	return m.call(ctx, m.params, query, ledgerText, paramsJSON)
+}
+
+// ExecuteScript calls the module's execute_bql_script export.
+func (m *Module) ExecuteScript(ctx context.Context, script, ledgerText string) (string, error) {
+	return m.call(ctx, m.script, script, ledgerText)
+}
+
+// CheckBeancountSyntax calls the module's check_beancount_syntax export.
+func (m *Module) CheckBeancountSyntax(ctx context.Context, ledgerText string) (string, error) {
+	return m.call(ctx, m.check, ledgerText)
+}
+
+// call writes args into buffers allocated by the module, calls fn with
+// their pointers and lengths, and reads back the packed string result.
+func (m *Module) call(ctx context.Context, fn api.Function, args ...string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	params := make([]uint64, 0, 2*len(args))
+	for _, arg := range args {
+		ptr, err := m.writeString(ctx, arg)
+		if err != nil {
+			return "", err
+		}
+		defer m.free.Call(ctx, uint64(ptr))
+		params = append(params, uint64(ptr), uint64(len(arg)))
+	}
+
+	results, err := fn.Call(ctx, params...)
+	if err != nil {
+		return "", fmt.Errorf("call %s: %w", fn.Definition().ExportNames()[0], err)
+	}
+	ptr, size := uint32(results[0]>>32), uint32(results[0])
+	defer m.free.Call(ctx, uint64(ptr))
+
+	data, ok := m.mod.Memory().Read(ptr, size)
+	if !ok {
+		return "", fmt.Errorf("result [%d, %d) is outside of memory", ptr, ptr+size)
+	}
+	return string(data), nil
+}
+
+func (m *Module) writeString(ctx context.Context, s string) (uint32, error) {
+	results, err := m.alloc.Call(ctx, uint64(len(s)))
+	if err != nil {
+		return 0, fmt.Errorf("bql_alloc: %w", err)
+	}
+	ptr := uint32(results[0])
+	if !m.mod.Memory().WriteString(ptr, s) {
+		return 0, fmt.Errorf("buffer [%d, %d) is outside of memory", ptr, ptr+uint32(len(s)))
+	}
+	return ptr, nil
+}
@@ -0,0 +1,285 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"bql-parser/engine"
+)
+
+// module is shared by the tests. It is built from the component source by
+// TestMain, or loaded from $BQL_WASM to test a prebuilt module.
+var (
+	module    *Module
+	moduleErr error
+)
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	dir, err := os.MkdirTemp("", "bql-host")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	module, moduleErr = buildModule(ctx, dir)
+	code := m.Run()
+	if module != nil {
+		module.Close(ctx)
+	}
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// buildModule builds the module as it ships, with TinyGo. Without TinyGo
+// on PATH it is built with the Go toolchain instead, which exports the
+// same functions, except in CI ($CI set), where the shipped build must be
+// the one tested.
+func buildModule(ctx context.Context, dir string) (*Module, error) {
+	path := os.Getenv("BQL_WASM")
+	if path == "" {
+		path = filepath.Join(dir, "bql_parser.wasm")
+		var cmd *exec.Cmd
+		if tinygo, err := exec.LookPath("tinygo"); err == nil {
+			cmd = exec.Command(tinygo, "build", "-target", "wasip1", "-buildmode=c-shared", "-o", path, ".")
+		} else if os.Getenv("CI") != "" {
+			return nil, errors.New("tinygo is not on PATH; CI must test the TinyGo build")
+		} else {
+			cmd = exec.Command("go", "build", "-buildmode=c-shared", "-o", path, ".")
+			cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+		}
+		cmd.Dir = ".."
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("build module: %v\n%s", err, out)
+		}
+	}
+	wasm, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Load(ctx, wasm)
+}
+
+// loadModule returns the shared module. A module that failed to build
+// fails every test, so that a broken build cannot pass unnoticed.
+func loadModule(t *testing.T) *Module {
+	t.Helper()
+	if moduleErr != nil {
+		t.Fatal(moduleErr)
+	}
+	return module
+}
+
+func readSample(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile("../engine/testdata/sample.beancount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// corpus is the query and ledger corpus shared with the engine tests,
+// valid and invalid.
+type corpus struct {
+	Queries []string `json:"queries"`
+	Ledgers []string `json:"ledgers"`
+}
+
+func readCorpus(t *testing.T) corpus {
+	t.Helper()
+	data, err := os.ReadFile("../engine/testdata/corpus.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c corpus
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestParseBQLToJSONMatchesEngine(t *testing.T) {
+	m := loadModule(t)
+	for _, q := range readCorpus(t).Queries {
+		got, err := m.ParseBQLToJSON(context.Background(), q)
+		if err != nil {
+			t.Fatalf("ParseBQLToJSON(%q): %v", q, err)
+		}
+		if want := engine.ParseBQLToJSON(q); got != want {
+			t.Errorf("ParseBQLToJSON(%q):\nmodule: %s\nengine: %s", q, got, want)
+		}
+	}
+}
+
+func TestExecuteBQLMatchesEngine(t *testing.T) {
+	m := loadModule(t)
+	corpus := readCorpus(t)
+	for _, ledger := range append([]string{readSample(t)}, corpus.Ledgers...) {
+		for _, q := range corpus.Queries {
+			got, err := m.ExecuteBQL(context.Background(), q, ledger)
+			if err != nil {
+				t.Fatalf("ExecuteBQL(%q): %v", q, err)
+			}
+			if want := engine.ExecuteBQL(q, ledger); got != want {
+				t.Errorf("ExecuteBQL(%q) on a %d-byte ledger:\nmodule: %s\nengine: %s", q, len(ledger), got, want)
+			}
+		}
+	}
+}
+
+func TestExecuteBQLParamsMatchesEngine(t *testing.T) {
+	m := loadModule(t)
+	sample := readSample(t)
+	for _, tt := range []struct{ query, params string }{
+		{"SELECT account, amount WHERE account = :account", `{"account": "Expenses:Food:Groceries"}`},
+		{"SELECT account WHERE amount > ? AND currency = ?", `[10, "USD"]`},
+		{"SELECT account WHERE account = :missing", `{}`},
+		{"SELECT account WHERE account = ?", `not json`},
+	} {
+		got, err := m.ExecuteBQLParams(context.Background(), tt.query, sample, tt.params)
+		if err != nil {
+			t.Fatalf("ExecuteBQLParams(%q): %v", tt.query, err)
+		}
+		if want := engine.ExecuteBQLParams(tt.query, sample, tt.params); got != want {
+			t.Errorf("ExecuteBQLParams(%q, %s):\nmodule: %s\nengine: %s", tt.query, tt.params, got, want)
+		}
+	}
+}
+
+func TestExecuteScriptMatchesEngine(t *testing.T) {
+	m := loadModule(t)
+	sample := readSample(t)
+	for _, script := range []string{
+		strings.Join(readCorpus(t).Queries[:4], "; "),
+		"SELECT account; INVALID QUERY; SELECT date",
+		"",
+	} {
+		got, err := m.ExecuteScript(context.Background(), script, sample)
+		if err != nil {
+			t.Fatalf("ExecuteScript(%q): %v", script, err)
+		}
+		if want := engine.ExecuteScript(script, sample); got != want {
+			t.Errorf("ExecuteScript(%q):\nmodule: %s\nengine: %s", script, got, want)
+		}
+	}
+}
+
+func TestCheckBeancountSyntaxMatchesEngine(t *testing.T) {
+	m := loadModule(t)
+	for _, ledger := range append([]string{readSample(t)}, readCorpus(t).Ledgers...) {
+		got, err := m.CheckBeancountSyntax(context.Background(), ledger)
+		if err != nil {
+			t.Fatalf("CheckBeancountSyntax: %v", err)
+		}
+		if want := engine.CheckBeancountSyntax(ledger); got != want {
+			t.Errorf("CheckBeancountSyntax(%q):\nmodule: %s\nengine: %s", ledger, got, want)
+		}
+	}
+}
+
+// TestLargeLedger crosses the boundary with inputs and outputs larger than
+// the module's initial memory.
+func TestLargeLedger(t *testing.T) {
+	m := loadModule(t)
+	sample := readSample(t)
+	ledger := strings.Repeat(sample, 50)
+	got, err := m.ExecuteBQL(context.Background(), "SELECT date, account, position, narration", ledger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := engine.ExecuteBQL("SELECT date, account, position, narration", ledger); got != want {
+		t.Errorf("outputs differ: module %d bytes, engine %d bytes", len(got), len(want))
+	}
+}
+
+func TestLoadRejectsOtherModules(t *testing.T) {
+	// A module with no exports: the 8-byte header of an empty module.
+	_, err := Load(context.Background(), []byte("\x00asm\x01\x00\x00\x00"))
+	if err == nil || !strings.Contains(err.Error(), "does not export") {
+		t.Errorf("expected a missing export error, got %v", err)
+	}
+}
+
+// notInCoreABI lists the functions of the bql interface of wit/world.wit
+// that the core ABI does not export, because they take a WIT record, enum
+// or list that its string arguments cannot carry. The component exports
+// them, and component_test.go covers them.
+var notInCoreABI = map[string]bool{
+	"execute-bql-formatted": true,
+	"execute-bql-files":     true,
+	"check-duplicates":      true,
+	"format-beancount":      true,
+}
+
+// TestExportsMatchWIT checks that the core ABI and the component export
+// the same functions: every function of the bql interface is exported by
+// abi_wasip1.go under its snake_case name, unless listed in notInCoreABI,
+// and the module exports everything abi_wasip1.go declares.
+func TestExportsMatchWIT(t *testing.T) {
+	wit, err := os.ReadFile("../wit/world.wit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	abi, err := os.ReadFile("../abi_wasip1.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Functions of the interface are indented once; resource methods twice.
+	body := string(wit)[strings.Index(string(wit), "interface bql {"):]
+	body = body[:strings.Index(body, "\n}")]
+	witFuncs := make(map[string]bool)
+	for _, match := range regexp.MustCompile(`(?m)^    ([a-z][a-z0-9-]*): func\(`).FindAllStringSubmatch(body, -1) {
+		witFuncs[match[1]] = true
+	}
+	if len(witFuncs) == 0 {
+		t.Fatal("no functions found in the bql interface")
+	}
+
+	declared := make(map[string]bool)
+	for _, match := range regexp.MustCompile(`(?m)^//go:wasmexport (\w+)$`).FindAllStringSubmatch(string(abi), -1) {
+		declared[match[1]] = true
+	}
+	for name := range witFuncs {
+		core := strings.ReplaceAll(name, "-", "_")
+		switch {
+		case declared[core] && notInCoreABI[name]:
+			t.Errorf("%s is exported by abi_wasip1.go but listed in notInCoreABI", name)
+		case !declared[core] && !notInCoreABI[name]:
+			t.Errorf("%s of wit/world.wit is not exported by abi_wasip1.go as %s", name, core)
+		}
+	}
+	for name := range notInCoreABI {
+		if !witFuncs[name] {
+			t.Errorf("%s is listed in notInCoreABI but not in wit/world.wit", name)
+		}
+	}
+
+	m := loadModule(t)
+	exported := make(map[string]bool)
+	for name := range m.mod.ExportedFunctionDefinitions() {
+		exported[name] = true
+	}
+	var names []string
+	for name := range declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !exported[name] {
+			t.Errorf("the module does not export %s", name)
+		}
+		if name != "bql_alloc" && name != "bql_free" && !witFuncs[strings.ReplaceAll(name, "_", "-")] {
+			t.Errorf("%s of abi_wasip1.go is not a function of wit/world.wit", name)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// ErrClosed is returned by calls pending when the stream ends.
+var ErrClosed = errors.New("jsonrpc: connection closed")
+
+// Client sends requests over a stream and matches responses to them by
+// ID. It is safe for concurrent use.
+type Client struct {
+	stream  Stream
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan *Response
+	closed  bool
+	notify  func(*Request)
+}
+
+// NewClient returns a client reading responses from stream in the
+// background until the stream ends.
+func NewClient(stream Stream) *Client {
+	c := &Client{stream: stream, pending: make(map[string]chan *Response)}
+	go c.readLoop()
+	return c
+}
+
+// Call sends a request and waits for its response. If result is not nil,
+// the response result is unmarshalled into it. A JSON-RPC error is
+// returned as an *Error.
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.nextID++
+	id := strconv.FormatInt(c.nextID, 10)
+	ch := make(chan *Response, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := writeRequest(c.stream, json.RawMessage(id), method, params); err != nil {
+		c.forget(id)
+		return err
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return ErrClosed
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	case <-ctx.Done():
+		c.forget(id)
+		return ctx.Err()
+	}
+}
+
+// Notify sends a notification, which has no response.
+func (c *Client) Notify(method string, params interface{}) error {
+	return writeRequest(c.stream, nil, method, params)
+}
+
+// OnNotification sets the function called with each notification the
+// server sends. It is called from the goroutine reading the stream, so it
+// must not block on calls of the client. Notifications are dropped while
+// no function is set.
+func (c *Client) OnNotification(h func(*Request)) {
+	c.mu.Lock()
+	c.notify = h
+	c.mu.Unlock()
+}
+
+func (c *Client) forget(id string) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *Client) readLoop() {
+	for {
+		msg, err := c.stream.ReadMessage()
+		if err != nil {
+			break
+		}
+		var resp struct {
+			Response
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if json.Unmarshal(msg, &resp) != nil {
+			continue
+		}
+		if resp.Method != "" {
+			c.mu.Lock()
+			notify := c.notify
+			c.mu.Unlock()
+			if notify != nil {
+				notify(&Request{JSONRPC: resp.JSONRPC, ID: resp.ID, Method: resp.Method, Params: resp.Params})
+			}
+			continue
+		}
+		c.mu.Lock()
+		ch := c.pending[string(resp.ID)]
+		delete(c.pending, string(resp.ID))
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- &resp.Response
+		}
+	}
+
+	c.mu.Lock()
+	c.closed = true
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+}
@@ -0,0 +1,155 @@
+// Package jsonrpc implements JSON-RPC 2.0 servers and clients over a
+// message stream. It is the transport of the MCP and language servers.
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Version is the value of the "jsonrpc" member of every message.
+const Version = "2.0"
+
+// Standard JSON-RPC error codes.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Request is a request or, when ID is empty, a notification.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// IsNotification reports whether the request expects no response.
+func (r *Request) IsNotification() bool {
+	return len(r.ID) == 0
+}
+
+// Response is the reply to a request. Exactly one of Result and Error is
+// set.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error object. Handlers return it to control the
+// code sent to the client.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError returns an error with the given code and message.
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Handler handles one request. The result is marshalled as the response
+// result; it is discarded for notifications. An error that is not an
+// *Error is reported as an internal error.
+type Handler func(ctx context.Context, req *Request) (interface{}, error)
+
+// Serve reads requests from stream and writes responses until the stream
+// ends or ctx is cancelled. Requests are handled one at a time, in order.
+// It returns nil when the stream ends cleanly.
+func Serve(ctx context.Context, stream Stream, h Handler) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		msg, err := stream.ReadMessage()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		resp := handle(ctx, msg, h)
+		if resp == nil {
+			continue
+		}
+		out, err := json.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		if err := stream.WriteMessage(out); err != nil {
+			return err
+		}
+	}
+}
+
+// handle decodes and dispatches one message. It returns nil for
+// notifications.
+func handle(ctx context.Context, msg []byte, h Handler) *Response {
+	var req Request
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return errorResponse(json.RawMessage("null"), NewError(CodeParseError, "parse error: "+err.Error()))
+	}
+	if req.JSONRPC != Version || req.Method == "" {
+		id := req.ID
+		if len(id) == 0 {
+			id = json.RawMessage("null")
+		}
+		return errorResponse(id, NewError(CodeInvalidRequest, "invalid request"))
+	}
+
+	result, err := h(ctx, &req)
+	if req.IsNotification() {
+		return nil
+	}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = NewError(CodeInternalError, err.Error())
+		}
+		return errorResponse(req.ID, rpcErr)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, NewError(CodeInternalError, err.Error()))
+	}
+	return &Response{JSONRPC: Version, ID: req.ID, Result: data}
+}
+
+// Notify writes a notification to stream. Handlers use it to send
+// notifications to the client while serving a request.
+func Notify(stream Stream, method string, params interface{}) error {
+	return writeRequest(stream, nil, method, params)
+}
+
+// writeRequest writes a request, or a notification when id is nil.
+func writeRequest(stream Stream, id json.RawMessage, method string, params interface{}) error {
+	req := Request{JSONRPC: Version, ID: id, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = data
+	}
+	msg, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return stream.WriteMessage(msg)
+}
+
+func errorResponse(id json.RawMessage, err *Error) *Response {
+	return &Response{JSONRPC: Version, ID: id, Error: err}
+}
@@ -0,0 +1,186 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// connect runs Serve on one end of a pipe and returns a client for the
+// other end.
+func connect(t *testing.T, h Handler) *Client {
+	t.Helper()
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(context.Background(), NewLineStream(serverIn, serverOut), h)
+		serverOut.Close()
+	}()
+	t.Cleanup(func() {
+		clientOut.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return NewClient(NewLineStream(clientIn, clientOut))
+}
+
+func echoHandler(notified chan<- string) Handler {
+	return func(ctx context.Context, req *Request) (interface{}, error) {
+		switch req.Method {
+		case "echo":
+			var params map[string]string
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				return nil, NewError(CodeInvalidParams, err.Error())
+			}
+			return params, nil
+		case "fail":
+			return nil, errors.New("boom")
+		case "notify":
+			notified <- string(req.Params)
+			return nil, nil
+		}
+		return nil, NewError(CodeMethodNotFound, "method not found: "+req.Method)
+	}
+}
+
+func TestClientCall(t *testing.T) {
+	c := connect(t, echoHandler(nil))
+	var got map[string]string
+	if err := c.Call(context.Background(), "echo", map[string]string{"a": "b"}, &got); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if got["a"] != "b" {
+		t.Errorf("unexpected result: %v", got)
+	}
+}
+
+func TestClientCallErrors(t *testing.T) {
+	c := connect(t, echoHandler(nil))
+
+	var rpcErr *Error
+	err := c.Call(context.Background(), "missing", nil, nil)
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeMethodNotFound {
+		t.Errorf("expected method not found, got %v", err)
+	}
+
+	err = c.Call(context.Background(), "fail", nil, nil)
+	if !errors.As(err, &rpcErr) || rpcErr.Code != CodeInternalError || rpcErr.Message != "boom" {
+		t.Errorf("expected an internal error, got %v", err)
+	}
+}
+
+func TestNotificationHasNoResponse(t *testing.T) {
+	notified := make(chan string, 1)
+	c := connect(t, echoHandler(notified))
+	if err := c.Notify("notify", []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-notified; got != "[1]" {
+		t.Errorf("unexpected params: %s", got)
+	}
+	// The next response must belong to the next call.
+	var got map[string]string
+	if err := c.Call(context.Background(), "echo", map[string]string{"x": "y"}, &got); err != nil || got["x"] != "y" {
+		t.Errorf("unexpected call result %v, %v", got, err)
+	}
+}
+
+func TestServeMalformedMessages(t *testing.T) {
+	in := strings.NewReader("not json\n\n{\"jsonrpc\":\"1.0\",\"id\":7,\"method\":\"echo\"}\n")
+	var out bytes.Buffer
+	if err := Serve(context.Background(), NewLineStream(in, &out), echoHandler(nil)); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 responses, got %q", out.String())
+	}
+	want := []string{
+		`"id":null,"error":{"code":-32700`,
+		`"id":7,"error":{"code":-32600`,
+	}
+	for i, w := range want {
+		if !strings.Contains(lines[i], w) {
+			t.Errorf("response %d = %s, want it to contain %s", i, lines[i], w)
+		}
+	}
+}
+
+func TestClientClosed(t *testing.T) {
+	clientIn, serverOut := io.Pipe()
+	c := NewClient(NewLineStream(clientIn, io.Discard))
+	serverOut.Close()
+	if err := c.Call(context.Background(), "echo", nil, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestHeaderStream(t *testing.T) {
+	in := strings.NewReader("Content-Length: 7\r\nContent-Type: application/vscode-jsonrpc\r\n\r\n{\"a\":1}content-length: 2\r\n\r\n[]")
+	var out bytes.Buffer
+	s := NewHeaderStream(in, &out)
+	for _, want := range []string{`{"a":1}`, `[]`} {
+		msg, err := s.ReadMessage()
+		if err != nil || string(msg) != want {
+			t.Fatalf("ReadMessage = %q, %v; want %q", msg, err, want)
+		}
+	}
+	if _, err := s.ReadMessage(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	if err := s.WriteMessage([]byte(`{"b":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "Content-Length: 7\r\n\r\n{\"b\":2}" {
+		t.Errorf("unexpected framing %q", got)
+	}
+
+	for _, bad := range []string{"\r\n{}", "Content-Length: x\r\n\r\n", "Content-Length: 9\r\n\r\n{}"} {
+		if _, err := NewHeaderStream(strings.NewReader(bad), io.Discard).ReadMessage(); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("%q: expected a framing error, got %v", bad, err)
+		}
+	}
+}
+
+func TestServerNotification(t *testing.T) {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	stream := NewHeaderStream(serverIn, serverOut)
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(context.Background(), stream, func(ctx context.Context, req *Request) (interface{}, error) {
+			return "ok", Notify(stream, "progress", map[string]int{"done": 1})
+		})
+		serverOut.Close()
+	}()
+	defer func() {
+		clientOut.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	}()
+
+	c := NewClient(NewHeaderStream(clientIn, clientOut))
+	notified := make(chan *Request, 1)
+	c.OnNotification(func(req *Request) { notified <- req })
+	var got string
+	if err := c.Call(context.Background(), "work", nil, &got); err != nil || got != "ok" {
+		t.Fatalf("unexpected call result %q, %v", got, err)
+	}
+	// The notification was written before the response.
+	select {
+	case req := <-notified:
+		if req.Method != "progress" || string(req.Params) != `{"done":1}` || !req.IsNotification() {
+			t.Errorf("unexpected notification %+v", req)
+		}
+	default:
+		t.Error("expected a notification before the response")
+	}
+}
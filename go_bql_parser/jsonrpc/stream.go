@@ -0,0 +1,110 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Stream reads and writes whole JSON-RPC messages.
+type Stream interface {
+	ReadMessage() ([]byte, error)
+	WriteMessage(msg []byte) error
+}
+
+// lineStream frames messages as single lines of JSON, as in the MCP stdio
+// transport.
+type lineStream struct {
+	in  *bufio.Reader
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewLineStream returns a stream of newline-delimited messages. Blank
+// lines are skipped.
+func NewLineStream(r io.Reader, w io.Writer) Stream {
+	return &lineStream{in: bufio.NewReader(r), out: w}
+}
+
+func (s *lineStream) ReadMessage() ([]byte, error) {
+	for {
+		line, err := s.in.ReadBytes('\n')
+		if msg := bytes.TrimSpace(line); len(msg) > 0 {
+			return msg, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *lineStream) WriteMessage(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.out.Write(append(msg, '\n'))
+	return err
+}
+
+// headerStream frames messages with a Content-Length header, as in the
+// Language Server Protocol base protocol.
+type headerStream struct {
+	in  *bufio.Reader
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewHeaderStream returns a stream of messages each preceded by a
+// "Content-Length: N" header and a blank line. Other headers are ignored.
+func NewHeaderStream(r io.Reader, w io.Writer) Stream {
+	return &headerStream{in: bufio.NewReader(r), out: w}
+}
+
+func (s *headerStream) ReadMessage() ([]byte, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && (line != "" || length >= 0) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if length < 0 {
+				return nil, fmt.Errorf("jsonrpc: message without Content-Length header")
+			}
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("jsonrpc: malformed header %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("jsonrpc: invalid Content-Length %q", value)
+			}
+			length = n
+		}
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(s.in, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *headerStream) WriteMessage(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	return err
+}
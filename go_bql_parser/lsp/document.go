@@ -0,0 +1,118 @@
+package lsp
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"bql-parser/engine"
+)
+
+// document is an open text document and the ledger loaded from it.
+type document struct {
+	uri     string
+	name    string
+	version int
+	text    string
+	lines   lineIndex
+
+	ledger *engine.LedgerSession
+	// file is the syntax tree of the document within ledger.
+	file  *engine.LedgerFile
+	index *ledgerIndex
+}
+
+// lineIndex holds the lines of a text, without their line endings, to
+// convert between ledger spans and LSP positions.
+type lineIndex []string
+
+func newLineIndex(text string) lineIndex {
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+// line returns the 0-based line n, or "" past the end of the text.
+func (li lineIndex) line(n int) string {
+	if n < 0 || n >= len(li) {
+		return ""
+	}
+	return li[n]
+}
+
+// position converts a 1-based line and character column to a position.
+func (li lineIndex) position(line, column int) Position {
+	units, n := 0, 0
+	for _, r := range li.line(line - 1) {
+		if n++; n >= column {
+			break
+		}
+		units += utf16.RuneLen(r)
+	}
+	return Position{Line: line - 1, Character: units}
+}
+
+// rangeOf converts a ledger span to a range.
+func (li lineIndex) rangeOf(s engine.Span) Range {
+	return Range{Start: li.position(s.Line, s.Column), End: li.position(s.EndLine, s.EndColumn)}
+}
+
+// offset returns the byte offset of p in its line, clamped to the line.
+func (li lineIndex) offset(p Position) int {
+	text := li.line(p.Line)
+	units := 0
+	for i, r := range text {
+		if units >= p.Character {
+			return i
+		}
+		units += utf16.RuneLen(r)
+	}
+	return len(text)
+}
+
+// uriToName returns the ledger file name of a document: the slash-separated
+// path of a file URI, or the URI itself for other schemes.
+func uriToName(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	p := u.Path
+	// file:///C:/ledger on Windows.
+	if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return path.Clean(p)
+}
+
+// nameToURI is the inverse of uriToName for files loaded from disk.
+func nameToURI(name string) string {
+	if strings.Contains(name, ":") && !filepath.IsAbs(filepath.FromSlash(name)) {
+		return name
+	}
+	p := name
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// overlay reads open documents from memory and other files from disk, so
+// that a ledger is loaded with the unsaved text of its open files.
+type overlay struct {
+	docs map[string]*document
+	engine.DiskSource
+}
+
+func (o overlay) ReadFile(name string) ([]byte, error) {
+	for _, d := range o.docs {
+		if d.name == name {
+			return []byte(d.text), nil
+		}
+	}
+	return o.DiskSource.ReadFile(name)
+}
@@ -0,0 +1,296 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"bql-parser/engine"
+)
+
+// ledgerIndex holds the names used by a ledger, for completion, and where
+// its accounts are opened, for hover and go-to-definition.
+type ledgerIndex struct {
+	accounts   []string
+	payees     []string
+	currencies []string
+	opens      map[string]opening
+}
+
+// opening is the open directive of an account.
+type opening struct {
+	file string
+	date string
+	span engine.Span
+}
+
+func newLedgerIndex(files []engine.SourceFile) *ledgerIndex {
+	ix := &ledgerIndex{opens: make(map[string]opening)}
+	accounts := make(map[string]bool)
+	payees := make(map[string]bool)
+	currencies := make(map[string]bool)
+	for _, f := range files {
+		for _, d := range f.Parsed.Directives {
+			for _, t := range d.Args {
+				switch t.Kind {
+				case engine.TokenAccount:
+					accounts[t.Text] = true
+					if _, ok := ix.opens[t.Text]; d.Kind == "open" && !ok {
+						ix.opens[t.Text] = opening{file: f.Name, date: d.Date, span: t.Span}
+					}
+				case engine.TokenCurrency:
+					currencies[t.Text] = true
+				}
+			}
+			if d.Payee != "" {
+				payees[d.Payee] = true
+			}
+			for _, pn := range d.Postings {
+				accounts[pn.Account] = true
+				for _, a := range []*engine.AmountNode{pn.Amount, pn.Price} {
+					if a != nil {
+						currencies[a.Currency] = true
+					}
+				}
+			}
+		}
+	}
+	ix.accounts = sortedNames(accounts)
+	ix.payees = sortedNames(payees)
+	ix.currencies = sortedNames(currencies)
+	return ix
+}
+
+func sortedNames(m map[string]bool) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// complete proposes the names that fit at pos: payees inside the first
+// string of a transaction header, accounts where a directive or posting
+// takes one, and currencies after a number or where an open, commodity or
+// price directive takes one.
+func (d *document) complete(pos Position) []CompletionItem {
+	line := d.lines.line(pos.Line)
+	prefix := line[:d.lines.offset(pos)]
+
+	if quotes := strings.Count(prefix, `"`); quotes%2 == 1 {
+		fields := strings.Fields(prefix)
+		if quotes != 1 || len(fields) < 3 || !looksLikeDate(fields[0]) {
+			return []CompletionItem{}
+		}
+		start := strings.LastIndex(prefix, `"`) + 1
+		return d.items(d.index.payees, completionText, "payee", pos, prefix[:start])
+	}
+
+	start := len(prefix)
+	for start > 0 && isNameByte(prefix[start-1]) {
+		start--
+	}
+	indented := strings.HasPrefix(prefix, " ") || strings.HasPrefix(prefix, "\t")
+	fields := strings.Fields(prefix[:start])
+	switch {
+	case strings.Contains(prefix[start:], ":") || takesAccount(indented, fields):
+		return d.items(d.index.accounts, completionVariable, "account", pos, prefix[:start])
+	case takesCurrency(indented, fields):
+		return d.items(d.index.currencies, completionUnit, "currency", pos, prefix[:start])
+	}
+	return []CompletionItem{}
+}
+
+// items returns completion items replacing the text between the end of
+// before and pos with each name.
+func (d *document) items(names []string, kind int, detail string, pos Position, before string) []CompletionItem {
+	r := Range{Start: Position{Line: pos.Line, Character: utf16Len(before)}, End: pos}
+	items := make([]CompletionItem, len(names))
+	for i, name := range names {
+		items[i] = CompletionItem{Label: name, Kind: kind, Detail: detail, TextEdit: &TextEdit{Range: r, NewText: name}}
+	}
+	return items
+}
+
+// takesAccount reports whether an account comes after the words fields of
+// a line: first on a posting line, after an optional flag, or after the
+// keyword of a directive on accounts.
+func takesAccount(indented bool, fields []string) bool {
+	if indented {
+		return len(fields) == 0 || len(fields) == 1 && len(fields[0]) == 1 && strings.Contains("*!&?%PSTCURM", fields[0])
+	}
+	if len(fields) < 2 || !looksLikeDate(fields[0]) {
+		return false
+	}
+	switch fields[1] {
+	case "open", "close", "balance", "note", "document":
+		return len(fields) == 2
+	case "pad":
+		return len(fields) == 2 || len(fields) == 3
+	}
+	return false
+}
+
+// takesCurrency reports whether a currency comes after the words fields of
+// a line: after a number, after the account of an open directive, or as
+// the commodity of a commodity or price directive.
+func takesCurrency(indented bool, fields []string) bool {
+	if len(fields) == 0 {
+		return false
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(fields[len(fields)-1], ",", ""), 64); err == nil {
+		return true
+	}
+	if indented || len(fields) < 2 || !looksLikeDate(fields[0]) {
+		return false
+	}
+	switch fields[1] {
+	case "open":
+		return len(fields) >= 3
+	case "commodity", "price":
+		return len(fields) == 2
+	}
+	return false
+}
+
+// hover describes the account at pos: when it is opened and its balance
+// in each currency.
+func (d *document) hover(pos Position) *Hover {
+	account, r, ok := d.accountAt(pos)
+	if !ok {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**\n", account)
+	if o, ok := d.index.opens[account]; ok {
+		fmt.Fprintf(&b, "\nOpened %s.\n", o.date)
+	}
+	result, errInfo := d.ledger.QueryParams(balanceQuery, engine.Params{"account": account})
+	if errInfo == nil {
+		// Postings left for the ledger to balance have no currency.
+		rows := result.Rows[:0]
+		for _, row := range result.Rows {
+			if row[0] != "" {
+				rows = append(rows, row)
+			}
+		}
+		result.Rows = rows
+	}
+	switch {
+	case errInfo != nil:
+		fmt.Fprintf(&b, "\nBalance unavailable: %s\n", errInfo.Message)
+	case len(result.Rows) == 0:
+		b.WriteString("\nNo postings with amounts.\n")
+	default:
+		table, err := engine.Render(result, engine.FormatMarkdown)
+		if err != nil {
+			return nil
+		}
+		b.WriteString("\n" + table)
+	}
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: b.String()}, Range: &r}
+}
+
+// balanceQuery sums the amounts posted to an account by currency.
+const balanceQuery = `SELECT currency, SUM(amount) WHERE account = :account GROUP BY currency ORDER BY currency`
+
+// definition returns the location of the open directive of the account at
+// pos, or nil when there is none.
+func (d *document) definition(pos Position) *Location {
+	account, _, ok := d.accountAt(pos)
+	if !ok {
+		return nil
+	}
+	o, ok := d.index.opens[account]
+	if !ok {
+		return nil
+	}
+	loc := d.location(o.file, o.span)
+	return &loc
+}
+
+// accountAt returns the account name at pos and its range.
+func (d *document) accountAt(pos Position) (string, Range, bool) {
+	line := d.lines.line(pos.Line)
+	off := d.lines.offset(pos)
+	start, end := off, off
+	for start > 0 && isNameByte(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isNameByte(line[end]) {
+		end++
+	}
+	word := line[start:end]
+	if !strings.Contains(word, ":") || strings.HasSuffix(word, ":") || !unicode.IsUpper([]rune(word)[0]) {
+		return "", Range{}, false
+	}
+	r := Range{
+		Start: Position{Line: pos.Line, Character: utf16Len(line[:start])},
+		End:   Position{Line: pos.Line, Character: utf16Len(line[:end])},
+	}
+	return word, r, true
+}
+
+// symbols returns one symbol per transaction of the document, with its
+// postings as children.
+func (d *document) symbols() []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, dir := range d.file.Directives {
+		if dir.Kind != "transaction" {
+			continue
+		}
+		name := dir.Date + " " + dir.Narration
+		if dir.Payee != "" {
+			name = dir.Date + " " + dir.Payee + ": " + dir.Narration
+		}
+		date := engine.Span{Line: dir.Span.Line, Column: dir.Span.Column, EndLine: dir.Span.Line, EndColumn: dir.Span.Column + len(dir.Date)}
+		sym := DocumentSymbol{
+			Name:           name,
+			Detail:         dir.Flag,
+			Kind:           symbolEvent,
+			Range:          d.lines.rangeOf(dir.Span),
+			SelectionRange: d.lines.rangeOf(date),
+		}
+		for _, pn := range dir.Postings {
+			child := DocumentSymbol{
+				Name:           pn.Account,
+				Kind:           symbolField,
+				Range:          d.lines.rangeOf(pn.Span),
+				SelectionRange: d.lines.rangeOf(pn.AccountSpan),
+			}
+			if pn.Amount != nil {
+				child.Detail = pn.Amount.Number + " " + pn.Amount.Currency
+			}
+			sym.Children = append(sym.Children, child)
+		}
+		symbols = append(symbols, sym)
+	}
+	return symbols
+}
+
+// isNameByte reports whether b can be part of an account or currency
+// name. Bytes of multi-byte characters count, so that accounts with
+// non-ASCII letters are found whole.
+func isNameByte(b byte) bool {
+	return b >= 0x80 || b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || strings.IndexByte(":-_.'", b) >= 0
+}
+
+func looksLikeDate(s string) bool {
+	if len(s) != 10 || s[4] != s[7] || s[4] != '-' && s[4] != '/' {
+		return false
+	}
+	_, err := strconv.Atoi(s[:4] + s[5:7] + s[8:])
+	return err == nil
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
@@ -0,0 +1,293 @@
+// Package lsp serves Beancount ledgers over the Language Server Protocol:
+// diagnostics from the ledger checker, completion of accounts, payees and
+// currencies, hover with account balances, go-to-definition of accounts
+// and an outline of transactions. Messages are JSON-RPC with
+// Content-Length headers, as in the LSP stdio transport.
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"bql-parser/engine"
+	"bql-parser/jsonrpc"
+)
+
+// Server name and version reported to clients.
+const (
+	ServerName    = "wazbean-beancount"
+	ServerVersion = "0.2.0"
+)
+
+// diagnosticSource names the server in the diagnostics it publishes.
+const diagnosticSource = "beancount"
+
+// Server is a language server for Beancount files. Each open document is
+// loaded as a ledger together with the files it includes, which are read
+// from disk unless they are open too.
+type Server struct {
+	stream      jsonrpc.Stream
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+	exited      bool
+	stop        context.CancelFunc
+}
+
+// NewServer returns a server with no open documents.
+func NewServer() *Server {
+	return &Server{docs: make(map[string]*document)}
+}
+
+// errExitBeforeShutdown is returned by Serve when the client sends exit
+// without asking the server to shut down first.
+var errExitBeforeShutdown = errors.New("lsp: exit before shutdown")
+
+// Serve answers requests read from r on w until r ends, the client sends
+// exit, or ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.stream = jsonrpc.NewHeaderStream(r, w)
+	s.stop = cancel
+	err := jsonrpc.Serve(ctx, s.stream, s.Handle)
+	if s.exited {
+		if !s.shutdown {
+			return errExitBeforeShutdown
+		}
+		return nil
+	}
+	return err
+}
+
+// Handle dispatches one LSP request or notification.
+func (s *Server) Handle(ctx context.Context, req *jsonrpc.Request) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		s.initialized = true
+		return s.initialize(), nil
+	case "exit":
+		s.exited = true
+		if s.stop != nil {
+			s.stop()
+		}
+		return nil, nil
+	}
+	if !s.initialized {
+		return nil, jsonrpc.NewError(codeServerNotInitialized, "server not initialized")
+	}
+
+	switch req.Method {
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		s.update(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.update(p.TextDocument.URI, p.TextDocument.Version, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		s.publish(PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		return nil, nil
+	case "textDocument/completion":
+		d, pos, err := s.position(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		return d.complete(pos), nil
+	case "textDocument/hover":
+		d, pos, err := s.position(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		return d.hover(pos), nil
+	case "textDocument/definition":
+		d, pos, err := s.position(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		return d.definition(pos), nil
+	case "textDocument/documentSymbol":
+		var p documentSymbolParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		d, err := s.document(p.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return d.symbols(), nil
+	}
+	if req.IsNotification() {
+		// $/cancelRequest, $/setTrace and other optional notifications.
+		return nil, nil
+	}
+	return nil, jsonrpc.NewError(jsonrpc.CodeMethodNotFound, "method not found: "+req.Method)
+}
+
+func (s *Server) initialize() initializeResult {
+	return initializeResult{
+		Capabilities: map[string]interface{}{
+			"textDocumentSync": map[string]interface{}{
+				"openClose": true,
+				"change":    textDocumentSyncFull,
+			},
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{":", "\""},
+			},
+			"hoverProvider":          true,
+			"definitionProvider":     true,
+			"documentSymbolProvider": true,
+		},
+		ServerInfo: serverInfo{Name: ServerName, Version: ServerVersion},
+	}
+}
+
+// update stores the new text of a document, reloads its ledger and
+// publishes its diagnostics.
+func (s *Server) update(uri string, version int, text string) {
+	d := &document{uri: uri, name: uriToName(uri), version: version, text: text, lines: newLineIndex(text)}
+	s.docs[uri] = d
+	d.load(overlay{docs: s.docs})
+	s.publish(PublishDiagnosticsParams{URI: uri, Version: &d.version, Diagnostics: d.diagnostics()})
+}
+
+// publish sends diagnostics to the client. A failed write ends Serve on
+// the next read, so its error is not reported here.
+func (s *Server) publish(p PublishDiagnosticsParams) {
+	if s.stream != nil {
+		jsonrpc.Notify(s.stream, "textDocument/publishDiagnostics", p)
+	}
+}
+
+// document returns the open document uri.
+func (s *Server) document(uri string) (*document, error) {
+	d, ok := s.docs[uri]
+	if !ok {
+		return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "document not open: "+uri)
+	}
+	return d, nil
+}
+
+// position decodes the params of a request about a position in a document.
+func (s *Server) position(params json.RawMessage) (*document, Position, error) {
+	var p textDocumentPositionParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, Position{}, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	return d, p.Position, err
+}
+
+// load loads the ledger of the document from src and indexes the names
+// it uses.
+func (d *document) load(src engine.FileSource) {
+	d.ledger = engine.LoadLedgerSession(src, d.name)
+	files := d.ledger.Files()
+	for _, f := range files {
+		if f.Name == d.name {
+			d.file = f.Parsed
+		}
+	}
+	if d.file == nil {
+		d.file = engine.ParseBeancount(d.name, d.text)
+		files = append(files, engine.SourceFile{Name: d.name, Text: d.text, Parsed: d.file})
+	}
+	d.index = newLedgerIndex(files)
+}
+
+// diagnostics returns the diagnostics of the document: those the ledger
+// checker reports in it, and the error that stopped its ledger loading,
+// such as an include that cannot be read.
+func (d *document) diagnostics() []Diagnostic {
+	diags := []Diagnostic{}
+	for _, e := range d.ledger.Check().Errors {
+		if e.File != d.name {
+			continue
+		}
+		diag := Diagnostic{
+			Range:    d.lines.rangeOf(e.Span),
+			Severity: severity(e.Severity),
+			Code:     e.Code,
+			Source:   diagnosticSource,
+			Message:  e.Message,
+		}
+		for _, r := range e.Related {
+			diag.RelatedInformation = append(diag.RelatedInformation, DiagnosticRelatedInformation{
+				Location: d.location(r.File, r.Span),
+				Message:  r.Message,
+			})
+		}
+		diags = append(diags, diag)
+	}
+
+	var coded *engine.CodedError
+	if err := d.ledger.LoadError(); errors.As(err, &coded) && coded.File == d.name && coded.Line > 0 {
+		end := utf8.RuneCountInString(d.lines.line(coded.Line-1)) + 1
+		diags = append(diags, Diagnostic{
+			Range:    d.lines.rangeOf(engine.Span{Line: coded.Line, Column: 1, EndLine: coded.Line, EndColumn: end}),
+			Severity: severityError,
+			Code:     coded.Code,
+			Source:   diagnosticSource,
+			Message:  coded.Message,
+		})
+	} else if err != nil {
+		diags = append(diags, Diagnostic{
+			Severity: severityError,
+			Source:   diagnosticSource,
+			Message:  fmt.Sprintf("cannot load ledger: %v", err),
+		})
+	}
+	return diags
+}
+
+// location returns the location of a span in one of the files of the
+// document's ledger.
+func (d *document) location(name string, span engine.Span) Location {
+	if name == d.name {
+		return Location{URI: d.uri, Range: d.lines.rangeOf(span)}
+	}
+	for _, f := range d.ledger.Files() {
+		if f.Name == name {
+			return Location{URI: nameToURI(name), Range: newLineIndex(f.Text).rangeOf(span)}
+		}
+	}
+	return Location{URI: nameToURI(name)}
+}
+
+func severity(s engine.Severity) int {
+	switch s {
+	case engine.SeverityWarning:
+		return severityWarning
+	case engine.SeverityInfo:
+		return severityInformation
+	}
+	return severityError
+}
+
+func invalidParams(err error) error {
+	return jsonrpc.NewError(jsonrpc.CodeInvalidParams, "invalid params: "+strings.TrimPrefix(err.Error(), "json: "))
+}
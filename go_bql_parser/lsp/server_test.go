@@ -0,0 +1,304 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"bql-parser/engine"
+	"bql-parser/jsonrpc"
+)
+
+const testLedger = `2024-01-01 open Assets:Checking USD
+2024-01-01 open Expenses:Food USD
+
+2024-01-05 * "Grocer" "Groceries"
+  Expenses:Food     45.20 USD
+  Assets:Checking
+
+2024-01-09 * "Café" "Lunch"
+  Expenses:Food     12.00 USD
+  Assets:Checking  -12.00 USD
+`
+
+const testURI = "file:///ledgers/main.beancount"
+
+// client is a scripted LSP client talking to a server over pipes, as an
+// editor does over stdio.
+type client struct {
+	*jsonrpc.Client
+	diagnostics chan PublishDiagnosticsParams
+}
+
+// start runs a server on one end of a pipe and returns an initialized
+// client for the other end. The server must have exited when the test
+// ends.
+func start(t *testing.T) *client {
+	t.Helper()
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer().Serve(context.Background(), serverIn, serverOut)
+		serverOut.Close()
+	}()
+	t.Cleanup(func() {
+		clientOut.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+
+	c := &client{
+		Client:      jsonrpc.NewClient(jsonrpc.NewHeaderStream(clientIn, clientOut)),
+		diagnostics: make(chan PublishDiagnosticsParams, 8),
+	}
+	c.OnNotification(func(req *jsonrpc.Request) {
+		var p PublishDiagnosticsParams
+		if req.Method == "textDocument/publishDiagnostics" && json.Unmarshal(req.Params, &p) == nil {
+			c.diagnostics <- p
+		}
+	})
+
+	var init initializeResult
+	if err := c.Call(context.Background(), "initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &init); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	if init.ServerInfo.Name != ServerName || init.Capabilities["hoverProvider"] != true {
+		t.Errorf("unexpected initialize result: %+v", init)
+	}
+	if err := c.Notify("initialized", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (c *client) open(t *testing.T, uri, text string) PublishDiagnosticsParams {
+	t.Helper()
+	err := c.Notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "beancount", "version": 1, "text": text},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.published(t)
+}
+
+// published waits for the next diagnostics the server publishes.
+func (c *client) published(t *testing.T) PublishDiagnosticsParams {
+	t.Helper()
+	select {
+	case p := <-c.diagnostics:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("no diagnostics published")
+		return PublishDiagnosticsParams{}
+	}
+}
+
+func (c *client) at(t *testing.T, method string, line, character int, result interface{}) {
+	t.Helper()
+	err := c.Call(context.Background(), method, map[string]interface{}{
+		"textDocument": map[string]string{"uri": testURI},
+		"position":     Position{Line: line, Character: character},
+	}, result)
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := start(t)
+	broken := strings.Replace(testLedger, "  Expenses:Food     12.00 USD\n", "  Expenses:Food     12.00 USD {\n", 1)
+	p := c.open(t, testURI, broken)
+	if p.URI != testURI || p.Version == nil || *p.Version != 1 || len(p.Diagnostics) != 1 {
+		t.Fatalf("unexpected diagnostics %+v", p)
+	}
+	d := p.Diagnostics[0]
+	want := Range{Start: Position{Line: 8, Character: 30}, End: Position{Line: 8, Character: 31}}
+	if d.Range != want || d.Severity != severityError || d.Code != engine.CodeInvalidPosting || d.Source != diagnosticSource {
+		t.Errorf("unexpected diagnostic %+v", d)
+	}
+
+	err := c.Notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": testURI, "version": 2},
+		"contentChanges": []map[string]string{{"text": testLedger + "2024-01-10 open Expenses:Food\n"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = c.published(t)
+	if *p.Version != 2 || len(p.Diagnostics) != 1 {
+		t.Fatalf("unexpected diagnostics %+v", p)
+	}
+	d = p.Diagnostics[0]
+	if d.Code != engine.CodeDuplicateOpen || len(d.RelatedInformation) != 1 {
+		t.Fatalf("unexpected diagnostic %+v", d)
+	}
+	first := d.RelatedInformation[0].Location
+	if first.URI != testURI || first.Range.Start != (Position{Line: 1, Character: 16}) {
+		t.Errorf("unexpected related location %+v", first)
+	}
+
+	if err := c.Notify("textDocument/didClose", map[string]interface{}{"textDocument": map[string]string{"uri": testURI}}); err != nil {
+		t.Fatal(err)
+	}
+	if p := c.published(t); p.URI != testURI || len(p.Diagnostics) != 0 {
+		t.Errorf("expected diagnostics to be cleared, got %+v", p)
+	}
+	shutdown(t, c)
+}
+
+func TestCompletion(t *testing.T) {
+	c := start(t)
+	c.open(t, testURI, testLedger+"\n2024-02-01 * \"Gr\"\n  Ex\n  Assets:Checking  -1 \n")
+
+	tests := []struct {
+		name            string
+		line, character int
+		want            []string
+		start           int
+	}{
+		{"payee", 11, 16, []string{"Café", "Grocer"}, 14},
+		{"account", 12, 4, []string{"Assets:Checking", "Expenses:Food"}, 2},
+		{"currency", 13, 22, []string{"USD"}, 22},
+		{"account after directive", 0, 16, []string{"Assets:Checking", "Expenses:Food"}, 16},
+		{"nothing in a narration", 3, 26, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var items []CompletionItem
+			c.at(t, "textDocument/completion", tt.line, tt.character, &items)
+			var labels []string
+			for _, item := range items {
+				labels = append(labels, item.Label)
+				if item.TextEdit.Range.Start.Character != tt.start || item.TextEdit.Range.End.Character != tt.character {
+					t.Errorf("%s: unexpected edit range %+v", item.Label, item.TextEdit.Range)
+				}
+			}
+			if strings.Join(labels, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("expected %v, got %v", tt.want, labels)
+			}
+		})
+	}
+	shutdown(t, c)
+}
+
+func TestHoverAndDefinition(t *testing.T) {
+	c := start(t)
+	c.open(t, testURI, testLedger)
+
+	var hover Hover
+	c.at(t, "textDocument/hover", 4, 5, &hover)
+	for _, want := range []string{"**Expenses:Food**", "Opened 2024-01-01.", "| USD | 57.2 |"} {
+		if !strings.Contains(hover.Contents.Value, want) {
+			t.Errorf("hover %q does not contain %q", hover.Contents.Value, want)
+		}
+	}
+	if hover.Range == nil || *hover.Range != (Range{Start: Position{Line: 4, Character: 2}, End: Position{Line: 4, Character: 15}}) {
+		t.Errorf("unexpected hover range %+v", hover.Range)
+	}
+
+	var none *Hover
+	c.at(t, "textDocument/hover", 3, 15, &none)
+	if none != nil {
+		t.Errorf("expected no hover on a payee, got %+v", none)
+	}
+
+	var loc Location
+	c.at(t, "textDocument/definition", 9, 4, &loc)
+	want := Location{URI: testURI, Range: Range{Start: Position{Line: 0, Character: 16}, End: Position{Line: 0, Character: 31}}}
+	if loc != want {
+		t.Errorf("expected %+v, got %+v", want, loc)
+	}
+	shutdown(t, c)
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := start(t)
+	c.open(t, testURI, testLedger)
+
+	var symbols []DocumentSymbol
+	err := c.Call(context.Background(), "textDocument/documentSymbol", map[string]interface{}{
+		"textDocument": map[string]string{"uri": testURI},
+	}, &symbols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(symbols) != 2 {
+		t.Fatalf("expected 2 transactions, got %+v", symbols)
+	}
+	lunch := symbols[1]
+	if lunch.Name != "2024-01-09 Café: Lunch" || lunch.Kind != symbolEvent || lunch.Range.Start.Line != 7 || lunch.Range.End.Line != 9 {
+		t.Errorf("unexpected symbol %+v", lunch)
+	}
+	if len(lunch.Children) != 2 || lunch.Children[0].Name != "Expenses:Food" || lunch.Children[0].Detail != "12.00 USD" {
+		t.Errorf("unexpected postings %+v", lunch.Children)
+	}
+	shutdown(t, c)
+}
+
+// TestIncludedFiles checks that a document is loaded with the files it
+// includes: accounts opened there are defined and no longer unused.
+func TestIncludedFiles(t *testing.T) {
+	dir := t.TempDir()
+	accounts := filepath.Join(dir, "accounts.beancount")
+	if err := os.WriteFile(accounts, []byte("2024-01-01 open Assets:Checking\n2024-01-01 open Expenses:Food\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	main := "include \"accounts.beancount\"\n\n2024-01-05 * \"Grocer\" \"Groceries\"\n  Expenses:Food     45.20 USD\n  Assets:Checking\n"
+	uri := nameToURI(filepath.ToSlash(filepath.Join(dir, "main.beancount")))
+
+	c := start(t)
+	if p := c.open(t, uri, main); len(p.Diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics %+v", p.Diagnostics)
+	}
+	var loc Location
+	err := c.Call(context.Background(), "textDocument/definition", map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     Position{Line: 4, Character: 4},
+	}, &loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.URI != nameToURI(filepath.ToSlash(accounts)) || loc.Range.Start != (Position{Line: 0, Character: 16}) {
+		t.Errorf("unexpected definition %+v", loc)
+	}
+
+	p := c.open(t, "file:///nowhere/main.beancount", "include \"missing.beancount\"\n")
+	if len(p.Diagnostics) != 1 || p.Diagnostics[0].Code != engine.CodeIncludeNotFound || p.Diagnostics[0].Range.End.Character != 27 {
+		t.Errorf("expected an include error, got %+v", p.Diagnostics)
+	}
+	shutdown(t, c)
+}
+
+func TestLifecycleErrors(t *testing.T) {
+	var rpcErr *jsonrpc.Error
+	_, err := NewServer().Handle(context.Background(), &jsonrpc.Request{JSONRPC: jsonrpc.Version, ID: json.RawMessage("1"), Method: "textDocument/hover"})
+	if !errors.As(err, &rpcErr) || rpcErr.Code != codeServerNotInitialized {
+		t.Errorf("expected server not initialized, got %v", err)
+	}
+
+	in := strings.NewReader("Content-Length: 46\r\n\r\n{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"initialize\"}" +
+		"Content-Length: 33\r\n\r\n{\"jsonrpc\":\"2.0\",\"method\":\"exit\"}")
+	if err := NewServer().Serve(context.Background(), in, io.Discard); !errors.Is(err, errExitBeforeShutdown) {
+		t.Errorf("expected exit before shutdown, got %v", err)
+	}
+}
+
+// shutdown shuts the server down and makes it exit.
+func shutdown(t *testing.T, c *client) {
+	t.Helper()
+	if err := c.Call(context.Background(), "shutdown", nil, nil); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := c.Notify("exit", nil); err != nil {
+		t.Fatal(err)
+	}
+}
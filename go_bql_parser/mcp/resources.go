@@ -0,0 +1,104 @@
+package mcp
+
+import (
+	"encoding/json"
+
+	"bql-parser/jsonrpc"
+)
+
+// codeResourceNotFound is the MCP error code for an unknown resource URI.
+const codeResourceNotFound = -32002
+
+// Resource URIs served by the server.
+const (
+	samplesURI  = "bql://samples"
+	accountsURI = "ledger://accounts"
+	statsURI    = "ledger://stats"
+)
+
+const sampleQueries = `-- List all expense postings with dates
+SELECT date, account, position WHERE account = 'Expenses:Food:Groceries'
+
+-- Total spending by expense category
+SELECT account, SUM(amount) FROM 'Expenses' GROUP BY account ORDER BY sum(amount) DESC
+
+-- All salary deposits
+SELECT date, amount WHERE account = 'Income:Salary:AcmeCo'
+
+-- Count postings per account
+SELECT account, COUNT(*) GROUP BY account ORDER BY count(*) DESC
+
+-- Where each posting comes from, for multi-file ledgers
+SELECT filename, lineno, account, position WHERE account = 'Expenses:Rent'
+`
+
+type resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MimeType    string `json:"mimeType"`
+}
+
+type resourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// resources lists the sample queries and, if the server has a ledger, its
+// accounts and statistics.
+func (s *Server) resources() []resource {
+	list := []resource{{
+		URI:         samplesURI,
+		Name:        "Sample BQL queries",
+		Description: "Example queries covering filtering, grouping, aggregation and sorting.",
+		MimeType:    "text/plain",
+	}}
+	if s.Ledger != nil {
+		list = append(list,
+			resource{
+				URI:         accountsURI,
+				Name:        "Ledger accounts",
+				Description: "Sorted list of the accounts used by the ledger's postings.",
+				MimeType:    "application/json",
+			},
+			resource{
+				URI:         statsURI,
+				Name:        "Ledger statistics",
+				Description: "Transaction, posting and account counts, currencies and date range of the ledger.",
+				MimeType:    "application/json",
+			})
+	}
+	return list
+}
+
+func (s *Server) readResource(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		URI string `json:"uri"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	var contents resourceContents
+	switch {
+	case p.URI == samplesURI:
+		contents = resourceContents{URI: p.URI, MimeType: "text/plain", Text: sampleQueries}
+	case p.URI == accountsURI && s.Ledger != nil:
+		contents = jsonContents(p.URI, s.Ledger.Accounts())
+	case p.URI == statsURI && s.Ledger != nil:
+		contents = jsonContents(p.URI, s.Ledger.Stats())
+	default:
+		return nil, &jsonrpc.Error{
+			Code:    codeResourceNotFound,
+			Message: "resource not found",
+			Data:    map[string]string{"uri": p.URI},
+		}
+	}
+	return map[string]interface{}{"contents": []resourceContents{contents}}, nil
+}
+
+func jsonContents(uri string, v interface{}) resourceContents {
+	data, _ := json.Marshal(v)
+	return resourceContents{URI: uri, MimeType: "application/json", Text: string(data)}
+}
@@ -0,0 +1,124 @@
+// Package mcp serves the BQL engine as a Model Context Protocol server:
+// tools to parse BQL, execute queries and check ledger syntax, and
+// resources for the accounts of a ledger and sample queries. Messages are
+// JSON-RPC over a newline-delimited stream, as in the MCP stdio transport.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"bql-parser/engine"
+	"bql-parser/jsonrpc"
+)
+
+// ProtocolVersion is the latest MCP revision the server implements.
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions lists the MCP revisions accepted from clients, newest
+// first.
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// Server name and version reported to clients.
+const (
+	ServerName    = "wazbean-bql"
+	ServerVersion = "0.2.0"
+)
+
+const instructions = `Query Beancount ledgers with BQL. Use parse_bql to validate a query, ` +
+	`execute_bql to run it against a ledger and check_beancount_syntax to find ledger errors. ` +
+	`Read bql://samples for example queries.`
+
+// Server is an MCP server for the BQL engine. A zero Server has no ledger
+// of its own; tools must then be given a ledger in their arguments.
+type Server struct {
+	// Ledger, if set, is used by tools called without a ledger and is
+	// exposed through the ledger:// resources.
+	Ledger *engine.LedgerSession
+}
+
+// NewServer returns a server for the given ledger, which may be nil.
+func NewServer(ledger *engine.LedgerSession) *Server {
+	return &Server{Ledger: ledger}
+}
+
+// Serve answers requests read from r on w until r ends or ctx is
+// cancelled.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	return jsonrpc.Serve(ctx, jsonrpc.NewLineStream(r, w), s.Handle)
+}
+
+// Handle dispatches one MCP request.
+func (s *Server) Handle(ctx context.Context, req *jsonrpc.Request) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		return s.initialize(req.Params)
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": tools}, nil
+	case "tools/call":
+		return s.callTool(req.Params)
+	case "resources/list":
+		return map[string]interface{}{"resources": s.resources()}, nil
+	case "resources/read":
+		return s.readResource(req.Params)
+	}
+	if strings.HasPrefix(req.Method, "notifications/") {
+		return nil, nil
+	}
+	return nil, jsonrpc.NewError(jsonrpc.CodeMethodNotFound, "method not found: "+req.Method)
+}
+
+type initializeParams struct {
+	ProtocolVersion string `json:"protocolVersion"`
+}
+
+type initializeResult struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ServerInfo      serverInfo             `json:"serverInfo"`
+	Instructions    string                 `json:"instructions"`
+}
+
+type serverInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// initialize agrees on the protocol version: the client's if the server
+// supports it, otherwise the latest the server implements.
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	var p initializeParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	version := ProtocolVersion
+	for _, v := range supportedVersions {
+		if v == p.ProtocolVersion {
+			version = v
+		}
+	}
+	return initializeResult{
+		ProtocolVersion: version,
+		Capabilities: map[string]interface{}{
+			"tools":     struct{}{},
+			"resources": struct{}{},
+		},
+		ServerInfo:   serverInfo{Name: ServerName, Version: ServerVersion},
+		Instructions: instructions,
+	}, nil
+}
+
+// decodeParams unmarshals request params. Missing params leave v unset.
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return jsonrpc.NewError(jsonrpc.CodeInvalidParams, "invalid params: "+err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bql-parser/engine"
+	"bql-parser/jsonrpc"
+)
+
+const testLedger = `2024-01-01 open Assets:Checking USD
+2024-01-01 open Expenses:Food USD
+
+2024-01-05 * "Grocer" "Groceries"
+  Expenses:Food     45.20 USD
+  Assets:Checking  -45.20 USD
+
+2024-01-09 * "Cafe" "Lunch"
+  Expenses:Food     12.00 USD
+  Assets:Checking  -12.00 USD
+`
+
+// connect starts the server on one end of a pipe and returns an
+// initialized client for the other end.
+func connect(t *testing.T, s *Server) *jsonrpc.Client {
+	t.Helper()
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(context.Background(), serverIn, serverOut)
+		serverOut.Close()
+	}()
+	t.Cleanup(func() {
+		clientOut.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+
+	c := jsonrpc.NewClient(jsonrpc.NewLineStream(clientIn, clientOut))
+	var init initializeResult
+	err := c.Call(context.Background(), "initialize", map[string]interface{}{
+		"protocolVersion": "2025-03-26",
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "test", "version": "1"},
+	}, &init)
+	if err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	if init.ProtocolVersion != "2025-03-26" || init.ServerInfo.Name != ServerName {
+		t.Errorf("unexpected initialize result: %+v", init)
+	}
+	if err := c.Notify("notifications/initialized", nil); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+type callResult struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent"`
+	IsError           bool            `json:"isError"`
+}
+
+func callTool(t *testing.T, c *jsonrpc.Client, name string, args map[string]interface{}) *callResult {
+	t.Helper()
+	var res callResult
+	err := c.Call(context.Background(), "tools/call", map[string]interface{}{"name": name, "arguments": args}, &res)
+	if err != nil {
+		t.Fatalf("tools/call %s: %v", name, err)
+	}
+	if len(res.Content) != 1 || res.Content[0].Type != "text" {
+		t.Fatalf("expected one text content, got %+v", res.Content)
+	}
+	return &res
+}
+
+func TestInitializeUnknownVersion(t *testing.T) {
+	res, err := NewServer(nil).initialize(json.RawMessage(`{"protocolVersion":"1999-01-01"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := res.(initializeResult).ProtocolVersion; v != ProtocolVersion {
+		t.Errorf("expected the latest version, got %s", v)
+	}
+}
+
+func TestToolsList(t *testing.T) {
+	c := connect(t, NewServer(nil))
+	var res struct {
+		Tools []struct {
+			Name         string                 `json:"name"`
+			InputSchema  map[string]interface{} `json:"inputSchema"`
+			OutputSchema map[string]interface{} `json:"outputSchema"`
+		} `json:"tools"`
+	}
+	if err := c.Call(context.Background(), "tools/list", nil, &res); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range res.Tools {
+		names = append(names, tool.Name)
+		if tool.InputSchema["type"] != "object" || tool.OutputSchema["type"] != "object" {
+			t.Errorf("%s: input and output schemas must be objects", tool.Name)
+		}
+	}
+	if got := strings.Join(names, ","); got != "parse_bql,execute_bql,execute_bql_script,check_beancount_syntax" {
+		t.Errorf("unexpected tools: %s", got)
+	}
+}
+
+func TestParseBQLTool(t *testing.T) {
+	c := connect(t, NewServer(nil))
+
+	res := callTool(t, c, "parse_bql", map[string]interface{}{"query": "SELECT account GROUP BY account"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", res.Content[0].Text)
+	}
+	var ast engine.Query
+	if err := json.Unmarshal(res.StructuredContent, &ast); err != nil || len(ast.GroupBy) != 1 {
+		t.Errorf("unexpected AST %s: %v", res.StructuredContent, err)
+	}
+
+	res = callTool(t, c, "parse_bql", map[string]interface{}{"query": "SELECT account WHERE"})
+	if !res.IsError || !strings.Contains(res.Content[0].Text, `"code":"E_SYNTAX"`) {
+		t.Errorf("expected a syntax error envelope, got %+v", res)
+	}
+}
+
+func TestExecuteBQLTool(t *testing.T) {
+	c := connect(t, NewServer(nil))
+
+	res := callTool(t, c, "execute_bql", map[string]interface{}{
+		"query":       "SELECT payee, amount WHERE account = 'Expenses:Food'",
+		"ledger_text": testLedger,
+		"format":      "csv",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", res.Content[0].Text)
+	}
+	if got := res.Content[0].Text; got != "payee,amount\nGrocer,45.2\nCafe,12\n" {
+		t.Errorf("unexpected csv text: %q", got)
+	}
+	var result engine.Result
+	if err := json.Unmarshal(res.StructuredContent, &result); err != nil || len(result.Rows) != 2 {
+		t.Errorf("unexpected structured content %s: %v", res.StructuredContent, err)
+	}
+
+	res = callTool(t, c, "execute_bql", map[string]interface{}{
+		"query":       "SELECT account",
+		"ledger_path": filepath.Join(t.TempDir(), "missing.beancount"),
+	})
+	if !res.IsError || !strings.Contains(res.Content[0].Text, `"phase":"ledger"`) {
+		t.Errorf("expected a ledger error, got %+v", res)
+	}
+}
+
+func TestExecuteBQLToolParams(t *testing.T) {
+	c := connect(t, NewServer(nil))
+
+	res := callTool(t, c, "execute_bql", map[string]interface{}{
+		"query":       "SELECT payee WHERE account = :account",
+		"ledger_text": testLedger,
+		"params":      map[string]interface{}{"account": "Expenses:Food"},
+		"format":      "csv",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", res.Content[0].Text)
+	}
+	if got := res.Content[0].Text; got != "payee\nGrocer\nCafe\n" {
+		t.Errorf("unexpected csv text: %q", got)
+	}
+
+	res = callTool(t, c, "execute_bql", map[string]interface{}{
+		"query":       "SELECT payee WHERE account = ?",
+		"ledger_text": testLedger,
+	})
+	if !res.IsError || !strings.Contains(res.Content[0].Text, `"code":"E_MISSING_PARAMETER"`) {
+		t.Errorf("expected a missing parameter error, got %+v", res)
+	}
+}
+
+func TestExecuteBQLScriptTool(t *testing.T) {
+	c := connect(t, NewServer(nil))
+
+	res := callTool(t, c, "execute_bql_script", map[string]interface{}{
+		"script":      "SELECT payee WHERE account = 'Expenses:Food'; SELECT COUNT(*)",
+		"ledger_text": testLedger,
+		"format":      "csv",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", res.Content[0].Text)
+	}
+	if got := res.Content[0].Text; got != "payee\nGrocer\nCafe\n\ncount(*)\n4\n" {
+		t.Errorf("unexpected csv text: %q", got)
+	}
+	var result engine.ScriptResult
+	if err := json.Unmarshal(res.StructuredContent, &result); err != nil || len(result.Results) != 2 {
+		t.Errorf("unexpected structured content %s: %v", res.StructuredContent, err)
+	}
+
+	res = callTool(t, c, "execute_bql_script", map[string]interface{}{
+		"script":      "SELECT payee; SELECT AVG(amount)",
+		"ledger_text": testLedger,
+	})
+	if !res.IsError || !strings.Contains(res.Content[0].Text, `"statement":2`) {
+		t.Errorf("expected an error in statement 2, got %+v", res)
+	}
+}
+
+func TestExecuteBQLToolServerLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.beancount")
+	if err := os.WriteFile(path, []byte(testLedger), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := connect(t, NewServer(engine.LoadLedgerSession(engine.DiskSource{}, path)))
+
+	res := callTool(t, c, "execute_bql", map[string]interface{}{"query": "SELECT COUNT(*)"})
+	if res.IsError || !strings.Contains(res.Content[0].Text, `"rows":[[4]]`) {
+		t.Errorf("expected 4 postings, got %+v", res)
+	}
+}
+
+func TestToolArgumentErrors(t *testing.T) {
+	c := connect(t, NewServer(nil))
+	for _, tc := range []struct {
+		name string
+		args map[string]interface{}
+	}{
+		{"parse_bql", map[string]interface{}{}},
+		{"parse_bql", map[string]interface{}{"query": "SELECT account", "limit": 5}},
+		{"execute_bql", map[string]interface{}{"query": "SELECT account"}},
+		{"execute_bql", map[string]interface{}{"query": "SELECT account", "ledger_text": "", "ledger_path": "x"}},
+		{"drop_tables", map[string]interface{}{}},
+	} {
+		err := c.Call(context.Background(), "tools/call", map[string]interface{}{"name": tc.name, "arguments": tc.args}, nil)
+		var rpcErr *jsonrpc.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc.CodeInvalidParams {
+			t.Errorf("%s %v: expected invalid params, got %v", tc.name, tc.args, err)
+		}
+	}
+}
+
+func TestCheckBeancountSyntaxTool(t *testing.T) {
+	c := connect(t, NewServer(nil))
+
+	res := callTool(t, c, "check_beancount_syntax", map[string]interface{}{
+		"ledger_text": "2024-01-01 open Assets:Cash\n2024-01-02 * \"No postings\"\n",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", res.Content[0].Text)
+	}
+	var result engine.SyntaxResult
+	if err := json.Unmarshal(res.StructuredContent, &result); err != nil {
+		t.Fatal(err)
+	}
+	// The unused account is a warning; the transaction without postings is
+	// the error that makes the ledger invalid.
+	if result.Valid || len(result.Errors) != 2 {
+		t.Fatalf("unexpected syntax result: %+v", result)
+	}
+	if e := result.Errors[0]; e.Code != engine.CodeUnusedAccount || e.Severity != engine.SeverityWarning || e.Column != 17 {
+		t.Errorf("unexpected warning: %+v", e)
+	}
+	if e := result.Errors[1]; e.Code != engine.CodeTxnNoPostings || e.Line != 2 {
+		t.Errorf("unexpected error: %+v", e)
+	}
+}
+
+func TestResources(t *testing.T) {
+	c := connect(t, NewServer(engine.NewLedgerSession(testLedger)))
+
+	var list struct {
+		Resources []resource `json:"resources"`
+	}
+	if err := c.Call(context.Background(), "resources/list", nil, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Resources) != 3 {
+		t.Fatalf("expected 3 resources, got %+v", list.Resources)
+	}
+
+	var read struct {
+		Contents []resourceContents `json:"contents"`
+	}
+	if err := c.Call(context.Background(), "resources/read", map[string]string{"uri": accountsURI}, &read); err != nil {
+		t.Fatal(err)
+	}
+	if got := read.Contents[0].Text; got != `["Assets:Checking","Expenses:Food"]` {
+		t.Errorf("unexpected accounts: %s", got)
+	}
+
+	err := c.Call(context.Background(), "resources/read", map[string]string{"uri": "ledger://nope"}, nil)
+	var rpcErr *jsonrpc.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != codeResourceNotFound {
+		t.Errorf("expected resource not found, got %v", err)
+	}
+}
+
+func TestResourcesWithoutLedger(t *testing.T) {
+	if got := NewServer(nil).resources(); len(got) != 1 || got[0].URI != samplesURI {
+		t.Errorf("expected only the samples resource, got %+v", got)
+	}
+}
+
+func TestSampleQueriesParse(t *testing.T) {
+	for _, block := range strings.Split(sampleQueries, "\n\n") {
+		var query []string
+		for _, line := range strings.Split(block, "\n") {
+			if line != "" && !strings.HasPrefix(line, "--") {
+				query = append(query, line)
+			}
+		}
+		if _, err := engine.Parse(strings.Join(query, " ")); err != nil {
+			t.Errorf("sample %q does not parse: %v", query, err)
+		}
+	}
+}
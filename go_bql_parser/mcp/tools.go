@@ -0,0 +1,262 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"bql-parser/engine"
+	"bql-parser/jsonrpc"
+	"bql-parser/schemas"
+)
+
+// tool is a tool definition as listed by tools/list.
+type tool struct {
+	Name         string          `json:"name"`
+	Title        string          `json:"title"`
+	Description  string          `json:"description"`
+	InputSchema  json.RawMessage `json:"inputSchema"`
+	OutputSchema json.RawMessage `json:"outputSchema"`
+}
+
+var tools = []tool{
+	{
+		Name:         "parse_bql",
+		Title:        "Parse BQL",
+		Description:  "Parse a Beancount Query Language query and return its AST. Syntax errors report the line, column, offending token and expected tokens.",
+		InputSchema:  schemas.Get("parse_bql_input.schema.json"),
+		OutputSchema: schemas.Get("parse_bql_output.schema.json"),
+	},
+	{
+		Name:         "execute_bql",
+		Title:        "Execute BQL",
+		Description:  "Execute a BQL query against a Beancount ledger and return the result columns and rows. Values for ? and :name parameters in the query are passed in params.",
+		InputSchema:  schemas.Get("execute_bql_input.schema.json"),
+		OutputSchema: schemas.Get("query_result.schema.json"),
+	},
+	{
+		Name:         "execute_bql_script",
+		Title:        "Execute BQL script",
+		Description:  "Execute several BQL queries, separated by semicolons, against one load of a Beancount ledger and return one result per query, e.g. a balance sheet, an income statement and top payees in one call.",
+		InputSchema:  schemas.Get("execute_bql_script_input.schema.json"),
+		OutputSchema: schemas.Get("script_result.schema.json"),
+	},
+	{
+		Name:         "check_beancount_syntax",
+		Title:        "Check Beancount syntax",
+		Description:  "Check the syntax and accounts of a Beancount ledger. Each diagnostic has a line and column range, a severity (error, warning or info), a stable code such as E_TXN_NO_POSTINGS and related locations.",
+		InputSchema:  schemas.Get("check_beancount_syntax_input.schema.json"),
+		OutputSchema: schemas.Get("check_beancount_syntax_output.schema.json"),
+	},
+}
+
+type callToolParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// toolResult is the result of tools/call. A tool that fails reports the
+// error envelope as text with IsError set, rather than a JSON-RPC error.
+type toolResult struct {
+	Content           []textContent `json:"content"`
+	StructuredContent interface{}   `json:"structuredContent,omitempty"`
+	IsError           bool          `json:"isError,omitempty"`
+}
+
+type textContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func (s *Server) callTool(params json.RawMessage) (interface{}, error) {
+	var p callToolParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	switch p.Name {
+	case "parse_bql":
+		var args struct {
+			Query *string `json:"query"`
+		}
+		if err := decodeArguments(p.Arguments, &args); err != nil {
+			return nil, err
+		}
+		if args.Query == nil {
+			return nil, missingArgument("query")
+		}
+		return parseBQL(*args.Query), nil
+	case "execute_bql":
+		var args struct {
+			Query      *string         `json:"query"`
+			LedgerText *string         `json:"ledger_text"`
+			LedgerPath string          `json:"ledger_path"`
+			Params     json.RawMessage `json:"params"`
+			Format     string          `json:"format"`
+		}
+		if err := decodeArguments(p.Arguments, &args); err != nil {
+			return nil, err
+		}
+		if args.Query == nil {
+			return nil, missingArgument("query")
+		}
+		session, err := s.ledger(args.LedgerText, args.LedgerPath)
+		if err != nil {
+			return nil, err
+		}
+		return executeBQL(session, *args.Query, args.Params, args.Format), nil
+	case "execute_bql_script":
+		var args struct {
+			Script     *string `json:"script"`
+			LedgerText *string `json:"ledger_text"`
+			LedgerPath string  `json:"ledger_path"`
+			Format     string  `json:"format"`
+		}
+		if err := decodeArguments(p.Arguments, &args); err != nil {
+			return nil, err
+		}
+		if args.Script == nil {
+			return nil, missingArgument("script")
+		}
+		session, err := s.ledger(args.LedgerText, args.LedgerPath)
+		if err != nil {
+			return nil, err
+		}
+		return executeScript(session, *args.Script, args.Format), nil
+	case "check_beancount_syntax":
+		var args struct {
+			LedgerText *string `json:"ledger_text"`
+			LedgerPath string  `json:"ledger_path"`
+		}
+		if err := decodeArguments(p.Arguments, &args); err != nil {
+			return nil, err
+		}
+		session, err := s.ledger(args.LedgerText, args.LedgerPath)
+		if err != nil {
+			return nil, err
+		}
+		return checkSyntax(session), nil
+	}
+	return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, fmt.Sprintf("unknown tool %q", p.Name))
+}
+
+func parseBQL(query string) *toolResult {
+	ast, err := engine.Parse(query)
+	if err != nil {
+		return errorResult(engine.NewErrorInfo(engine.PhaseParse, err))
+	}
+	return jsonResult(ast)
+}
+
+func executeBQL(session *engine.LedgerSession, query string, params json.RawMessage, format string) *toolResult {
+	if format == "" {
+		format = string(engine.FormatJSON)
+	}
+	f, err := engine.ParseFormat(format)
+	if err != nil {
+		return errorResult(engine.NewErrorInfo(engine.PhaseSerialize, err))
+	}
+	values, err := engine.ParseParams(string(params))
+	if err != nil {
+		return errorResult(engine.NewErrorInfo(engine.PhaseBind, err))
+	}
+	result, errInfo := session.QueryParams(query, values)
+	if errInfo != nil {
+		return errorResult(errInfo)
+	}
+	text, err := engine.Render(result, f)
+	if err != nil {
+		return errorResult(engine.NewErrorInfo(engine.PhaseSerialize, err))
+	}
+	return &toolResult{
+		Content:           []textContent{{Type: "text", Text: text}},
+		StructuredContent: result,
+	}
+}
+
+func executeScript(session *engine.LedgerSession, script, format string) *toolResult {
+	if format == "" {
+		format = string(engine.FormatJSON)
+	}
+	f, err := engine.ParseFormat(format)
+	if err != nil {
+		return errorResult(engine.NewErrorInfo(engine.PhaseSerialize, err))
+	}
+	results, errInfo := session.QueryScript(script)
+	if errInfo != nil {
+		return errorResult(errInfo)
+	}
+	text, err := engine.RenderScript(results, f)
+	if err != nil {
+		return errorResult(engine.NewErrorInfo(engine.PhaseSerialize, err))
+	}
+	return &toolResult{
+		Content:           []textContent{{Type: "text", Text: text}},
+		StructuredContent: engine.ScriptResult{Results: results},
+	}
+}
+
+// checkSyntax checks every file of the ledger. A ledger that failed to
+// load without a syntax error to show for it, e.g. because an included
+// file is missing, is reported as a tool error.
+func checkSyntax(session *engine.LedgerSession) *toolResult {
+	result := session.Check()
+	if err := session.LoadError(); err != nil && result.Valid {
+		return errorResult(engine.NewErrorInfo(engine.PhaseLedger, err))
+	}
+	return jsonResult(result)
+}
+
+// ledger returns the ledger named by tool arguments, or the server's own
+// ledger if none is named.
+func (s *Server) ledger(text *string, path string) (*engine.LedgerSession, error) {
+	switch {
+	case text != nil && path != "":
+		return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "set only one of ledger_text and ledger_path")
+	case text != nil:
+		return engine.NewLedgerSession(*text), nil
+	case path != "":
+		return engine.LoadLedgerSession(engine.DiskSource{}, path), nil
+	case s.Ledger != nil:
+		return s.Ledger, nil
+	}
+	return nil, jsonrpc.NewError(jsonrpc.CodeInvalidParams, "no ledger: set ledger_text or ledger_path")
+}
+
+// decodeArguments unmarshals tool arguments, rejecting unknown ones as the
+// input schemas do.
+func decodeArguments(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return jsonrpc.NewError(jsonrpc.CodeInvalidParams, "invalid arguments: "+err.Error())
+	}
+	return nil
+}
+
+func missingArgument(name string) error {
+	return jsonrpc.NewError(jsonrpc.CodeInvalidParams, "missing required argument: "+name)
+}
+
+// jsonResult returns v as structured content, with its JSON as text for
+// clients that do not read structured content.
+func jsonResult(v interface{}) *toolResult {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errorResult(engine.NewErrorInfo(engine.PhaseSerialize, err))
+	}
+	return &toolResult{
+		Content:           []textContent{{Type: "text", Text: string(data)}},
+		StructuredContent: v,
+	}
+}
+
+func errorResult(info *engine.ErrorInfo) *toolResult {
+	data, _ := json.Marshal(map[string]*engine.ErrorInfo{"error": info})
+	return &toolResult{
+		Content: []textContent{{Type: "text", Text: string(data)}},
+		IsError: true,
+	}
+}
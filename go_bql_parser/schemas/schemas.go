@@ -0,0 +1,21 @@
+// Package schemas embeds the JSON Schemas describing the inputs and
+// outputs of the engine, so that servers can advertise them at run time.
+package schemas
+
+import (
+	"embed"
+	"encoding/json"
+)
+
+//go:embed *.schema.json
+var files embed.FS
+
+// Get returns the schema with the given file name, e.g.
+// "query_result.schema.json". It panics if the schema does not exist.
+func Get(name string) json.RawMessage {
+	data, err := files.ReadFile(name)
+	if err != nil {
+		panic("schemas: " + err.Error())
+	}
+	return json.RawMessage(data)
+}